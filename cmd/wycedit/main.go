@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/huntresslabs/win-service-updater/updater"
+)
+
+// setFlag collects field=value pairs. Setting the server sites more than
+// once adds a site.
+type setFlag struct {
+	names  []string
+	values map[string][]string
+}
+
+func (s *setFlag) String() string {
+	var pairs []string
+	for _, name := range s.names {
+		for _, v := range s.values[name] {
+			pairs = append(pairs, name+"="+v)
+		}
+	}
+	return strings.Join(pairs, " ")
+}
+
+func (s *setFlag) Set(pair string) error {
+	name, value, ok := strings.Cut(pair, "=")
+	if !ok {
+		return fmt.Errorf("expected field=value, got %q", pair)
+	}
+	if s.values == nil {
+		s.values = make(map[string][]string)
+	}
+	if _, ok := s.values[name]; !ok {
+		s.names = append(s.names, name)
+	}
+	s.values[name] = append(s.values[name], value)
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	var set setFlag
+	get := flag.String("get", "", "print the values of a field")
+	flag.Var(&set, "set", "set a field, e.g., -set=serversites=https://example.com/widget.wys (repeatable)")
+	keyFile := flag.String("publickeyfile", "", "set the public key from a PEM or XML key file")
+	out := flag.String("out", "", "path of the WYC file to write, the WYC file is changed in place by default")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: wycedit [flags] client.wyc\n\nfields: %s\n\n", strings.Join(updater.WYCFields, ", "))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	wyc := flag.Arg(0)
+
+	if len(set.names) == 0 && *keyFile == "" {
+		config, err := updater.Info{}.ParseWYC(wyc)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := printFields(config, *get); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *keyFile != "" {
+		dat, err := os.ReadFile(*keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pub, err := updater.ReadPublicKey(dat)
+		if err != nil {
+			log.Fatal(err)
+		}
+		set.Set(updater.WYC_FIELD_PUBLIC_KEY + "=" + updater.PublicKeyXML(pub))
+	}
+
+	dst := wyc
+	if *out != "" {
+		dst = *out
+	}
+	config, err := updater.EditWYC(wyc, dst, func(config *updater.ConfigIUC) error {
+		for _, name := range set.names {
+			if err := config.SetField(name, set.values[name]...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := printFields(config, *get); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// printFields prints the field `name`, or every field if `name` is empty
+func printFields(config updater.ConfigIUC, name string) error {
+	if name != "" {
+		values, err := config.GetField(name)
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			fmt.Println(v)
+		}
+		return nil
+	}
+
+	for _, name := range updater.WYCFields {
+		values, _ := config.GetField(name)
+		for _, v := range values {
+			fmt.Printf("%s: %s\n", name, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/huntresslabs/win-service-updater/updater"
+)
+
+const usage = `usage: wyinspect <wyc|wys|wyu> [-json|-text] <file|URL|->
+       wyinspect verify [-json|-text] -wyc=file -wys=file -wyu=file
+
+Decodes a WYC (client.wyc), WYS (server file) or WYU (update archive)
+file. The file is read from a path, a URL (http, https, file or another
+scheme the updater fetches), a UNC path or stdin ("-").
+
+verify runs the checks the updater makes before installing an update on a
+machine with the WYC file, without installing it, and exits with 1 if a
+check fails.
+
+flags:
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		printUsage(nil)
+	}
+
+	kind := os.Args[1]
+	fs := flag.NewFlagSet(kind, flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "print JSON")
+	textOut := fs.Bool("text", false, "print text (the default)")
+	var wyc, wys, wyu *string
+	if kind == "verify" {
+		wyc = fs.String("wyc", "", "client WYC file")
+		wys = fs.String("wys", "", "WYS file of the update")
+		wyu = fs.String("wyu", "", "WYU file of the update")
+	}
+	fs.Usage = func() { printUsage(fs) }
+	fs.Parse(os.Args[2:])
+	if *jsonOut && *textOut {
+		printUsage(fs)
+	}
+
+	if kind == "verify" {
+		if fs.NArg() != 0 || *wyc == "" || *wys == "" || *wyu == "" {
+			printUsage(fs)
+		}
+		report := updater.VerifyPackage(*wyc, *wys, *wyu)
+		if err := output(report, *jsonOut); err != nil {
+			log.Fatal(err)
+		}
+		if !report.Passed {
+			os.Exit(1)
+		}
+		return
+	}
+	if fs.NArg() != 1 {
+		printUsage(fs)
+	}
+
+	dat, err := readInput(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var details interface{}
+	switch kind {
+	case "wyc":
+		details, err = updater.InspectWYC(dat)
+	case "wys":
+		details, err = updater.InspectWYS(dat)
+	case "wyu":
+		details, err = updater.InspectWYU(dat)
+	default:
+		printUsage(fs)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := output(details, *jsonOut); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// output prints `details` as JSON or text
+func output(details interface{}, jsonOut bool) error {
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(details)
+	}
+	return printText(os.Stdout, details)
+}
+
+func printUsage(fs *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, usage)
+	if fs != nil {
+		fs.PrintDefaults()
+	} else {
+		fmt.Fprintln(os.Stderr, "  -json\n    \tprint JSON\n  -text\n    \tprint text (the default)")
+	}
+	os.Exit(2)
+}
+
+// readInput reads a file, a URL, a UNC path or stdin ("-")
+func readInput(src string) ([]byte, error) {
+	switch {
+	case src == "-":
+		return io.ReadAll(os.Stdin)
+	case strings.Contains(src, "://") || strings.HasPrefix(src, `\\`):
+		var buf bytes.Buffer
+		err := updater.GetFile(context.Background(), nil, src, &buf)
+		return buf.Bytes(), err
+	}
+	return os.ReadFile(src)
+}
+
+func printText(out io.Writer, details interface{}) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	switch d := details.(type) {
+	case updater.WYCDetails:
+		field(w, "Company", d.CompanyName)
+		field(w, "Product", d.ProductName)
+		field(w, "GUID", d.GUID)
+		field(w, "Installed version", d.InstalledVersion)
+		field(w, "Server file sites", d.ServerFileSites...)
+		field(w, "wyUpdate server sites", d.WyupdateServerSites...)
+		field(w, "Header image alignment", d.HeaderImageAlignment)
+		field(w, "Header text indent", fmt.Sprint(d.HeaderTextIndent))
+		field(w, "Header text color", d.HeaderTextColor)
+		field(w, "Header file", d.HeaderFilename)
+		field(w, "Side image file", d.SideImageFilename)
+		field(w, "Language culture", d.LanguageCulture)
+		field(w, "Language file", d.LanguageFilename)
+		field(w, "Hide header divider", fmt.Sprint(d.HideHeaderDivider))
+		field(w, "Close wyUpdate", fmt.Sprint(d.CloseWyupdate))
+		field(w, "Custom title bar", d.CustomTitleBar)
+		field(w, "Public key fingerprint", d.PublicKeyFingerprint)
+		field(w, "Public key error", d.PublicKeyError)
+		field(w, "Report URL", d.ReportURL)
+	case updater.WYSDetails:
+		field(w, "Current last version", d.CurrentLastVersion)
+		field(w, "Version to update", d.VersionToUpdate)
+		field(w, "Min client version", d.MinClientVersion)
+		field(w, "Server file site", d.ServerFileSite)
+		field(w, "Update file sites", d.UpdateFileSites...)
+		field(w, "Update file size", fmt.Sprint(d.UpdateFileSize))
+		field(w, "Update file Adler32", fmt.Sprint(d.UpdateFileAdler32))
+		field(w, "File signature", d.FileSignature)
+		field(w, "Latest changes", d.LatestChanges)
+		if d.RTFSize > 0 {
+			field(w, "RTF changes", fmt.Sprintf("%d bytes", d.RTFSize))
+		}
+		field(w, "Update error text", d.UpdateErrorText)
+		field(w, "Update error link", d.UpdateErrorLink)
+		if d.WYSFolder != 0 {
+			field(w, "WYS folder", fmt.Sprint(d.WYSFolder))
+		}
+	case updater.WYUDetails:
+		field(w, "Services to stop", d.ServicesToStop...)
+		field(w, "Services to start", d.ServicesToStart...)
+		field(w, "Registry changes", fmt.Sprint(d.RegistryChanges))
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "NAME\tSIZE\tADLER32\tEXPECTED\t")
+		for _, f := range d.Files {
+			expected := "-"
+			if f.ExpectedAdler32 != 0 {
+				expected = fmt.Sprint(f.ExpectedAdler32)
+			}
+			name := f.Name
+			if f.Hook {
+				name += " (hook)"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t\n", name, f.Size, f.Adler32, expected)
+		}
+	case updater.VerifyReport:
+		for _, c := range d.Checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", strings.ToUpper(c.Status), c.Name, c.Detail)
+		}
+		fmt.Fprintln(w)
+		if d.Passed {
+			fmt.Fprintf(w, "PASSED: version %s can be installed over %s\n", d.AvailableVersion, d.InstalledVersion)
+		} else {
+			fmt.Fprintln(w, "FAILED")
+		}
+	}
+	return w.Flush()
+}
+
+// field prints a field with its values, empty fields are left out
+func field(w io.Writer, name string, values ...string) {
+	for i, v := range values {
+		if v == "" {
+			continue
+		}
+		if i > 0 {
+			name = ""
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, v)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/huntresslabs/win-service-updater/updater"
+)
+
+const usage = `usage: wykey <command> [flags]
+
+commands:
+  generate -out=file [-bits=2048] [-format=pem|xml]
+      generate a key pair, write the private key to the file and print
+      the public key as XML for client.wyc
+  public [-format=xml|pem] file
+      print the public key of a private or public key
+  convert [-format=pem|xml] file
+      print a private or public key in the other format
+  fingerprint file
+      print the SHA256 fingerprint of a private or public key
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "generate":
+		err = generate(args)
+	case "public":
+		err = public(args)
+	case "convert":
+		err = convert(args)
+	case "fingerprint":
+		err = fingerprint(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func generate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	out := fs.String("out", "", "file to write the private key to")
+	bits := fs.Int("bits", updater.DEFAULT_KEY_BITS, "key size")
+	format := fs.String("format", "pem", "format of the private key (pem or xml)")
+	fs.Parse(args)
+	if *out == "" {
+		return fmt.Errorf("generate requires -out")
+	}
+
+	priv, err := updater.GenerateKey(*bits)
+	if err != nil {
+		return err
+	}
+	dat, err := marshalPrivate(priv, *format)
+	if err != nil {
+		return err
+	}
+	// O_EXCL so an existing key is never overwritten
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(dat)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updater.PublicKeyXML(&priv.PublicKey))
+	return nil
+}
+
+func public(args []string) error {
+	fs := flag.NewFlagSet("public", flag.ExitOnError)
+	format := fs.String("format", "xml", "format of the public key (xml or pem)")
+	fs.Parse(args)
+
+	dat, err := readKeyFile(fs)
+	if err != nil {
+		return err
+	}
+	pub, err := updater.ReadPublicKey(dat)
+	if err != nil {
+		return err
+	}
+	out, err := marshalPublic(pub, *format)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
+	return nil
+}
+
+func convert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	format := fs.String("format", "", "format to convert to (pem or xml), the other format by default")
+	fs.Parse(args)
+
+	dat, err := readKeyFile(fs)
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = "xml"
+		if bytes.HasPrefix(bytes.TrimSpace(dat), []byte("<")) {
+			*format = "pem"
+		}
+	}
+
+	var out []byte
+	if updater.IsPrivateKey(dat) {
+		priv, err := updater.ReadPrivateKey(dat)
+		if err != nil {
+			return err
+		}
+		out, err = marshalPrivate(priv, *format)
+		if err != nil {
+			return err
+		}
+	} else {
+		pub, err := updater.ReadPublicKey(dat)
+		if err != nil {
+			return err
+		}
+		out, err = marshalPublic(pub, *format)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Print(string(out))
+	return nil
+}
+
+func fingerprint(args []string) error {
+	fs := flag.NewFlagSet("fingerprint", flag.ExitOnError)
+	fs.Parse(args)
+
+	dat, err := readKeyFile(fs)
+	if err != nil {
+		return err
+	}
+	pub, err := updater.ReadPublicKey(dat)
+	if err != nil {
+		return err
+	}
+	fp, err := updater.KeyFingerprint(pub)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("SHA256:%s (%d bits)\n", fp, pub.N.BitLen())
+	return nil
+}
+
+// readKeyFile reads the key file named by the only argument
+func readKeyFile(fs *flag.FlagSet) ([]byte, error) {
+	if fs.NArg() != 1 {
+		return nil, fmt.Errorf("%s requires a key file", fs.Name())
+	}
+	dat, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	if len(dat) == 0 {
+		return nil, fmt.Errorf("%s is empty", fs.Arg(0))
+	}
+	return dat, nil
+}
+
+func marshalPrivate(priv *rsa.PrivateKey, format string) ([]byte, error) {
+	switch format {
+	case "pem":
+		return updater.MarshalPrivateKeyPEM(priv)
+	case "xml":
+		s, err := updater.PrivateKeyXML(priv)
+		return []byte(s + "\n"), err
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+func marshalPublic(pub *rsa.PublicKey, format string) ([]byte, error) {
+	switch format {
+	case "pem":
+		return updater.MarshalPublicKeyPEM(pub)
+	case "xml":
+		return []byte(updater.PublicKeyXML(pub) + "\n"), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/huntresslabs/win-service-updater/updater"
+)
+
+// listFlag is a comma separated list that can be repeated
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func main() {
+	var b updater.WYUBuilder
+	var sites listFlag
+	flag.StringVar(&b.Dir, "dir", "", "directory with the files to install")
+	flag.Var((*listFlag)(&b.ServicesToStop), "stop", "services to stop before the update (comma separated, repeatable)")
+	flag.Var((*listFlag)(&b.ServicesToStart), "start", "services to start after the update (comma separated, repeatable)")
+	out := flag.String("out", "", "path of the WYU file to write")
+	version := flag.String("version", "", "version of the update, for the WYS file")
+	flag.Var(&sites, "url", "URL the WYU file is downloaded from, for the WYS file (comma separated, repeatable)")
+	wysPath := flag.String("wys", "", "path of the WYS file to write")
+	keyPath := flag.String("key", "", "RSA private key (PEM or XML) to sign the WYU file with")
+	flag.Parse()
+
+	if b.Dir == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *wysPath != "" && (*version == "" || len(sites) == 0) {
+		log.Fatal("-wys requires -version and -url")
+	}
+
+	udt, err := b.BuildFile(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("wrote %s with %d files\n", *out, len(udt.Files))
+
+	if *wysPath == "" {
+		return
+	}
+
+	wys, err := updater.NewWYS(*version, *out, sites)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *keyPath != "" {
+		pem, err := os.ReadFile(*keyPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		priv, err := updater.ReadPrivateKey(pem)
+		if err != nil {
+			log.Fatal(err)
+		}
+		wys.FileSha1, err = updater.SignFile(priv, *out)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := updater.WriteWYSFile(*wysPath, wys); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("wrote %s for version %s (size %d, adler32 %d)\n", *wysPath, *version, wys.UpdateFileSize, wys.UpdateFileAdler32)
+}
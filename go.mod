@@ -3,13 +3,13 @@ module github.com/huntresslabs/win-service-updater
 go 1.20
 
 require (
-	github.com/davecgh/go-spew v1.1.1
 	github.com/hashicorp/go-multierror v1.0.0
 	github.com/stretchr/testify v1.4.0
 	golang.org/x/sys v0.5.0
 )
 
 require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/hashicorp/errwrap v1.0.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v2 v2.2.2 // indirect
@@ -1,6 +1,6 @@
 #!/bin/bash
 
-GOOSES=("windows")
+GOOSES=("windows" "linux")
 TAGS=("debug")
 
 FAILED=0
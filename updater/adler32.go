@@ -2,12 +2,16 @@ package updater
 
 import (
 	"hash/adler32"
-	"io/ioutil"
 )
 
 // GetAdler32 returns the Adler32 checksum of a file
 func GetAdler32(file string) (uint32, error) {
-	dat, err := ioutil.ReadFile(file)
+	return getAdler32(OSFS{}, file)
+}
+
+// getAdler32 returns the Adler32 checksum of `file` in `fsys`
+func getAdler32(fsys FS, file string) (uint32, error) {
+	dat, err := fsOrOS(fsys).ReadFile(file)
 	if nil != err {
 		return 0, err
 	}
@@ -16,7 +20,13 @@ func GetAdler32(file string) (uint32, error) {
 
 // VerifyAdler32Checksum returns true if checksum was verified
 func VerifyAdler32Checksum(expected int64, file string) bool {
-	cs, err := GetAdler32(file)
+	return verifyAdler32Checksum(OSFS{}, expected, file)
+}
+
+// verifyAdler32Checksum returns true if the checksum of `file` in `fsys` was
+// verified
+func verifyAdler32Checksum(fsys FS, expected int64, file string) bool {
+	cs, err := getAdler32(fsys, file)
 	if nil != err {
 		return false
 	}
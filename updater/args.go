@@ -2,10 +2,15 @@ package updater
 
 import (
 	"flag"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/huntresslabs/win-service-updater/updater/useragent"
 )
 
 // https://wyday.com/wybuild/help/wyupdate-commandline.php
@@ -18,56 +23,257 @@ import (
 
 // Args contains the parsed command-line arguments
 type Args struct {
-	Debug         bool
-	Quickcheck    bool
-	Justcheck     bool
-	Noerr         bool
-	Fromservice   bool
-	Urlargs       string
-	Outputinfo    bool
-	OutputinfoLog string
-	Logfile       string
-	Cdata         string
-	WYSTestServer string // Used for testing
-	WYUTestServer string // Used for testing
+	Debug           bool
+	Quickcheck      bool
+	Justcheck       bool
+	Noerr           bool
+	Fromservice     bool
+	Dryrun          bool
+	Stage           bool
+	Applystaged     bool
+	Rollback        bool
+	RollbackVersion string // empty for the newest backup
+	Keepbackups     int
+	Clearfailed     bool
+	Retrybudget     int
+	Retrybackoff    time.Duration
+	Legacyexitcodes bool
+	Service         bool
+	ServiceName     string
+	Interval        time.Duration
+	Jitter          time.Duration
+	MaxBackoff      time.Duration
+	Urlargs         string
+	Outputinfo      bool
+	OutputinfoLog   string
+	Format          string
+	Resultfile      string
+	Logfile         string
+	Loglevel        string
+	Logformat       string
+	LogMaxSize      int64
+	LogBackups      int
+	Eventlog        bool
+	Eventsource     string
+	Syslog          string
+	Reporturl       string
+	Reportqueue     string
+	Metricsfile     string
+	Healthgrace     time.Duration
+	Healthtimeout   time.Duration
+	Healthurl       string
+	Healthpipe      string
+	Statefile       string
+	Cdata           string
+	Stagedir        string
+	WYSTestServer   string // Used for testing
+	WYUTestServer   string // Used for testing
+
+	// Logger writes to Logfile. It isn't parsed, Handler sets it up from
+	// the logging arguments (see NewLoggerFromArgs).
+	Logger *Logger
+
+	// Events receives update events. It isn't parsed, Handler sets it up
+	// from the event arguments (see NewEventSinkFromArgs).
+	Events EventSink
+
+	// InstallDir is where updates are installed. It isn't parsed, the
+	// directory of the executable is used if it is empty.
+	InstallDir string
+
+	// HTTPClient downloads the update files. It isn't parsed, a client with
+	// the updater's timeouts is used if it is nil.
+	HTTPClient *http.Client
+
+	// Services stops and starts the services of an update. It isn't
+	// parsed, the system service manager is used if it is nil.
+	Services ServiceController
+
+	// Clock tells the time. It isn't parsed, the system clock is used if it
+	// is nil.
+	Clock Clock
+
+	// FS is the filesystem updates are downloaded, staged, backed up and
+	// installed on. It isn't parsed, the operating system's filesystem is
+	// used if it is nil.
+	FS FS
+}
+
+// instDir returns the install directory
+func (args Args) instDir() string {
+	if len(args.InstallDir) > 0 {
+		return args.InstallDir
+	}
+	return GetExeDir()
+}
+
+// services returns the service controller
+func (args Args) services() ServiceController {
+	if args.Services != nil {
+		return args.Services
+	}
+	return SystemServices{}
+}
+
+// clock returns the clock
+func (args Args) clock() Clock {
+	if args.Clock != nil {
+		return args.Clock
+	}
+	return systemClock{}
+}
+
+// fs returns the filesystem
+func (args Args) fs() FS {
+	return fsOrOS(args.FS)
+}
+
+// setDefaultPaths sets the file locations that weren't given to their
+// defaults in the install directory
+func (args *Args) setDefaultPaths() {
+	dir := args.instDir()
+	defaults := []struct {
+		path *string
+		name string
+	}{
+		{&args.Cdata, CLIENT_WYC},
+		{&args.Stagedir, STAGING_DIR_NAME},
+		{&args.Reportqueue, REPORT_QUEUE_DIR_NAME},
+		{&args.Statefile, METRICS_STATE_FILE_NAME},
+	}
+	for _, d := range defaults {
+		if len(*d.path) == 0 {
+			*d.path = filepath.Join(dir, d.name)
+		}
+	}
 }
 
 var argRegexp *regexp.Regexp = regexp.MustCompile(`^/`)
 
 // ParseArgs returns a struct with the parsed command-line arguments
 func ParseArgs(argsSlice []string) (args Args, err error) {
+	args, err = parseArgs(argsSlice)
+	args.setDefaultPaths()
+	return args, err
+}
+
+// defaultArgs returns the defaults of the command-line arguments. The file
+// locations are left empty, they default to the install directory.
+func defaultArgs() Args {
+	args, _ := parseArgs([]string{""})
+	return args
+}
+
+// parseArgs does the parsing for ParseArgs, without the default file
+// locations
+func parseArgs(argsSlice []string) (args Args, err error) {
 	// remove the program argument
 	argsSlice = argsSlice[1:]
 
 	fs := flag.NewFlagSet("win-service-updater", flag.ContinueOnError)
 	fs.SetOutput(ioutil.Discard)
 
-	// translate windows-style command line args to the normal
-	// Golang style (- in the front as opposed to /)
-	normalizedArgs := make([]string, 0, len(argsSlice))
-	for _, arg := range argsSlice {
-		normalizedArgs = append(normalizedArgs, argRegexp.ReplaceAllLiteralString(strings.ToLower(arg), "-"))
-	}
-
 	// debug := fs.Bool("debug", false, "Whether or not to log debug messages")
 	fs.BoolVar(&args.Debug, "debug", false, "Whether or not to run as debug")
 	fs.BoolVar(&args.Quickcheck, "quickcheck", false, "Whether or not to run a quickcheck")
 	fs.BoolVar(&args.Justcheck, "justcheck", false, "Whether or not to run a justcheck")
 	fs.BoolVar(&args.Noerr, "noerr", false, "Whether or not to error")
 	fs.BoolVar(&args.Fromservice, "fromservice", false, "Whether or not to run from a service")
+	fs.BoolVar(&args.Dryrun, "dryrun", false, "Download and verify the update and print what installing it would do, without installing it")
+	fs.BoolVar(&args.Stage, "stage", false, "Download and verify an update without installing it")
+	fs.BoolVar(&args.Applystaged, "applystaged", false, "Install a previously staged update")
+	fs.Var(rollbackFlag{&args}, "rollback", "Restore a previous version (/rollback, /rollback=version or /rollback version)")
+	fs.IntVar(&args.Keepbackups, "keepbackups", DEFAULT_KEEP_BACKUPS, "Number of previous versions to keep for /rollback")
+	fs.BoolVar(&args.Clearfailed, "clearfailed", false, "Remove the failed install sentinel so the failed update is tried again")
+	fs.IntVar(&args.Retrybudget, "retrybudget", DEFAULT_RETRY_BUDGET, "Number of times an update that failed to install is retried")
+	fs.DurationVar(&args.Retrybackoff, "retrybackoff", DEFAULT_RETRY_BACKOFF, "Time to wait before retrying an update that failed to install, doubled after each failure")
+	fs.BoolVar(&args.Legacyexitcodes, "legacyexitcodes", false, "Exit with the wyUpdate exit codes (1 for every error)")
+	fs.BoolVar(&args.Service, "service", false, "Run as a long-running service that checks for updates")
+	fs.StringVar(&args.ServiceName, "servicename", useragent.WSUpdaterServiceName, "Name of the Windows service")
+	fs.DurationVar(&args.Interval, "interval", DEFAULT_CHECK_INTERVAL, "Time between update checks")
+	fs.DurationVar(&args.Jitter, "jitter", DEFAULT_CHECK_JITTER, "Maximum random delay added to each update check")
+	fs.DurationVar(&args.MaxBackoff, "maxbackoff", DEFAULT_MAX_BACKOFF, "Maximum time between update checks after failures")
 	fs.StringVar(&args.Urlargs, "urlargs", "", "Additonal string to add onto the URL")
 	fs.StringVar(&args.Logfile, "logfile", "", "Name of log file")
+	fs.StringVar(&args.Loglevel, "loglevel", LOG_INFO.String(), "Minimum level logged (debug, info, warn or error)")
+	fs.StringVar(&args.Logformat, "logformat", FORMAT_TEXT, "Log file format (text or json)")
+	fs.Int64Var(&args.LogMaxSize, "logmaxsize", DEFAULT_LOG_MAX_SIZE, "Rotate the log file when it reaches this size in bytes (0 disables rotation)")
+	fs.IntVar(&args.LogBackups, "logbackups", DEFAULT_LOG_BACKUPS, "Number of rotated log files to keep")
+	fs.BoolVar(&args.Eventlog, "eventlog", false, "Write update events to the Windows Application event log")
+	fs.StringVar(&args.Eventsource, "eventsource", DEFAULT_EVENT_SOURCE, "Event log source name")
+	fs.StringVar(&args.Syslog, "syslog", "", "Send update events to a syslog collector (udp://host:port or tcp://host:port)")
 	fs.StringVar(&args.OutputinfoLog, "outputinfo", "", "Output info")
-	// default to client.wyc
-	fs.StringVar(&args.Cdata, "cdata", filepath.Join(GetExeDir(), CLIENT_WYC), "Config data")
+	fs.StringVar(&args.Format, "format", FORMAT_TEXT, "Output info format (text or json)")
+	fs.StringVar(&args.Resultfile, "resultfile", "", "File to write the JSON result to")
+	// the file locations default to the install directory (see setDefaultPaths)
+	fs.StringVar(&args.Cdata, "cdata", "", "Config data")
+	fs.StringVar(&args.Stagedir, "stagedir", "", "Staging directory, on the volume of the install dir")
+	fs.StringVar(&args.Reporturl, "reporturl", "", "URL to POST status reports to (overrides the WYC file)")
+	fs.StringVar(&args.Reportqueue, "reportqueue", "", "Directory of reports waiting to be sent")
+	fs.DurationVar(&args.Healthgrace, "healthgrace", DEFAULT_HEALTH_GRACE, "Time to wait after starting the services before verifying the update")
+	fs.DurationVar(&args.Healthtimeout, "healthtimeout", DEFAULT_HEALTH_TIMEOUT, "How long the health URL and pipe have to respond")
+	fs.StringVar(&args.Healthurl, "healthurl", "", "Local URL that must respond with a 2xx status after an update")
+	fs.StringVar(&args.Healthpipe, "healthpipe", "", "Named pipe that must accept a connection after an update")
+	fs.StringVar(&args.Metricsfile, "metricsfile", "", "File to write OpenMetrics text to after each run")
+	fs.StringVar(&args.Statefile, "statefile", "", "File to keep the state used for metrics in")
 	// TODO: These overrides should only be available in a debug build, not in what gets shipped in production
 	fs.StringVar(&args.WYSTestServer, "wysserver", "", "WYS Server")
 	fs.StringVar(&args.WYUTestServer, "wyuserver", "", "WYU Server")
 
+	normalizedArgs := make([]string, 0, len(argsSlice))
+	for _, arg := range argsSlice {
+		normalizedArgs = append(normalizedArgs, normalizeArg(fs, arg))
+	}
+
 	err = fs.Parse(normalizedArgs)
 	if err != nil {
 		return args, err
 	}
+	args.Format = strings.ToLower(args.Format)
+	args.Logformat = strings.ToLower(args.Logformat)
+	args.Loglevel = strings.ToLower(args.Loglevel)
+
+	// the version may follow a bare /rollback, parsing stops at it
+	if args.Rollback && len(args.RollbackVersion) == 0 && fs.NArg() > 0 {
+		args.RollbackVersion = fs.Arg(0)
+		err = fs.Parse(fs.Args()[1:])
+		if err != nil {
+			return args, err
+		}
+	}
+
+	if args.Format != FORMAT_TEXT && args.Format != FORMAT_JSON {
+		return args, fmt.Errorf("unknown output format: %s", args.Format)
+	}
+
+	if args.Logformat != FORMAT_TEXT && args.Logformat != FORMAT_JSON {
+		return args, fmt.Errorf("unknown log format: %s", args.Logformat)
+	}
+
+	if _, err := ParseLogLevel(args.Loglevel); err != nil {
+		return args, err
+	}
+
+	if args.Keepbackups < 0 {
+		return args, fmt.Errorf("invalid number of backups to keep: %d", args.Keepbackups)
+	}
+
+	if args.Retrybudget < 0 {
+		return args, fmt.Errorf("invalid retry budget: %d", args.Retrybudget)
+	}
+
+	// an interval of 0 would check for updates in a tight loop
+	if args.Interval <= 0 {
+		return args, fmt.Errorf("invalid check interval: %v", args.Interval)
+	}
+
+	if args.Jitter < 0 {
+		return args, fmt.Errorf("invalid check jitter: %v", args.Jitter)
+	}
+
+	if args.MaxBackoff < 0 {
+		return args, fmt.Errorf("invalid maximum backoff: %v", args.MaxBackoff)
+	}
 
 	// check to see if outputinfo was set. If so set outputinfo
 	// bool to true
@@ -79,3 +285,58 @@ func ParseArgs(argsSlice []string) (args Args, err error) {
 
 	return args, nil
 }
+
+// normalizeArg translates a windows-style command line arg to the normal
+// Golang style (- in the front as opposed to /) and lowercases the flag
+// name. String values, e.g., URLs and paths, are kept as given, the values
+// of the other flags (booleans, numbers and durations) are lowercased.
+func normalizeArg(fs *flag.FlagSet, arg string) string {
+	arg = argRegexp.ReplaceAllLiteralString(arg, "-")
+	if !strings.HasPrefix(arg, "-") {
+		return arg
+	}
+
+	name, value, ok := strings.Cut(arg, "=")
+	name = strings.ToLower(name)
+	if !ok {
+		return name
+	}
+	if f := fs.Lookup(strings.TrimLeft(name, "-")); f != nil {
+		if getter, ok := f.Value.(flag.Getter); ok {
+			if _, ok := getter.Get().(string); !ok {
+				value = strings.ToLower(value)
+			}
+		}
+	}
+	return name + "=" + value
+}
+
+// rollbackFlag is the /rollback flag, it may be given alone (the newest
+// backup) or with a version
+type rollbackFlag struct {
+	args *Args
+}
+
+func (f rollbackFlag) String() string {
+	if f.args == nil {
+		return ""
+	}
+	return f.args.RollbackVersion
+}
+
+func (f rollbackFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (f rollbackFlag) Set(s string) error {
+	switch s {
+	case "true":
+		f.args.Rollback = true
+	case "false":
+		f.args.Rollback = false
+	default:
+		f.args.Rollback = true
+		f.args.RollbackVersion = s
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package updater
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -29,4 +30,119 @@ func TestArgs(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, args.Fromservice)
 	assert.True(t, args.Quickcheck)
+
+	argv = []string{"win_service_updater.exe", "/justcheck", "-format=json", "-resultfile=foo"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.Equal(t, FORMAT_JSON, args.Format)
+	assert.Equal(t, "foo", args.Resultfile)
+
+	// flag names and the values of booleans, numbers, durations and formats
+	// are case-insensitive, URLs and paths are kept as given
+	argv = []string{"win_service_updater.exe", "/JustCheck", "-Format=JSON", "-interval=1H", "-noerr=TRUE",
+		"-reporturl=https://Reports.example.com/Hook?token=AbC123", "-healthurl=http://localhost:8080/Health",
+		"-healthpipe=\\\\.\\pipe\\WidgetHealth", "-syslog=udp://LogHost:514", "-eventsource=WidgetUpdater",
+		"-statefile=C:\\Widget\\State.json", "-metricsfile=/var/lib/Widget/metrics.prom"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.True(t, args.Justcheck)
+	assert.True(t, args.Noerr)
+	assert.Equal(t, FORMAT_JSON, args.Format)
+	assert.Equal(t, time.Hour, args.Interval)
+	assert.Equal(t, "https://Reports.example.com/Hook?token=AbC123", args.Reporturl)
+	assert.Equal(t, "http://localhost:8080/Health", args.Healthurl)
+	assert.Equal(t, `\\.\pipe\WidgetHealth`, args.Healthpipe)
+	assert.Equal(t, "udp://LogHost:514", args.Syslog)
+	assert.Equal(t, "WidgetUpdater", args.Eventsource)
+	assert.Equal(t, `C:\Widget\State.json`, args.Statefile)
+	assert.Equal(t, "/var/lib/Widget/metrics.prom", args.Metricsfile)
+
+	argv = []string{"win_service_updater.exe", "/justcheck", "-format=xml"}
+	args, err = ParseArgs(argv)
+	assert.NotNil(t, err)
+
+	argv = []string{"win_service_updater.exe", "/fromservice", "-loglevel=DEBUG", "-logformat=json", "-logmaxsize=1024", "-logbackups=5"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.Equal(t, "debug", args.Loglevel)
+	assert.Equal(t, FORMAT_JSON, args.Logformat)
+	assert.Equal(t, int64(1024), args.LogMaxSize)
+	assert.Equal(t, 5, args.LogBackups)
+
+	argv = []string{"win_service_updater.exe", "/fromservice", "-loglevel=loud"}
+	args, err = ParseArgs(argv)
+	assert.NotNil(t, err)
+
+	argv = []string{"win_service_updater.exe", "/rollback"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.True(t, args.Rollback)
+	assert.Equal(t, "", args.RollbackVersion)
+	assert.Equal(t, DEFAULT_KEEP_BACKUPS, args.Keepbackups)
+
+	argv = []string{"win_service_updater.exe", "/rollback=1.0.0", "-keepbackups=1"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.True(t, args.Rollback)
+	assert.Equal(t, "1.0.0", args.RollbackVersion)
+	assert.Equal(t, 1, args.Keepbackups)
+
+	argv = []string{"win_service_updater.exe", "/rollback", "1.0.0", "-cdata=foo"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.True(t, args.Rollback)
+	assert.Equal(t, "1.0.0", args.RollbackVersion)
+	assert.Equal(t, "foo", args.Cdata)
+
+	argv = []string{"win_service_updater.exe", "/fromservice", "-keepbackups=-1"}
+	args, err = ParseArgs(argv)
+	assert.NotNil(t, err)
+
+	argv = []string{"win_service_updater.exe", "/dryrun", "-format=json"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.True(t, args.Dryrun)
+	assert.Equal(t, FORMAT_JSON, args.Format)
+
+	argv = []string{"win_service_updater.exe", "/clearfailed"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.True(t, args.Clearfailed)
+	assert.Equal(t, DEFAULT_RETRY_BUDGET, args.Retrybudget)
+	assert.Equal(t, DEFAULT_RETRY_BACKOFF, args.Retrybackoff)
+
+	argv = []string{"win_service_updater.exe", "/fromservice", "-retrybudget=0", "-retrybackoff=30m"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, args.Retrybudget)
+	assert.Equal(t, 30*time.Minute, args.Retrybackoff)
+
+	argv = []string{"win_service_updater.exe", "/fromservice", "-legacyexitcodes"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.True(t, args.Legacyexitcodes)
+
+	argv = []string{"win_service_updater.exe", "/fromservice", "-retrybudget=-1"}
+	args, err = ParseArgs(argv)
+	assert.NotNil(t, err)
+	for _, arg := range []string{"-interval=0", "-interval=-1h", "-jitter=-1m", "-maxbackoff=-1h"} {
+		argv = []string{"win_service_updater.exe", "/service", arg}
+		args, err = ParseArgs(argv)
+		assert.NotNil(t, err, arg)
+	}
+
+	argv = []string{"win_service_updater.exe", "/service", "-jitter=0", "-maxbackoff=0"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+
+	// the services get time to crash before the update is verified
+	argv = []string{"win_service_updater.exe", "/fromservice"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.Equal(t, DEFAULT_HEALTH_GRACE, args.Healthgrace)
+
+	argv = []string{"win_service_updater.exe", "/fromservice", "-healthgrace=0"}
+	args, err = ParseArgs(argv)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), args.Healthgrace)
 }
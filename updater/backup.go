@@ -0,0 +1,337 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// DEFAULT_KEEP_BACKUPS is the number of previous versions kept on disk
+const DEFAULT_KEEP_BACKUPS = 3
+
+// backupFilesDir is the directory inside a backup with the replaced files
+const backupFilesDir = "files"
+
+// BackupManifest describes a versioned backup, the files an update replaced
+// and what is needed to put them back. Backups are kept in
+// <install dir>/BACKUPS_DIR_NAME/<version>.
+type BackupManifest struct {
+	Version         string    `json:"version"`     // the version backed up
+	ReplacedBy      string    `json:"replaced_by"` // the version installed over it
+	CreatedAt       time.Time `json:"created_at"`
+	Files           []string  `json:"files"`                 // files replaced by the update
+	AddedFiles      []string  `json:"added_files,omitempty"` // files added by the update
+	ServicesToStop  []string  `json:"services_to_stop,omitempty"`
+	ServicesToStart []string  `json:"services_to_start,omitempty"`
+
+	dir string
+}
+
+// Dir returns the directory of the backup
+func (b BackupManifest) Dir() string {
+	return b.dir
+}
+
+var unsafeVersionChars = regexp.MustCompile(`[^0-9A-Za-z._-]`)
+
+// backupDirName returns the directory name for the backup of `version`
+func backupDirName(version string) string {
+	name := unsafeVersionChars.ReplaceAllString(version, "_")
+	if len(strings.Trim(name, ".")) == 0 {
+		return "unknown"
+	}
+	return name
+}
+
+// newBackupDir returns the directory for a new backup of `version` in
+// `instDir`. An existing backup of the same version, e.g., one kept after a
+// failed rollback, is kept and the new backup gets a numbered directory.
+func newBackupDir(fsys FS, instDir string, version string) string {
+	base := filepath.Join(instDir, BACKUPS_DIR_NAME, backupDirName(version))
+	dir := base
+	for i := 2; pathExists(fsys, filepath.Join(dir, BACKUP_MANIFEST_FILE_NAME)); i++ {
+		dir = fmt.Sprintf("%s-%d", base, i)
+	}
+	return dir
+}
+
+// CreateBackup moves the files in `instDir` that `updates` will replace into
+// a new backup of `version` created at `createdAt`, along with a copy of the
+// WYC file. A previous backup of the same version is kept (see
+// newBackupDir). If the backup fails the moved files are put back.
+func CreateBackup(fsys FS, instDir string, wycFilePath string, version string, replacedBy string, updates []string, udt ConfigUDT, createdAt time.Time) (backup BackupManifest, err error) {
+	fsys = fsOrOS(fsys)
+	backup = BackupManifest{
+		Version:    version,
+		ReplacedBy: replacedBy,
+		CreatedAt:  createdAt.UTC(),
+		dir:        newBackupDir(fsys, instDir, version),
+	}
+	for _, s := range udt.ServiceToStopBeforeUpdate {
+		backup.ServicesToStop = append(backup.ServicesToStop, ValueToString(&s))
+	}
+	for _, s := range udt.ServiceToStartAfterUpdate {
+		backup.ServicesToStart = append(backup.ServicesToStart, ValueToString(&s))
+	}
+
+	// an incomplete backup, without a manifest, is left over from an
+	// update that was interrupted
+	if err := DeleteDirectory(fsys, backup.dir); err != nil {
+		return backup, fmt.Errorf("failed to remove incomplete backup %s; %w", backup.dir, err)
+	}
+	filesDir := filepath.Join(backup.dir, backupFilesDir)
+	if err := fsys.MkdirAll(filesDir, 0755); err != nil {
+		return backup, fmt.Errorf("failed to create backup dir %s; %w", filesDir, err)
+	}
+
+	defer func() {
+		if err != nil {
+			RollbackFiles(fsys, filesDir, instDir)
+			DeleteDirectory(fsys, backup.dir)
+		}
+	}()
+
+	if pathExists(fsys, wycFilePath) {
+		if _, err := CopyFile(fsys, wycFilePath, filepath.Join(backup.dir, CLIENT_WYC)); err != nil {
+			return backup, fmt.Errorf("failed to back up %s; %w", wycFilePath, err)
+		}
+	}
+
+	// backup the files we are about to update
+	for _, f := range updates {
+		name := filepath.Base(f)
+		orig := filepath.Join(instDir, name)
+		if !pathExists(fsys, orig) {
+			backup.AddedFiles = append(backup.AddedFiles, name)
+			continue
+		}
+
+		if err := MoveFile(fsys, orig, filepath.Join(filesDir, name)); err != nil {
+			return backup, err
+		}
+		backup.Files = append(backup.Files, name)
+	}
+
+	// the manifest is written last, a backup without one is incomplete
+	dat, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return backup, err
+	}
+	if err := writeFileAtomic(fsys, filepath.Join(backup.dir, BACKUP_MANIFEST_FILE_NAME), dat); err != nil {
+		return backup, fmt.Errorf("failed to write backup manifest; %w", err)
+	}
+
+	return backup, nil
+}
+
+// RestoreFiles puts the backed up files back into `instDir` and removes the
+// files the update added. The backup is used up, its files are moved.
+func (b BackupManifest) RestoreFiles(fsys FS, instDir string) error {
+	fsys = fsOrOS(fsys)
+	var errs *multierror.Error
+
+	if err := RollbackFiles(fsys, filepath.Join(b.dir, backupFilesDir), instDir); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	for _, name := range b.AddedFiles {
+		err := fsys.Remove(filepath.Join(instDir, name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// RestoreWYC copies the backed up WYC file to `wycFilePath`
+func (b BackupManifest) RestoreWYC(fsys FS, wycFilePath string) error {
+	backupWYC := filepath.Join(b.dir, CLIENT_WYC)
+	if !pathExists(fsys, backupWYC) {
+		return nil
+	}
+	_, err := CopyFile(fsys, backupWYC, wycFilePath)
+	return err
+}
+
+// ListBackups returns the complete backups in `instDir`, newest first
+func ListBackups(fsys FS, instDir string) ([]BackupManifest, error) {
+	fsys = fsOrOS(fsys)
+	dir := filepath.Join(instDir, BACKUPS_DIR_NAME)
+	entries, err := fsys.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []BackupManifest
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		backupDir := filepath.Join(dir, e.Name())
+		dat, err := fsys.ReadFile(filepath.Join(backupDir, BACKUP_MANIFEST_FILE_NAME))
+		if err != nil {
+			// incomplete
+			continue
+		}
+
+		var backup BackupManifest
+		if err := json.Unmarshal(dat, &backup); err != nil {
+			continue
+		}
+		backup.dir = backupDir
+		backups = append(backups, backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// PruneBackups deletes all but the newest `keep` backups in `instDir`
+func PruneBackups(fsys FS, instDir string, keep int) error {
+	backups, err := ListBackups(fsys, instDir)
+	if err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	for i := keep; i < len(backups); i++ {
+		if err := DeleteDirectory(fsys, backups[i].dir); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// RollbackHandler restores the backup of a previous version (args.RollbackVersion,
+// or the newest backup if no version is given). Returns int exit code and
+// error.
+func RollbackHandler(args Args) (int, error) {
+	var result Result
+	return rollback(args, args.instDir(), &result)
+}
+
+// rollback restores the backups from the newest back to the requested
+// version, filling in the details in `result`. The services are stopped
+// before and started after the files are restored, like an update.
+func rollback(args Args, instDir string, result *Result) (int, error) {
+	fsys := args.fs()
+	backups, err := ListBackups(fsys, instDir)
+	if err != nil {
+		return EXIT_ERROR, withError(ErrConfig, err)
+	}
+	if len(backups) == 0 {
+		err = fmt.Errorf("no backups found in %s", filepath.Join(instDir, BACKUPS_DIR_NAME))
+		return EXIT_ERROR, withError(ErrConfig, err)
+	}
+
+	if iuc, err := (Info{FS: args.FS}).ParseWYC(args.Cdata); err == nil {
+		result.InstalledVersion = string(iuc.IucInstalledVersion.Value)
+	}
+
+	// each backup undoes one update, so every backup newer than the
+	// requested one has to be restored too
+	target := 0
+	if len(args.RollbackVersion) > 0 {
+		target = -1
+		var versions []string
+		for i, b := range backups {
+			versions = append(versions, b.Version)
+			if b.Version == args.RollbackVersion {
+				target = i
+				break
+			}
+		}
+		if target < 0 {
+			err = fmt.Errorf("no backup of version %s, available versions: %s", args.RollbackVersion, strings.Join(versions, ", "))
+			return EXIT_ERROR, withError(ErrConfig, err)
+		}
+	}
+	chain := backups[:target+1]
+	result.AvailableVersion = chain[len(chain)-1].Version
+
+	args.Logger.Infof("Rolling back to version %s", result.AvailableVersion)
+	result.Phase = PHASE_INSTALL
+
+	var udt ConfigUDT
+	for _, b := range chain {
+		for _, s := range b.ServicesToStop {
+			udt.ServiceToStopBeforeUpdate = append(udt.ServiceToStopBeforeUpdate, serviceTLV(s))
+		}
+	}
+	stopServices(args, udt)
+
+	// a backup that isn't fully restored is kept, it has the only copy of
+	// the files that weren't restored
+	var errs *multierror.Error
+	failed := make(map[string]bool)
+	for _, b := range chain {
+		args.Logger.Infof("Restoring version %s", b.Version)
+		if err := b.RestoreFiles(fsys, instDir); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to restore version %s, the backup is kept in %s; %w", b.Version, b.dir, err))
+			failed[b.dir] = true
+		}
+	}
+
+	oldest := chain[len(chain)-1]
+	if err := oldest.RestoreWYC(fsys, args.Cdata); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("failed to restore %s, the backup is kept in %s; %w", args.Cdata, oldest.dir, err))
+		failed[oldest.dir] = true
+	}
+
+	// the services of the restored version
+	var started []string
+	for _, s := range oldest.ServicesToStart {
+		if exists, _ := args.services().DoesServiceExist(s); !exists {
+			continue
+		}
+		if err := args.services().StartService(context.Background(), s, args.Logger); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to start %s; %w", s, err))
+			continue
+		}
+		started = append(started, s)
+	}
+
+	// the restored backups have been used up
+	for _, b := range chain {
+		if failed[b.dir] {
+			result.KeptBackups = append(result.KeptBackups, b.dir)
+			continue
+		}
+		DeleteDirectory(fsys, b.dir)
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		result.Rollback = ROLLBACK_FAILED
+		emitEvent(args, EVENT_ROLLBACK_PERFORMED, "rolled back to version %s with errors; %v", result.AvailableVersion, err)
+		return EXIT_ERROR, withError(ErrRollbackFailed, err)
+	}
+
+	result.Rollback = ROLLBACK_SUCCEEDED
+	result.Phase = PHASE_COMPLETE
+	emitEvent(args, EVENT_ROLLBACK_PERFORMED, "rolled back to version %s", result.AvailableVersion)
+	if len(started) > 0 {
+		emitEvent(args, EVENT_SERVICES_RESTARTED, "restarted services after rollback: %s", strings.Join(started, ", "))
+	}
+	return EXIT_SUCCESS, nil
+}
+
+// serviceTLV returns a service name as it appears in a ConfigUDT
+func serviceTLV(name string) TLV {
+	return TLV{Value: []byte(name), Length: uint32(len(name))}
+}
@@ -0,0 +1,231 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// backupTestUpdate creates a backup of `version` in `instDir` for an update
+// that replaces widget.txt and adds `added`, then installs the new files
+func backupTestUpdate(t *testing.T, instDir string, wycFile string, version string, newVersion string, added string) BackupManifest {
+	srcDir := t.TempDir()
+	updates := []string{filepath.Join(srcDir, "widget.txt"), filepath.Join(srcDir, added)}
+	for _, f := range updates {
+		assert.Nil(t, os.WriteFile(f, []byte(newVersion), 0644))
+	}
+
+	backup, err := CreateBackup(OSFS{}, instDir, wycFile, version, newVersion, updates, ConfigUDT{}, time.Now())
+	assert.Nil(t, err)
+	assert.Nil(t, InstallUpdate(context.Background(), OSFS{}, ConfigUDT{}, updates, instDir, nil, nil))
+	assert.Nil(t, os.WriteFile(wycFile, []byte(newVersion), 0644))
+	return backup
+}
+
+func readTestFile(t *testing.T, path string) string {
+	dat, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	return string(dat)
+}
+
+func TestBackup_CreateBackup(t *testing.T) {
+	instDir := t.TempDir()
+	wycFile := filepath.Join(instDir, CLIENT_WYC)
+	assert.Nil(t, os.WriteFile(wycFile, []byte("1.0.0"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(instDir, "widget.txt"), []byte("1.0.0"), 0644))
+
+	backup := backupTestUpdate(t, instDir, wycFile, "1.0.0", "1.0.1", "new.txt")
+	assert.Equal(t, filepath.Join(instDir, BACKUPS_DIR_NAME, "1.0.0"), backup.Dir())
+	assert.Equal(t, []string{"widget.txt"}, backup.Files)
+	assert.Equal(t, []string{"new.txt"}, backup.AddedFiles)
+	assert.Equal(t, "1.0.0", readTestFile(t, filepath.Join(backup.Dir(), CLIENT_WYC)))
+	assert.Equal(t, "1.0.0", readTestFile(t, filepath.Join(backup.Dir(), backupFilesDir, "widget.txt")))
+
+	backups, err := ListBackups(OSFS{}, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(backups))
+	assert.Equal(t, "1.0.0", backups[0].Version)
+	assert.Equal(t, "1.0.1", backups[0].ReplacedBy)
+
+	// restoring puts back the old file and removes the new one
+	assert.Nil(t, backups[0].RestoreFiles(OSFS{}, instDir))
+	assert.Nil(t, backups[0].RestoreWYC(OSFS{}, wycFile))
+	assert.Equal(t, "1.0.0", readTestFile(t, filepath.Join(instDir, "widget.txt")))
+	assert.False(t, fileExists(filepath.Join(instDir, "new.txt")))
+	assert.Equal(t, "1.0.0", readTestFile(t, wycFile))
+}
+
+func TestBackup_CreateBackup_existing(t *testing.T) {
+	instDir := t.TempDir()
+	wycFile := filepath.Join(instDir, CLIENT_WYC)
+	assert.Nil(t, os.WriteFile(wycFile, []byte("1.0.0"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(instDir, "widget.txt"), []byte("1.0.0"), 0644))
+	first := backupTestUpdate(t, instDir, wycFile, "1.0.0", "1.0.1", "new.txt")
+
+	// e.g., the first backup was kept after a failed rollback
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	srcDir := t.TempDir()
+	updates := []string{filepath.Join(srcDir, "widget.txt")}
+	assert.Nil(t, os.WriteFile(updates[0], []byte("1.0.1"), 0644))
+	second, err := CreateBackup(OSFS{}, instDir, wycFile, "1.0.0", "1.0.1", updates, ConfigUDT{}, createdAt)
+	assert.Nil(t, err)
+	assert.Equal(t, first.Dir()+"-2", second.Dir())
+	assert.Equal(t, createdAt, second.CreatedAt)
+
+	backups, err := ListBackups(OSFS{}, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(backups))
+	assert.Equal(t, "1.0.0", readTestFile(t, filepath.Join(first.Dir(), backupFilesDir, "widget.txt")))
+}
+
+func TestBackup_backupDirName(t *testing.T) {
+	assert.Equal(t, "1.0.0.1", backupDirName("1.0.0.1"))
+	assert.Equal(t, "unknown", backupDirName(""))
+	assert.Equal(t, "unknown", backupDirName(".."))
+	assert.Equal(t, ".._foo", backupDirName("../foo"))
+}
+
+func TestBackup_ListBackups_incomplete(t *testing.T) {
+	instDir := t.TempDir()
+
+	backups, err := ListBackups(OSFS{}, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(backups))
+
+	// no manifest
+	assert.Nil(t, os.MkdirAll(filepath.Join(instDir, BACKUPS_DIR_NAME, "1.0.0"), 0755))
+	backups, err = ListBackups(OSFS{}, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(backups))
+}
+
+func TestBackup_PruneBackups(t *testing.T) {
+	instDir := t.TempDir()
+	wycFile := filepath.Join(instDir, CLIENT_WYC)
+
+	for _, v := range []string{"1.0.0", "1.0.1", "1.0.2"} {
+		backupTestUpdate(t, instDir, wycFile, v, v+"-next", "new.txt")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Nil(t, PruneBackups(OSFS{}, instDir, 2))
+	backups, err := ListBackups(OSFS{}, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(backups))
+	assert.Equal(t, "1.0.2", backups[0].Version)
+	assert.Equal(t, "1.0.1", backups[1].Version)
+}
+
+func TestBackup_rollback(t *testing.T) {
+	instDir := t.TempDir()
+	wycFile := filepath.Join(instDir, CLIENT_WYC)
+	assert.Nil(t, os.WriteFile(wycFile, []byte("1.0.0"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(instDir, "widget.txt"), []byte("1.0.0"), 0644))
+
+	backupTestUpdate(t, instDir, wycFile, "1.0.0", "1.0.1", "a.txt")
+	time.Sleep(10 * time.Millisecond)
+	backupTestUpdate(t, instDir, wycFile, "1.0.1", "1.0.2", "b.txt")
+	assert.Equal(t, "1.0.2", readTestFile(t, filepath.Join(instDir, "widget.txt")))
+
+	events := &MemorySink{}
+	var args Args
+	args.Cdata = wycFile
+	args.Events = events
+
+	// there is no backup of the installed version
+	args.RollbackVersion = "1.0.2"
+	var result Result
+	rc, err := rollback(args, instDir, &result)
+	assert.Equal(t, EXIT_ERROR, rc)
+	assert.Equal(t, ERROR_CLASS_CONFIG, ErrorClass(err))
+
+	// both updates are undone
+	args.RollbackVersion = "1.0.0"
+	result = Result{}
+	rc, err = rollback(args, instDir, &result)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, rc)
+	assert.Equal(t, "1.0.0", result.AvailableVersion)
+	assert.Equal(t, ROLLBACK_SUCCEEDED, result.Rollback)
+	assert.Equal(t, "1.0.0", readTestFile(t, filepath.Join(instDir, "widget.txt")))
+	assert.Equal(t, "1.0.0", readTestFile(t, wycFile))
+	assert.False(t, fileExists(filepath.Join(instDir, "a.txt")))
+	assert.False(t, fileExists(filepath.Join(instDir, "b.txt")))
+	assert.Equal(t, []EventType{EVENT_ROLLBACK_PERFORMED}, events.Types())
+
+	// the backups are used up
+	backups, err := ListBackups(OSFS{}, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(backups))
+
+	rc, err = rollback(args, instDir, &result)
+	assert.Equal(t, EXIT_ERROR, rc)
+	assert.NotNil(t, err)
+}
+
+func TestBackup_rollback_newest(t *testing.T) {
+	instDir := t.TempDir()
+	wycFile := filepath.Join(instDir, CLIENT_WYC)
+	assert.Nil(t, os.WriteFile(filepath.Join(instDir, "widget.txt"), []byte("1.0.0"), 0644))
+
+	backupTestUpdate(t, instDir, wycFile, "1.0.0", "1.0.1", "a.txt")
+	time.Sleep(10 * time.Millisecond)
+	backupTestUpdate(t, instDir, wycFile, "1.0.1", "1.0.2", "b.txt")
+
+	var args Args
+	args.Cdata = wycFile
+	var result Result
+	rc, err := rollback(args, instDir, &result)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, rc)
+	assert.Equal(t, "1.0.1", result.AvailableVersion)
+	assert.Equal(t, "1.0.1", readTestFile(t, filepath.Join(instDir, "widget.txt")))
+	assert.Equal(t, "1.0.1", readTestFile(t, wycFile))
+	assert.True(t, fileExists(filepath.Join(instDir, "a.txt")))
+	assert.False(t, fileExists(filepath.Join(instDir, "b.txt")))
+
+	// the older backup is kept
+	backups, err := ListBackups(OSFS{}, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(backups))
+	assert.Equal(t, "1.0.0", backups[0].Version)
+}
+
+func TestBackup_rollback_restoreFailed(t *testing.T) {
+	m := NewMemFS()
+	instDir := filepath.Join(string(filepath.Separator), "widget")
+	wycFile := filepath.Join(instDir, CLIENT_WYC)
+	assert.Nil(t, m.MkdirAll(instDir, 0755))
+	assert.Nil(t, m.WriteFile(wycFile, []byte("1.0.0"), 0644))
+	assert.Nil(t, m.WriteFile(filepath.Join(instDir, "widget.txt"), []byte("1.0.0"), 0644))
+	assert.Nil(t, m.MkdirAll(filepath.Join(string(filepath.Separator), "src"), 0755))
+	updates := []string{filepath.Join(string(filepath.Separator), "src", "widget.txt")}
+	assert.Nil(t, m.WriteFile(updates[0], []byte("1.0.1"), 0644))
+
+	backup, err := CreateBackup(m, instDir, wycFile, "1.0.0", "1.0.1", updates, ConfigUDT{}, time.Now())
+	assert.Nil(t, err)
+	assert.Nil(t, InstallUpdate(context.Background(), m, ConfigUDT{}, updates, instDir, nil, nil))
+
+	// the backed up file can't be put back
+	m.FailOp(FS_OP_RENAME, filepath.Join(backup.Dir(), backupFilesDir, "widget.txt"), syscall.EACCES)
+	args := Args{Cdata: wycFile, FS: m}
+	var result Result
+	rc, err := rollback(args, instDir, &result)
+	assert.Equal(t, EXIT_ERROR, rc)
+	assert.True(t, errors.Is(err, ErrRollbackFailed))
+	assert.Contains(t, err.Error(), backup.Dir())
+	assert.Equal(t, ROLLBACK_FAILED, result.Rollback)
+	assert.Equal(t, []string{backup.Dir()}, result.KeptBackups)
+
+	// the backup is kept
+	assert.Equal(t, "1.0.0", readMemFile(t, m, filepath.Join(backup.Dir(), backupFilesDir, "widget.txt")))
+	backups, err := ListBackups(m, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(backups))
+}
@@ -1,11 +1,32 @@
 package updater
 
+import "time"
+
 // Default file names
 const (
-	CLIENT_WYC                            = "client.wyc"
-	IUCLIENT_IUC                          = "iuclient.iuc"    // inside client.wyc
-	UPDTDETAILS_UDT                       = "updtdetails.udt" // inside .wyu archive
-	INSTALL_FAILED_SENTINAL_WYS_FILE_NAME = "failed_install.wys"
+	CLIENT_WYC                             = "client.wyc"
+	IUCLIENT_IUC                           = "iuclient.iuc"    // inside client.wyc
+	UPDTDETAILS_UDT                        = "updtdetails.udt" // inside .wyu archive
+	HOOKS_MANIFEST_FILE_NAME               = "hooks.json"      // inside .wyu archive
+	HOOKS_DIR_NAME                         = "hooks"           // inside .wyu archive
+	INSTALL_FAILED_SENTINAL_WYS_FILE_NAME  = "failed_install.wys"
+	INSTALL_FAILED_SENTINAL_INFO_FILE_NAME = "failed_install.json" // reason and attempts of the failed install
+	STAGING_DIR_NAME                       = "staged_update"
+	STAGING_MANIFEST_FILE_NAME             = "manifest.json" // inside the staging dir
+	SERVICE_LOCK_FILE_NAME                 = "updater_service.lock"
+	UPDATE_LOCK_FILE_NAME                  = "updater.lock"
+	REPORT_URL_FILE_NAME                   = "reporturl.txt" // inside client.wyc
+	REPORT_QUEUE_DIR_NAME                  = "report_queue"
+	METRICS_STATE_FILE_NAME                = "updater_state.json"
+	BACKUPS_DIR_NAME                       = "backups"
+	BACKUP_MANIFEST_FILE_NAME              = "backup.json" // inside each backup
+)
+
+// Service mode defaults
+const (
+	DEFAULT_CHECK_INTERVAL = 4 * time.Hour
+	DEFAULT_CHECK_JITTER   = 15 * time.Minute
+	DEFAULT_MAX_BACKOFF    = 24 * time.Hour
 )
 
 // File headers
@@ -17,8 +38,26 @@ const (
 
 // Exit codes
 const (
-	EXIT_SUCCESS          = 0
-	EXIT_NO_UPDATE        = 0
-	EXIT_ERROR            = 1
-	EXIT_UPDATE_AVALIABLE = 2
+	EXIT_SUCCESS            = 0
+	EXIT_NO_UPDATE          = 0
+	EXIT_ERROR              = 1 // any error with -legacyexitcodes, otherwise an unexpected error
+	EXIT_UPDATE_AVALIABLE   = 2
+	EXIT_UPDATE_IN_PROGRESS = 3
+)
+
+// Exit codes of the typed errors (see ExitCode). Nothing was changed by
+// the errors in the 10s, the errors in the 20s happened while installing.
+const (
+	EXIT_CONFIG          = 10
+	EXIT_NETWORK         = 11
+	EXIT_VERIFICATION    = 12
+	EXIT_SIGNATURE       = 13
+	EXIT_CHECKSUM        = 14
+	EXIT_FAILED_BEFORE   = 15
+	EXIT_INSTALL         = 20 // rolled back
+	EXIT_SERVICE_CONTROL = 21 // rolled back
+	EXIT_HEALTH_CHECK    = 22 // rolled back
+	EXIT_HOOK            = 23 // rolled back if anything was installed
+	EXIT_ROLLBACK_FAILED = 24
+	EXIT_CANCELLED       = 25 // rolled back if anything was installed
 )
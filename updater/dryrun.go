@@ -0,0 +1,186 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InstallPlan is what installing an update would do, worked out by a dry
+// run (/dryrun) without changing anything
+type InstallPlan struct {
+	InstallDir       string   `json:"install_dir"`
+	InstalledVersion string   `json:"installed_version"`
+	Version          string   `json:"version"` // written to WYCFile once installed
+	WYCFile          string   `json:"wyc_file"`
+	PreInstallHooks  []string `json:"pre_install_hooks,omitempty"`
+	Add              []string `json:"add"`     // new files
+	Replace          []string `json:"replace"` // existing files, they are backed up first
+	BackupDir        string   `json:"backup_dir"`
+	Backup           []string `json:"backup"` // the replaced files and the WYC file
+	ServicesToStop   []string `json:"services_to_stop"`
+	ServicesToStart  []string `json:"services_to_start"`
+	// MissingServices aren't installed, they aren't stopped or started
+	MissingServices  []string `json:"missing_services,omitempty"`
+	PostInstallHooks []string `json:"post_install_hooks,omitempty"`
+}
+
+// String returns the plan as text, in the order the steps are taken
+func (p InstallPlan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dry run: update %s from version %s to %s\n", p.InstallDir, p.InstalledVersion, p.Version)
+	step := func(name string, values []string) {
+		if len(values) > 0 {
+			fmt.Fprintf(&b, "%s: %s\n", name, strings.Join(values, ", "))
+		}
+	}
+	step("Run pre-install hooks", p.PreInstallHooks)
+	step(fmt.Sprintf("Back up to %s", p.BackupDir), p.Backup)
+	step("Replace", p.Replace)
+	step("Add", p.Add)
+	step("Stop services", p.ServicesToStop)
+	step("Start services", p.ServicesToStart)
+	step("Skip missing services", p.MissingServices)
+	step("Run post-install hooks", p.PostInstallHooks)
+	fmt.Fprintf(&b, "Write version %s to %s\n", p.Version, p.WYCFile)
+	return b.String()
+}
+
+// DryRunHandler downloads, verifies and extracts the update like
+// UpdateHandler and works out what installing it would do, without
+// installing it. Returns int exit code and error.
+func DryRunHandler(infoer Infoer, args Args) (int, error) {
+	var result Result
+	return dryRun(context.Background(), infoer, args, &result)
+}
+
+// dryRun does the dry run, filling in the plan in `result`. The update is
+// downloaded and extracted to the system temp dir and the WYU file isn't
+// cached, so nothing is written to the install dir.
+func dryRun(ctx context.Context, infoer Infoer, args Args, result *Result) (int, error) {
+	result.Phase = PHASE_CHECK
+	req, err := NewCandidateUpdateRequest(ctx, args, infoer)
+	if err != nil {
+		return EXIT_ERROR, err
+	}
+	result.setCandidate(req)
+
+	fsys := args.fs()
+	if err := fsys.MkdirAll(os.TempDir(), 0755); err != nil {
+		return EXIT_ERROR, err
+	}
+	tmpDir, err := createTempDir(fsys, os.TempDir())
+	if nil != err {
+		err = fmt.Errorf("failed to create temp dir; %w", err)
+		return EXIT_ERROR, err
+	}
+	defer DeleteDirectory(fsys, tmpDir)
+
+	wys := req.ConfigWYS
+	wyuFilePath := filepath.Join(tmpDir, "wyu")
+	result.Phase = PHASE_DOWNLOAD
+	start := args.clock().Now()
+	downloaded, err := wys.fetchWyuFile(ctx, args, wyuFilePath, false)
+	if err != nil {
+		return EXIT_ERROR, err
+	}
+	if downloaded > 0 {
+		result.addDownload(downloaded, args.clock().Now().Sub(start))
+	}
+
+	iuc := req.ConfigIUC
+	result.Phase = PHASE_VERIFY
+	if err := verifyWyuSignature(args, iuc, wys, wyuFilePath); err != nil {
+		return EXIT_ERROR, err
+	}
+
+	_, files, err := Unzip(fsys, wyuFilePath, filepath.Join(tmpDir, "files"))
+	if nil != err {
+		err = fmt.Errorf("error unzipping %s; %w", wyuFilePath, err)
+		return EXIT_ERROR, withError(ErrVerification, err)
+	}
+
+	udt, updates, err := GetUpdateDetails(fsys, files)
+	if nil != err {
+		return EXIT_ERROR, withError(ErrVerification, err)
+	}
+
+	hooks, err := LoadHooks(fsys, files)
+	if nil != err {
+		return EXIT_ERROR, withError(ErrVerification, err)
+	}
+
+	plan := planInstall(args, string(iuc.IucInstalledVersion.Value), wys.VersionToUpdate, udt, updates, hooks)
+	result.Plan = &plan
+	result.Phase = PHASE_COMPLETE
+	return EXIT_SUCCESS, nil
+}
+
+// planInstall works out what applyUpdate would do to install `updates`
+func planInstall(args Args, installedVersion string, version string, udt ConfigUDT, updates []string, hooks Hooks) InstallPlan {
+	fsys := args.fs()
+	instDir := args.instDir()
+	plan := InstallPlan{
+		InstallDir:       instDir,
+		InstalledVersion: installedVersion,
+		Version:          version,
+		WYCFile:          args.Cdata,
+		BackupDir:        newBackupDir(fsys, instDir, installedVersion),
+		Add:              []string{},
+		Replace:          []string{},
+		Backup:           []string{},
+		PreInstallHooks:  hookCommands(hooks.PreInstall),
+		PostInstallHooks: hookCommands(hooks.PostInstall),
+	}
+
+	for _, f := range updates {
+		name := filepath.Base(f)
+		if pathExists(fsys, filepath.Join(instDir, name)) {
+			plan.Replace = append(plan.Replace, name)
+			plan.Backup = append(plan.Backup, name)
+		} else {
+			plan.Add = append(plan.Add, name)
+		}
+	}
+	if pathExists(fsys, args.Cdata) {
+		plan.Backup = append(plan.Backup, filepath.Base(args.Cdata))
+	}
+
+	// like InstallUpdate, services that aren't installed are skipped
+	services := args.services()
+	missing := make(map[string]bool)
+	plannedServices := func(tlvs []TLV) []string {
+		names := []string{}
+		for _, s := range tlvs {
+			name := ValueToString(&s)
+			exists, err := services.DoesServiceExist(name)
+			if err != nil {
+				args.Logger.Warnf("failed to lookup service %s; %v", name, err)
+			}
+			if err == nil && !exists {
+				if !missing[name] {
+					plan.MissingServices = append(plan.MissingServices, name)
+				}
+				missing[name] = true
+				continue
+			}
+			names = append(names, name)
+		}
+		return names
+	}
+	plan.ServicesToStop = plannedServices(udt.ServiceToStopBeforeUpdate)
+	plan.ServicesToStart = plannedServices(udt.ServiceToStartAfterUpdate)
+
+	return plan
+}
+
+// hookCommands returns the command lines of `hooks`
+func hookCommands(hooks []Hook) []string {
+	var commands []string
+	for _, h := range hooks {
+		commands = append(commands, strings.Join(append([]string{h.Path}, h.Args...), " "))
+	}
+	return commands
+}
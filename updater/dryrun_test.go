@@ -0,0 +1,78 @@
+package updater
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	m, instDir, wysServer, wyuServer := updaterTestMemInstall(t)
+	services := &fakeServices{}
+	u := NewUpdater(
+		WithArgs(Args{WYSTestServer: wysServer.URL, WYUTestServer: wyuServer.URL}),
+		WithInstallDir(instDir),
+		WithServiceController(services),
+		WithFS(m),
+	)
+
+	result, err := u.DryRun(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, result.ExitCode)
+	assert.Equal(t, ACTION_DRY_RUN, result.Action)
+	assert.Equal(t, PHASE_COMPLETE, result.Phase)
+
+	plan := result.Plan
+	if assert.NotNil(t, plan) {
+		assert.Equal(t, "1.0.0", plan.InstalledVersion)
+		assert.Equal(t, "1.0.1", plan.Version)
+		assert.Equal(t, []string{"WidgetX.txt"}, plan.Replace)
+		assert.Empty(t, plan.Add)
+		assert.Equal(t, []string{"WidgetX.txt", CLIENT_WYC}, plan.Backup)
+		assert.Equal(t, filepath.Join(instDir, BACKUPS_DIR_NAME, backupDirName("1.0.0")), plan.BackupDir)
+		assert.Equal(t, filepath.Join(instDir, CLIENT_WYC), plan.WYCFile)
+		assert.NotEmpty(t, plan.ServicesToStop)
+		assert.Contains(t, plan.String(), "from version 1.0.0 to 1.0.1")
+		assert.Contains(t, plan.String(), "Replace: WidgetX.txt")
+	}
+
+	// nothing was changed
+	assert.Empty(t, services.stopped)
+	assert.Empty(t, services.started)
+	assert.Equal(t, "1.0.0", readMemFile(t, m, filepath.Join(instDir, "WidgetX.txt")))
+	iuc, err := (Info{FS: m}).ParseWYC(filepath.Join(instDir, CLIENT_WYC))
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.0", string(iuc.IucInstalledVersion.Value))
+	entries, err := m.ReadDir(instDir)
+	assert.Nil(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{CLIENT_WYC, "WidgetX.txt"}, names)
+}
+
+func TestInstallPlan_String(t *testing.T) {
+	plan := InstallPlan{
+		InstallDir:       "/opt/widget",
+		InstalledVersion: "1.0.0",
+		Version:          "1.0.1",
+		WYCFile:          "/opt/widget/client.wyc",
+		Add:              []string{"new.txt"},
+		Replace:          []string{"old.txt"},
+		BackupDir:        "/opt/widget/backups/1.0.0",
+		Backup:           []string{"old.txt", "client.wyc"},
+		ServicesToStop:   []string{"Widget"},
+		ServicesToStart:  []string{"Widget"},
+	}
+	assert.Equal(t, `Dry run: update /opt/widget from version 1.0.0 to 1.0.1
+Back up to /opt/widget/backups/1.0.0: old.txt, client.wyc
+Replace: old.txt
+Add: new.txt
+Stop services: Widget
+Start services: Widget
+Write version 1.0.1 to /opt/widget/client.wyc
+`, plan.String())
+}
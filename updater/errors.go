@@ -0,0 +1,123 @@
+package updater
+
+import (
+	"context"
+	"errors"
+)
+
+// Typed errors. The errors returned by the updater wrap one of these so
+// callers can tell the failures apart with errors.Is. Each has an error
+// class reported in the Result and an exit code (see ExitCode).
+var (
+	ErrConfig         = errors.New("configuration error")           // bad arguments, WYC file or staged update
+	ErrNetwork        = errors.New("network error")                 // the WYS or WYU file could not be downloaded
+	ErrVerification   = errors.New("verification failed")           // the update failed parsing
+	ErrSignature      = errors.New("signature verification failed") // the update isn't signed by the key in the WYC file
+	ErrChecksum       = errors.New("checksum verification failed")  // the WYU file doesn't match the WYS file
+	ErrFailedBefore   = errors.New("update failed before")          // the update matches a previously failed install
+	ErrInstall        = errors.New("install failed")                // the update failed to install and was rolled back
+	ErrServiceControl = errors.New("service control failed")        // a service failed to stop or start, the update was rolled back
+	ErrHealthCheck    = errors.New("health check failed")           // the update was unhealthy and was rolled back
+	ErrHook           = errors.New("hook failed")                   // a hook failed, the update was rolled back if anything was installed
+	ErrRollbackFailed = errors.New("rollback failed")               // the previous version could not be restored
+)
+
+// errorKinds maps the typed errors to error classes and exit codes. An error
+// may wrap more than one typed error (e.g., ErrServiceControl and
+// ErrInstall), the first match in this list wins so the most specific come
+// first. A cancelled context wins over the failure it caused.
+var errorKinds = []struct {
+	err   error
+	class string
+	code  int
+}{
+	{ErrRollbackFailed, ERROR_CLASS_ROLLBACK_FAILED, EXIT_ROLLBACK_FAILED},
+	{context.Canceled, ERROR_CLASS_CANCELLED, EXIT_CANCELLED},
+	{context.DeadlineExceeded, ERROR_CLASS_CANCELLED, EXIT_CANCELLED},
+	{ErrServiceControl, ERROR_CLASS_SERVICE_CONTROL, EXIT_SERVICE_CONTROL},
+	{ErrHealthCheck, ERROR_CLASS_HEALTH_CHECK, EXIT_HEALTH_CHECK},
+	{ErrHook, ERROR_CLASS_HOOK, EXIT_HOOK},
+	{ErrInstall, ERROR_CLASS_INSTALL, EXIT_INSTALL},
+	{ErrSignature, ERROR_CLASS_SIGNATURE, EXIT_SIGNATURE},
+	{ErrChecksum, ERROR_CLASS_CHECKSUM, EXIT_CHECKSUM},
+	{ErrVerification, ERROR_CLASS_VERIFICATION, EXIT_VERIFICATION},
+	{ErrFailedBefore, ERROR_CLASS_FAILED_BEFORE, EXIT_FAILED_BEFORE},
+	{ErrNetwork, ERROR_CLASS_NETWORK, EXIT_NETWORK},
+	{ErrConfig, ERROR_CLASS_CONFIG, EXIT_CONFIG},
+	{ErrUpdateInProgress, ERROR_CLASS_LOCKED, EXIT_UPDATE_IN_PROGRESS},
+}
+
+// typedError attaches one of the typed errors to an error without changing
+// its message
+type typedError struct {
+	kind error
+	err  error
+}
+
+func (e *typedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *typedError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// withError wraps err with one of the typed errors. A nil err stays nil.
+func withError(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &typedError{kind: kind, err: err}
+}
+
+// ErrorClass returns the class of err, ERROR_CLASS_UNKNOWN if it isn't one
+// of the typed errors or "" if err is nil
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			return k.class
+		}
+	}
+	return ERROR_CLASS_UNKNOWN
+}
+
+// ExitCode returns the exit code for err, EXIT_ERROR if it isn't one of the
+// typed errors or EXIT_SUCCESS if err is nil
+func ExitCode(err error) int {
+	if err == nil {
+		return EXIT_SUCCESS
+	}
+
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			return k.code
+		}
+	}
+	return EXIT_ERROR
+}
+
+// isCancelled returns true if err was caused by a cancelled context
+func isCancelled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// exitCode returns the exit code of a run that returned `rc` and `err`.
+// Errors get their own exit code (see ExitCode) unless the legacy wyUpdate
+// exit codes were asked for (-legacyexitcodes). wyUpdate only exits with
+// 0, 2 (an update is available) and 1 for everything else.
+func exitCode(args Args, rc int, err error) int {
+	if args.Legacyexitcodes {
+		if err == nil && (rc == EXIT_SUCCESS || rc == EXIT_UPDATE_AVALIABLE) {
+			return rc
+		}
+		return EXIT_ERROR
+	}
+	if err == nil || rc != EXIT_ERROR {
+		return rc
+	}
+	return ExitCode(err)
+}
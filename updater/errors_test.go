@@ -0,0 +1,77 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors_ErrorClass(t *testing.T) {
+	assert.Equal(t, "", ErrorClass(nil))
+	assert.Equal(t, ERROR_CLASS_UNKNOWN, ErrorClass(errors.New("boom")))
+
+	err := withError(ErrNetwork, errors.New("boom"))
+	assert.Equal(t, ERROR_CLASS_NETWORK, ErrorClass(err))
+	assert.EqualError(t, err, "boom")
+	assert.True(t, errors.Is(err, ErrNetwork))
+
+	// the class survives wrapping
+	err = fmt.Errorf("outer; %w", err)
+	assert.Equal(t, ERROR_CLASS_NETWORK, ErrorClass(err))
+	assert.True(t, errors.Is(err, ErrNetwork))
+
+	assert.Nil(t, withError(ErrNetwork, nil))
+	assert.Equal(t, ERROR_CLASS_LOCKED, ErrorClass(ErrUpdateInProgress))
+}
+
+func TestErrors_most_specific(t *testing.T) {
+	// a service that didn't start failed the install
+	err := withError(ErrInstall, fmt.Errorf("error applying update; %w", withError(ErrServiceControl, errors.New("boom"))))
+	assert.Equal(t, ERROR_CLASS_SERVICE_CONTROL, ErrorClass(err))
+	assert.Equal(t, EXIT_SERVICE_CONTROL, ExitCode(err))
+	assert.True(t, errors.Is(err, ErrInstall))
+
+	// and then the rollback failed
+	err = withError(ErrRollbackFailed, fmt.Errorf("%w; error restoring backup", err))
+	assert.Equal(t, ERROR_CLASS_ROLLBACK_FAILED, ErrorClass(err))
+	assert.Equal(t, EXIT_ROLLBACK_FAILED, ExitCode(err))
+
+	// the service stopped waiting because the update was cancelled
+	err = withError(ErrServiceControl, fmt.Errorf("failed to stop widget; %w", context.Canceled))
+	assert.Equal(t, ERROR_CLASS_CANCELLED, ErrorClass(err))
+	assert.Equal(t, EXIT_CANCELLED, ExitCode(err))
+	assert.True(t, isCancelled(err))
+	assert.False(t, isCancelled(withError(ErrServiceControl, errors.New("boom"))))
+}
+
+func TestErrors_ExitCode(t *testing.T) {
+	assert.Equal(t, EXIT_SUCCESS, ExitCode(nil))
+	assert.Equal(t, EXIT_ERROR, ExitCode(errors.New("boom")))
+	assert.Equal(t, EXIT_CONFIG, ExitCode(withError(ErrConfig, errors.New("boom"))))
+	assert.Equal(t, EXIT_NETWORK, ExitCode(withError(ErrNetwork, errors.New("boom"))))
+	assert.Equal(t, EXIT_SIGNATURE, ExitCode(withError(ErrSignature, errors.New("boom"))))
+	assert.Equal(t, EXIT_CHECKSUM, ExitCode(withError(ErrChecksum, errors.New("boom"))))
+	assert.Equal(t, EXIT_UPDATE_IN_PROGRESS, ExitCode(ErrUpdateInProgress))
+}
+
+func TestErrors_exitCode(t *testing.T) {
+	err := withError(ErrNetwork, errors.New("boom"))
+
+	var args Args
+	assert.Equal(t, EXIT_NETWORK, exitCode(args, EXIT_ERROR, err))
+	assert.Equal(t, EXIT_SUCCESS, exitCode(args, EXIT_SUCCESS, nil))
+	assert.Equal(t, EXIT_UPDATE_AVALIABLE, exitCode(args, EXIT_UPDATE_AVALIABLE, nil))
+
+	assert.Equal(t, EXIT_UPDATE_IN_PROGRESS, exitCode(args, EXIT_UPDATE_IN_PROGRESS, ErrUpdateInProgress))
+
+	args.Legacyexitcodes = true
+	assert.Equal(t, EXIT_ERROR, exitCode(args, EXIT_ERROR, err))
+	assert.Equal(t, EXIT_SUCCESS, exitCode(args, EXIT_SUCCESS, nil))
+	assert.Equal(t, EXIT_UPDATE_AVALIABLE, exitCode(args, EXIT_UPDATE_AVALIABLE, nil))
+	// codes wyUpdate never exits with are errors
+	assert.Equal(t, EXIT_ERROR, exitCode(args, EXIT_UPDATE_IN_PROGRESS, ErrUpdateInProgress))
+	assert.Equal(t, EXIT_ERROR, exitCode(args, EXIT_FAILED_BEFORE, withError(ErrFailedBefore, errors.New("boom"))))
+}
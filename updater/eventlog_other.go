@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package updater
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// EventLogSink is only available on Windows
+type EventLogSink struct{}
+
+// NewEventLogSink is not supported
+func NewEventLogSink(source string) (*EventLogSink, error) {
+	return nil, fmt.Errorf("the event log is not supported on %s", runtime.GOOS)
+}
+
+// Emit is not supported
+func (s *EventLogSink) Emit(event Event) error {
+	return fmt.Errorf("the event log is not supported on %s", runtime.GOOS)
+}
+
+// Close does nothing
+func (s *EventLogSink) Close() error {
+	return nil
+}
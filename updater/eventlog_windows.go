@@ -0,0 +1,48 @@
+//go:build windows
+// +build windows
+
+package updater
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// EventLogSink writes events to the Windows Application event log
+type EventLogSink struct {
+	log *eventlog.Log
+}
+
+// NewEventLogSink returns an EventLogSink writing as event source `source`.
+// The source is registered if it isn't already, this requires admin; an
+// unregistered source still logs but the messages are shown with a "description
+// not found" preamble.
+func NewEventLogSink(source string) (*EventLogSink, error) {
+	// best effort, fails if the source already exists
+	_ = eventlog.InstallAsEventCreate(source, eventlog.Error|eventlog.Warning|eventlog.Info)
+
+	log, err := eventlog.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log for %s; %w", source, err)
+	}
+	return &EventLogSink{log: log}, nil
+}
+
+// Emit writes the event to the event log
+func (s *EventLogSink) Emit(event Event) error {
+	msg := fmt.Sprintf("%s: %s", event.Type, event.Message)
+	switch event.Level {
+	case LOG_ERROR:
+		return s.log.Error(event.ID(), msg)
+	case LOG_WARN:
+		return s.log.Warning(event.ID(), msg)
+	default:
+		return s.log.Info(event.ID(), msg)
+	}
+}
+
+// Close closes the event log
+func (s *EventLogSink) Close() error {
+	return s.log.Close()
+}
@@ -0,0 +1,183 @@
+package updater
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// EventType identifies an update event
+type EventType string
+
+// Update events
+const (
+	EVENT_UPDATE_STARTED     EventType = "update_started"
+	EVENT_UPDATE_SUCCEEDED   EventType = "update_succeeded"
+	EVENT_UPDATE_FAILED      EventType = "update_failed"
+	EVENT_SIGNATURE_FAILED   EventType = "signature_failed"
+	EVENT_ROLLBACK_PERFORMED EventType = "rollback_performed"
+	EVENT_SERVICES_RESTARTED EventType = "services_restarted"
+	EVENT_HOOK_FAILED        EventType = "hook_failed"
+	EVENT_HEALTH_FAILED      EventType = "health_check_failed"
+)
+
+// DEFAULT_EVENT_SOURCE is the source name used for the Windows event log
+const DEFAULT_EVENT_SOURCE = "win-service-updater"
+
+// eventInfo is the severity and Windows event ID of each event type
+var eventInfo = map[EventType]struct {
+	level LogLevel
+	id    uint32
+}{
+	EVENT_UPDATE_STARTED:     {LOG_INFO, 1000},
+	EVENT_UPDATE_SUCCEEDED:   {LOG_INFO, 1001},
+	EVENT_UPDATE_FAILED:      {LOG_ERROR, 1002},
+	EVENT_SIGNATURE_FAILED:   {LOG_ERROR, 1003},
+	EVENT_ROLLBACK_PERFORMED: {LOG_WARN, 1004},
+	EVENT_SERVICES_RESTARTED: {LOG_INFO, 1005},
+	EVENT_HOOK_FAILED:        {LOG_ERROR, 1006},
+	EVENT_HEALTH_FAILED:      {LOG_ERROR, 1007},
+}
+
+// Event is something notable that happened while updating
+type Event struct {
+	Type    EventType
+	Level   LogLevel
+	Time    time.Time
+	Message string
+}
+
+// NewEvent returns an event of type `typ` with the severity for that type
+func NewEvent(typ EventType, format string, v ...interface{}) Event {
+	level := LOG_INFO
+	if info, ok := eventInfo[typ]; ok {
+		level = info.level
+	}
+
+	return Event{
+		Type:    typ,
+		Level:   level,
+		Time:    time.Now(),
+		Message: fmt.Sprintf(format, v...),
+	}
+}
+
+// ID returns the Windows event ID of the event
+func (e Event) ID() uint32 {
+	return eventInfo[e.Type].id
+}
+
+// EventSink receives update events, e.g., to forward them to the Windows
+// event log or a syslog collector
+type EventSink interface {
+	Emit(event Event) error
+	Close() error
+}
+
+// NewEventSinkFromArgs returns the event sinks configured by the
+// command-line arguments, or nil if none are configured. A sink that can't
+// be created is left out and its error returned with the other sinks.
+func NewEventSinkFromArgs(args Args) (EventSink, error) {
+	var sinks MultiSink
+	var result error
+
+	if args.Eventlog {
+		sink, err := NewEventLogSink(args.Eventsource)
+		if err != nil {
+			result = multierror.Append(result, err)
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+
+	if len(args.Syslog) > 0 {
+		sink, err := NewSyslogSink(args.Syslog)
+		if err != nil {
+			result = multierror.Append(result, err)
+		} else {
+			sinks = append(sinks, sink)
+		}
+	}
+
+	if len(sinks) == 0 {
+		return nil, result
+	}
+	return sinks, result
+}
+
+// emitEvent sends an event to the event sink, if there is one. Failing to
+// deliver an event never fails the update, it is only logged.
+func emitEvent(args Args, typ EventType, format string, v ...interface{}) {
+	if args.Events == nil {
+		return
+	}
+
+	err := args.Events.Emit(NewEvent(typ, format, v...))
+	if err != nil {
+		args.Logger.Warnf("failed to emit %s event; %v", typ, err)
+	}
+}
+
+// MultiSink sends events to each of its sinks
+type MultiSink []EventSink
+
+// Emit sends the event to every sink, even if some fail
+func (m MultiSink) Emit(event Event) error {
+	var errs *multierror.Error
+	for _, sink := range m {
+		if err := sink.Emit(event); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// Close closes every sink
+func (m MultiSink) Close() error {
+	var errs *multierror.Error
+	for _, sink := range m {
+		if err := sink.Close(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// MemorySink keeps events in memory, it is used by the tests
+type MemorySink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Emit records the event
+func (m *MemorySink) Emit(event Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+// Close does nothing
+func (m *MemorySink) Close() error {
+	return nil
+}
+
+// Events returns the events emitted so far
+func (m *MemorySink) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Event(nil), m.events...)
+}
+
+// Types returns the type of each event emitted so far
+func (m *MemorySink) Types() []EventType {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	types := make([]EventType, 0, len(m.events))
+	for _, e := range m.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
@@ -0,0 +1,82 @@
+package updater
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingSink struct{}
+
+func (failingSink) Emit(event Event) error { return errors.New("sink is broken") }
+func (failingSink) Close() error           { return nil }
+
+func TestEvents_NewEvent(t *testing.T) {
+	e := NewEvent(EVENT_SIGNATURE_FAILED, "version %s", "1.0.1")
+	assert.Equal(t, LOG_ERROR, e.Level)
+	assert.Equal(t, "version 1.0.1", e.Message)
+	assert.Equal(t, uint32(1003), e.ID())
+
+	e = NewEvent(EVENT_ROLLBACK_PERFORMED, "rolled back")
+	assert.Equal(t, LOG_WARN, e.Level)
+}
+
+func TestEvents_MultiSink(t *testing.T) {
+	var a, b MemorySink
+	sinks := MultiSink{&a, failingSink{}, &b}
+
+	err := sinks.Emit(NewEvent(EVENT_UPDATE_STARTED, "starting"))
+	assert.NotNil(t, err)
+	assert.Equal(t, []EventType{EVENT_UPDATE_STARTED}, a.Types())
+	assert.Equal(t, []EventType{EVENT_UPDATE_STARTED}, b.Types())
+	assert.Nil(t, sinks.Close())
+}
+
+func TestEvents_NewEventSinkFromArgs_none(t *testing.T) {
+	sink, err := NewEventSinkFromArgs(Args{})
+	assert.Nil(t, err)
+	assert.Nil(t, sink)
+}
+
+func TestEvents_UpdateHandler_signature_failed(t *testing.T) {
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
+
+	tsWYS, tsWYU := stagingTestServers(t, "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	defer tsWYS.Close()
+	defer tsWYU.Close()
+
+	var sink MemorySink
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.WYSTestServer = tsWYS.URL
+	args.WYUTestServer = tsWYU.URL
+	args.Events = &sink
+
+	finfo := FakeUpdateInfo{}
+	finfo.ModifyWYS = true
+	finfo.ConfigWYS.FileSha1 = []byte("invalid")
+	finfo.ConfigWYS.UpdateFileAdler32 = WYU_FILE_ADLER32
+
+	exitCode, err := UpdateHandler(finfo, args)
+	assert.Equal(t, EXIT_ERROR, exitCode)
+	assert.NotNil(t, err)
+
+	expected := []EventType{EVENT_UPDATE_STARTED, EVENT_SIGNATURE_FAILED, EVENT_UPDATE_FAILED}
+	assert.Equal(t, expected, sink.Types())
+}
+
+func TestEvents_UpdateHandler_download_failed(t *testing.T) {
+	var sink MemorySink
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.WYSTestServer = "http://127.0.0.1:0"
+	args.Events = &sink
+
+	exitCode, err := UpdateHandler(Info{}, args)
+	assert.Equal(t, EXIT_ERROR, exitCode)
+	assert.NotNil(t, err)
+
+	assert.Equal(t, []EventType{EVENT_UPDATE_FAILED}, sink.Types())
+}
@@ -0,0 +1,205 @@
+package updater
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Retry defaults for an update that failed to install
+const (
+	DEFAULT_RETRY_BUDGET  = 2
+	DEFAULT_RETRY_BACKOFF = time.Hour
+)
+
+// maxRetryBackoffShift caps the exponential backoff so it can't overflow
+const maxRetryBackoffShift = 16
+
+// FailedInstall records an update that failed to install. It is kept in
+// INSTALL_FAILED_SENTINAL_INFO_FILE_NAME next to the failed install sentinel
+// (a copy of the WYS file of the update).
+type FailedInstall struct {
+	Version      string    `json:"version"`
+	Reason       string    `json:"reason"`
+	FirstFailure time.Time `json:"first_failure"`
+	LastFailure  time.Time `json:"last_failure"`
+	Attempts     int       `json:"attempts"`
+}
+
+// RetryAt returns when the failed update may be installed again. `ok` is
+// false once the retry budget is used up, the update is then only retried
+// after the sentinel is cleared (/clearfailed) or a new update is published.
+// Each retry waits twice as long as the one before.
+func (f FailedInstall) RetryAt(budget int, backoff time.Duration) (at time.Time, ok bool) {
+	if f.Attempts > budget {
+		return at, false
+	}
+
+	shift := f.Attempts - 1
+	if shift < 0 {
+		shift = 0
+	}
+	if shift > maxRetryBackoffShift {
+		shift = maxRetryBackoffShift
+	}
+	return f.LastFailure.Add(backoff << shift), true
+}
+
+// ReadFailedInstall returns the failed install recorded in `instDir`, or nil
+// if there is no failed install sentinel. A sentinel left by an older
+// version of the updater, without the record, is treated as a single
+// failure at the time the sentinel was written.
+func ReadFailedInstall(fsys FS, instDir string) (*FailedInstall, error) {
+	fsys = fsOrOS(fsys)
+	sentinel := filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)
+	fi, err := fsys.Stat(sentinel)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record := FailedInstall{
+		Reason:       "unknown",
+		FirstFailure: fi.ModTime(),
+		LastFailure:  fi.ModTime(),
+		Attempts:     1,
+	}
+
+	infoPath := filepath.Join(instDir, INSTALL_FAILED_SENTINAL_INFO_FILE_NAME)
+	dat, err := fsys.ReadFile(infoPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return &record, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(dat, &record); err != nil {
+		return nil, fmt.Errorf("error parsing failed install record %s; %w", infoPath, err)
+	}
+	return &record, nil
+}
+
+// recordFailedInstall makes the WYS file of an update that failed to install
+// the failed install sentinel and records the failure. Failures of the same
+// update (an identical WYS file) are counted.
+func recordFailedInstall(fsys FS, instDir string, wysFilePath string, version string, reason error, now time.Time) (FailedInstall, error) {
+	fsys = fsOrOS(fsys)
+	now = now.UTC()
+	record := FailedInstall{
+		Version:      version,
+		Reason:       reason.Error(),
+		FirstFailure: now,
+		LastFailure:  now,
+		Attempts:     1,
+	}
+
+	wys, err := fsys.Open(wysFilePath)
+	if err != nil {
+		return record, err
+	}
+	matches := candidateWysFileMatchesFailedInstallWysFile(fsys, instDir, wys)
+	wys.Close()
+
+	if matches {
+		if previous, err := ReadFailedInstall(fsys, instDir); err == nil && previous != nil {
+			record.FirstFailure = previous.FirstFailure
+			record.Attempts = previous.Attempts + 1
+		}
+	}
+
+	sentinel := filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)
+	if err := fsys.Rename(wysFilePath, sentinel); err != nil {
+		return record, fmt.Errorf("error renaming %s to failed install sentinel; %w", wysFilePath, err)
+	}
+
+	dat, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return record, err
+	}
+	err = writeFileAtomic(fsys, filepath.Join(instDir, INSTALL_FAILED_SENTINAL_INFO_FILE_NAME), dat)
+	return record, err
+}
+
+// ClearFailedInstall removes the failed install sentinel and its record so
+// the update is tried again
+func ClearFailedInstall(fsys FS, instDir string) error {
+	for _, name := range []string{INSTALL_FAILED_SENTINAL_WYS_FILE_NAME, INSTALL_FAILED_SENTINAL_INFO_FILE_NAME} {
+		err := fsOrOS(fsys).Remove(filepath.Join(instDir, name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFailedInstall returns an error if the candidate WYS file is the
+// sentinel of a failed install that may not be retried yet
+func checkFailedInstall(args Args, candidateWysFileContent []byte, version string) error {
+	instDir := args.instDir()
+	if !candidateWysFileMatchesFailedInstallWysFile(args.fs(), instDir, bytes.NewReader(candidateWysFileContent)) {
+		return nil
+	}
+
+	record, err := ReadFailedInstall(args.fs(), instDir)
+	if err != nil {
+		args.Logger.Warnf("failed to read failed install record; %v", err)
+	}
+	if record == nil {
+		// the sentinel matched, so the update failed at least once, when the
+		// sentinel was written (like ReadFailedInstall without a record)
+		lastFailure := args.clock().Now()
+		sentinel := filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)
+		if fi, err := args.fs().Stat(sentinel); err == nil {
+			lastFailure = fi.ModTime()
+		}
+		record = &FailedInstall{Reason: "unknown", FirstFailure: lastFailure, LastFailure: lastFailure, Attempts: 1}
+	}
+
+	retryAt, ok := record.RetryAt(args.Retrybudget, args.Retrybackoff)
+	if !ok {
+		err = fmt.Errorf("error updating to version '%v' failed before (%d attempts; %s), aborting updating", version, record.Attempts, record.Reason)
+		return withError(ErrFailedBefore, err)
+	}
+	if args.clock().Now().Before(retryAt) {
+		err = fmt.Errorf("error updating to version '%v' failed before (%d attempts; %s), not retrying until %s", version, record.Attempts, record.Reason, retryAt.Format(time.RFC3339))
+		return withError(ErrFailedBefore, err)
+	}
+
+	args.Logger.Infof("Retrying version %s after %d failed attempts; %s", version, record.Attempts, record.Reason)
+	return nil
+}
+
+// ClearFailedHandler removes the failed install sentinel so the update that
+// failed is tried again. Returns int exit code and error.
+func ClearFailedHandler(args Args) (int, error) {
+	var result Result
+	return clearFailed(args, args.instDir(), &result)
+}
+
+// clearFailed removes the failed install sentinel in `instDir`, recording
+// the failure that was cleared in `result`
+func clearFailed(args Args, instDir string, result *Result) (int, error) {
+	record, err := ReadFailedInstall(args.fs(), instDir)
+	if err != nil {
+		args.Logger.Warnf("%v", err)
+	}
+	result.FailedInstall = record
+
+	if err := ClearFailedInstall(args.fs(), instDir); err != nil {
+		err = fmt.Errorf("failed to remove failed install sentinel; %w", err)
+		return EXIT_ERROR, err
+	}
+
+	if record != nil {
+		args.Logger.Infof("Cleared failed install of version %s (%d attempts; %s)", record.Version, record.Attempts, record.Reason)
+	}
+	result.Phase = PHASE_COMPLETE
+	return EXIT_SUCCESS, nil
+}
@@ -0,0 +1,167 @@
+package updater
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailedInstall_RetryAt(t *testing.T) {
+	last := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	record := FailedInstall{LastFailure: last, Attempts: 1}
+
+	at, ok := record.RetryAt(2, time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, last.Add(time.Hour), at)
+
+	// the backoff doubles
+	record.Attempts = 2
+	at, ok = record.RetryAt(2, time.Hour)
+	assert.True(t, ok)
+	assert.Equal(t, last.Add(2*time.Hour), at)
+
+	// the budget is used up
+	record.Attempts = 3
+	_, ok = record.RetryAt(2, time.Hour)
+	assert.False(t, ok)
+
+	// a budget of 0 never retries
+	record.Attempts = 1
+	_, ok = record.RetryAt(0, time.Hour)
+	assert.False(t, ok)
+}
+
+func TestFailedInstall_recordFailedInstall(t *testing.T) {
+	record, err := ReadFailedInstall(OSFS{}, t.TempDir())
+	assert.Nil(t, err)
+	assert.Nil(t, record)
+
+	writeWys := func() string {
+		dat, err := os.ReadFile("./testdata/widgetX.1.0.1.wys")
+		assert.Nil(t, err)
+		wysFilePath := filepath.Join(t.TempDir(), "wys")
+		assert.Nil(t, os.WriteFile(wysFilePath, dat, 0644))
+		return wysFilePath
+	}
+
+	instDir := t.TempDir()
+	first, err := recordFailedInstall(OSFS{}, instDir, writeWys(), "1.0.1", errors.New("file locked"), time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first.Attempts)
+	assert.True(t, fileExists(filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)))
+
+	second, err := recordFailedInstall(OSFS{}, instDir, writeWys(), "1.0.1", errors.New("service didn't start"), time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, second.Attempts)
+	assert.Equal(t, first.FirstFailure, second.FirstFailure)
+
+	record, err = ReadFailedInstall(OSFS{}, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.1", record.Version)
+	assert.Equal(t, "service didn't start", record.Reason)
+	assert.Equal(t, 2, record.Attempts)
+
+	var result Result
+	rc, err := clearFailed(Args{}, instDir, &result)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, rc)
+	assert.Equal(t, 2, result.FailedInstall.Attempts)
+	assert.False(t, fileExists(filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)))
+	assert.False(t, fileExists(filepath.Join(instDir, INSTALL_FAILED_SENTINAL_INFO_FILE_NAME)))
+
+	// nothing to clear
+	rc, err = clearFailed(Args{}, instDir, &result)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, rc)
+}
+
+func TestFailedInstall_ReadFailedInstall_legacy(t *testing.T) {
+	instDir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME), []byte("wys"), 0644))
+
+	record, err := ReadFailedInstall(OSFS{}, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, record.Attempts)
+	assert.Equal(t, "unknown", record.Reason)
+	assert.False(t, record.LastFailure.IsZero())
+}
+
+func TestFailedInstall_checkFailedInstall(t *testing.T) {
+	instDir := t.TempDir()
+
+	wys, err := os.ReadFile("./testdata/widgetX.1.0.1.wys")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME), wys, 0644))
+
+	record := FailedInstall{
+		Version:     "1.0.1",
+		Reason:      "file locked",
+		LastFailure: time.Now().Add(-90 * time.Minute),
+		Attempts:    1,
+	}
+	writeRecord := func() {
+		dat, err := json.Marshal(record)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(filepath.Join(instDir, INSTALL_FAILED_SENTINAL_INFO_FILE_NAME), dat, 0644))
+	}
+	writeRecord()
+
+	var args Args
+	args.InstallDir = instDir
+	args.Retrybudget = 2
+	args.Retrybackoff = time.Hour
+
+	// the backoff has passed
+	assert.Nil(t, checkFailedInstall(args, wys, "1.0.1"))
+
+	// the second backoff hasn't
+	record.Attempts = 2
+	writeRecord()
+	err = checkFailedInstall(args, wys, "1.0.1")
+	assert.Equal(t, ERROR_CLASS_FAILED_BEFORE, ErrorClass(err))
+	assert.Contains(t, err.Error(), "file locked")
+	assert.Contains(t, err.Error(), "not retrying until")
+
+	// the budget is used up
+	record.Attempts = 3
+	record.LastFailure = time.Now().Add(-24 * time.Hour)
+	writeRecord()
+	err = checkFailedInstall(args, wys, "1.0.1")
+	assert.Equal(t, ERROR_CLASS_FAILED_BEFORE, ErrorClass(err))
+
+	// a different update isn't affected
+	other := append([]byte(nil), wys...)
+	other[0] = ^other[0]
+	assert.Nil(t, checkFailedInstall(args, other, "1.0.2"))
+}
+
+func TestFailedInstall_checkFailedInstall_corruptRecord(t *testing.T) {
+	instDir := t.TempDir()
+
+	wys, err := os.ReadFile("./testdata/widgetX.1.0.1.wys")
+	assert.Nil(t, err)
+	sentinel := filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)
+	assert.Nil(t, os.WriteFile(sentinel, wys, 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(instDir, INSTALL_FAILED_SENTINAL_INFO_FILE_NAME), []byte("{"), 0644))
+	failedAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Nil(t, os.Chtimes(sentinel, failedAt, failedAt))
+
+	var args Args
+	args.InstallDir = instDir
+	args.Retrybudget = 2
+	args.Retrybackoff = time.Hour
+
+	// the failure is dated by the sentinel, not the time of the check
+	args.Clock = &fakeClock{now: failedAt.Add(30 * time.Minute)}
+	err = checkFailedInstall(args, wys, "1.0.1")
+	assert.Equal(t, ERROR_CLASS_FAILED_BEFORE, ErrorClass(err))
+	assert.Contains(t, err.Error(), failedAt.Add(time.Hour).Format(time.RFC3339))
+
+	args.Clock = &fakeClock{now: failedAt.Add(2 * time.Hour)}
+	assert.Nil(t, checkFailedInstall(args, wys, "1.0.1"))
+}
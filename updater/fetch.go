@@ -0,0 +1,149 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Fetcher writes the content linked by the URL to the writer. `client` is
+// the HTTP client of the download, fetchers of other schemes ignore it.
+// The fetch is aborted when `ctx` is done.
+type Fetcher func(ctx context.Context, client *http.Client, URL string, writer io.Writer) error
+
+var (
+	fetchersMu sync.RWMutex
+	// fetchers by URL scheme
+	fetchers = map[string]Fetcher{
+		"http":  HTTPGetFile,
+		"https": HTTPGetFile,
+		"file":  FileGetFile,
+		"ftp":   FTPGetFile,
+		"ftps":  FTPGetFile,
+	}
+)
+
+// RegisterFetcher makes `fetcher` fetch the URLs with `scheme` (e.g.,
+// "ftp"), replacing the scheme's fetcher if it has one
+func RegisterFetcher(scheme string, fetcher Fetcher) {
+	fetchersMu.Lock()
+	defer fetchersMu.Unlock()
+	fetchers[strings.ToLower(scheme)] = fetcher
+}
+
+// GetFile fetches the content linked by the URL with the fetcher of its
+// scheme and writes it to the writer. Windows UNC paths
+// (\\server\share\widget.wys) are fetched like file:// URLs.
+func GetFile(ctx context.Context, client *http.Client, URL string, writer io.Writer) error {
+	if isUNCPath(URL) {
+		return FileGetFile(ctx, client, URL, writer)
+	}
+
+	scheme, _, ok := strings.Cut(URL, "://")
+	if !ok {
+		return fmt.Errorf("Error downloading \"%s\": no URL scheme", URL)
+	}
+	fetchersMu.RLock()
+	fetcher, ok := fetchers[strings.ToLower(scheme)]
+	fetchersMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("Error downloading \"%s\": unsupported URL scheme \"%s\"", URL, scheme)
+	}
+	return fetcher(ctx, client, URL, writer)
+}
+
+// FileGetFile copies the file linked by a file:// URL or UNC path to the
+// writer. file://server/share/widget.wys is the UNC path
+// \\server\share\widget.wys, file:///C:/updates/widget.wys a local file.
+func FileGetFile(ctx context.Context, client *http.Client, URL string, writer io.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path, err := fileURLPath(URL)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Error reading \"%s\": %w", URL, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("Error reading \"%s\": %w", URL, err)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("Error reading \"%s\": not a file", URL)
+	}
+
+	if _, err := io.Copy(writer, &ctxReader{ctx: ctx, r: f}); err != nil {
+		return fmt.Errorf("Error reading \"%s\": %w", URL, err)
+	}
+	return nil
+}
+
+// redactURL replaces the password in the URL with "xxxxx", e.g., for FTP
+// URLs with credentials
+func redactURL(URL string) string {
+	u, err := url.Parse(URL)
+	if err != nil || u.User == nil {
+		return URL
+	}
+	return u.Redacted()
+}
+
+// isUNCPath returns true if `s` is a Windows UNC path
+func isUNCPath(s string) bool {
+	return strings.HasPrefix(s, `\\`)
+}
+
+// fileURLPath returns the path of the file linked by a file:// URL or UNC path
+func fileURLPath(URL string) (string, error) {
+	if isUNCPath(URL) {
+		return URL, nil
+	}
+
+	u, err := url.Parse(URL)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(u.Scheme, "file") {
+		return "", fmt.Errorf("not a file URL: %s", URL)
+	}
+	if u.Path == "" {
+		return "", fmt.Errorf("no path in file URL: %s", URL)
+	}
+
+	path := u.Path
+	switch {
+	case u.Host != "" && !strings.EqualFold(u.Host, "localhost"):
+		// a file on a share
+		path = "//" + u.Host + path
+	case filepath.VolumeName(path[1:]) != "":
+		// file:///C:/updates is C:/updates on Windows
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// ctxReader stops reading once `ctx` is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,140 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fileURL returns the file:// URL of the local file `path`
+func fileURL(t *testing.T, path string) string {
+	abs, err := filepath.Abs(path)
+	assert.Nil(t, err)
+	abs = filepath.ToSlash(abs)
+	if abs[0] != '/' {
+		// C:/dir on Windows
+		abs = "/" + abs
+	}
+	return "file://" + abs
+}
+
+func TestFetch_FileGetFile(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "widget.wys"), []byte("wys"), 0644))
+
+	var buf bytes.Buffer
+	assert.Nil(t, GetFile(context.Background(), nil, fileURL(t, filepath.Join(dir, "widget.wys")), &buf))
+	assert.Equal(t, "wys", buf.String())
+
+	// missing file
+	buf.Reset()
+	err := GetFile(context.Background(), nil, fileURL(t, filepath.Join(dir, "missing.wys")), &buf)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	// directory
+	err = GetFile(context.Background(), nil, fileURL(t, dir), &buf)
+	assert.NotNil(t, err)
+
+	// cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = GetFile(ctx, nil, fileURL(t, filepath.Join(dir, "widget.wys")), &buf)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestFetch_GetFile_scheme(t *testing.T) {
+	var buf bytes.Buffer
+	err := GetFile(context.Background(), nil, "gopher://example.com/widget.wys", &buf)
+	assert.Contains(t, err.Error(), `unsupported URL scheme "gopher"`)
+
+	err = GetFile(context.Background(), nil, "widget.wys", &buf)
+	assert.Contains(t, err.Error(), "no URL scheme")
+
+	RegisterFetcher("Test", func(ctx context.Context, client *http.Client, URL string, writer io.Writer) error {
+		_, err := io.WriteString(writer, URL)
+		return err
+	})
+	t.Cleanup(func() {
+		fetchersMu.Lock()
+		delete(fetchers, "test")
+		fetchersMu.Unlock()
+	})
+	assert.Nil(t, GetFile(context.Background(), nil, "TEST://example.com/widget.wys", &buf))
+	assert.Equal(t, "TEST://example.com/widget.wys", buf.String())
+}
+
+func TestFetch_fileURLPath(t *testing.T) {
+	tests := []struct {
+		url  string
+		path string
+	}{
+		{"file:///srv/updates/widget.wys", filepath.FromSlash("/srv/updates/widget.wys")},
+		{"file://localhost/srv/updates/widget.wys", filepath.FromSlash("/srv/updates/widget.wys")},
+		{"file://server/share/widget.wys", filepath.FromSlash("//server/share/widget.wys")},
+		{"file:///srv/updates/widget%20x.wys", filepath.FromSlash("/srv/updates/widget x.wys")},
+		{`\\server\share\widget.wys`, `\\server\share\widget.wys`},
+	}
+	if runtime.GOOS == "windows" {
+		tests = append(tests, struct {
+			url  string
+			path string
+		}{"file:///C:/updates/widget.wys", `C:\updates\widget.wys`})
+	}
+	for _, tt := range tests {
+		path, err := fileURLPath(tt.url)
+		assert.Nil(t, err, tt.url)
+		assert.Equal(t, tt.path, path, tt.url)
+	}
+
+	_, err := fileURLPath("file://server")
+	assert.NotNil(t, err)
+	_, err = fileURLPath("https://server/widget.wys")
+	assert.NotNil(t, err)
+}
+
+func TestFetch_Updater_fileURLs(t *testing.T) {
+	m, instDir, _, _ := updaterTestMemInstall(t)
+	u := NewUpdater(
+		WithArgs(Args{
+			WYSTestServer: fileURL(t, "./testdata/widgetX.1.0.1.wys"),
+			WYUTestServer: fileURL(t, "./testdata/widgetX.1.0.1.wyu"),
+		}),
+		WithInstallDir(instDir),
+		WithServiceController(&fakeServices{}),
+		WithFS(m),
+	)
+
+	result, err := u.Update(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, result.ExitCode)
+	assert.Equal(t, "1.0.1", readMemFile(t, m, filepath.Join(instDir, "WidgetX.txt")))
+}
+
+func TestFetch_Updater_fileURLs_checksum(t *testing.T) {
+	m, instDir, _, _ := updaterTestMemInstall(t)
+	// a WYU file that doesn't match the WYS file
+	wyu := filepath.Join(t.TempDir(), "widgetX.wyu")
+	assert.Nil(t, os.WriteFile(wyu, []byte("not the update"), 0644))
+	u := NewUpdater(
+		WithArgs(Args{
+			WYSTestServer: fileURL(t, "./testdata/widgetX.1.0.1.wys"),
+			WYUTestServer: fileURL(t, wyu),
+		}),
+		WithInstallDir(instDir),
+		WithServiceController(&fakeServices{}),
+		WithFS(m),
+	)
+
+	result, err := u.Update(context.Background())
+	assert.True(t, errors.Is(err, ErrChecksum))
+	assert.Equal(t, EXIT_CHECKSUM, result.ExitCode)
+	assert.Equal(t, "1.0.0", readMemFile(t, m, filepath.Join(instDir, "WidgetX.txt")))
+}
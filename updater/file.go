@@ -2,10 +2,10 @@ package updater
 
 import (
 	"archive/zip"
+	"bytes"
 	"crypto/sha1"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -20,7 +20,13 @@ func GetExeDir() string {
 // GenerateSHA1HashFromFilePath returns the SHA1 hash of the contents for the filePath.
 // hash will always be zero value when err is not nil.
 func GenerateSHA1HashFromFilePath(filePath string) (hash []byte, err error) {
-	file, err := os.Open(filePath)
+	return generateSHA1HashFromFile(OSFS{}, filePath)
+}
+
+// generateSHA1HashFromFile returns the SHA1 hash of the contents of `name`
+// in `fsys`
+func generateSHA1HashFromFile(fsys FS, name string) (hash []byte, err error) {
+	file, err := fsOrOS(fsys).Open(name)
 	if nil != err {
 		return []byte{}, err
 	}
@@ -51,7 +57,13 @@ func TempDirPrefix() string {
 
 // CreateTempDir returns a temporary directory name and error if the creation failed
 func CreateTempDir() (tempDir string, err error) {
-	tempDir, err = ioutil.TempDir(GetExeDir(), TempDirPrefix())
+	return createTempDir(OSFS{}, GetExeDir())
+}
+
+// createTempDir creates a temporary directory in `dir`. Files are moved from
+// it into the install directory, so it has to be on the same volume.
+func createTempDir(fsys FS, dir string) (tempDir string, err error) {
+	tempDir, err = fsOrOS(fsys).MkdirTemp(dir, TempDirPrefix())
 	if nil != err {
 		return "", err
 	}
@@ -60,13 +72,14 @@ func CreateTempDir() (tempDir string, err error) {
 
 // Unzip will decompress a zip archive, moving all compressed files/folders
 // to the specified output directory.
-func Unzip(srcArchive string, destDir string) (root string, filenames []string, err error) {
-	r, err := zip.OpenReader(srcArchive)
+func Unzip(fsys FS, srcArchive string, destDir string) (root string, filenames []string, err error) {
+	fsys = fsOrOS(fsys)
+	r, closer, err := openZip(fsys, srcArchive)
 	if err != nil {
 		err := fmt.Errorf("OpenReader() failed: %v", err)
 		return "", filenames, err
 	}
-	defer r.Close()
+	defer closer.Close()
 
 	for _, f := range r.File {
 
@@ -79,7 +92,7 @@ func Unzip(srcArchive string, destDir string) (root string, filenames []string,
 			return "", filenames, fmt.Errorf("%s: illegal file path", fpath)
 		}
 
-		err := writeDecompressedFile(f, fpath)
+		err := writeDecompressedFile(fsys, f, fpath)
 		if nil != err {
 			return "", filenames, err
 		}
@@ -87,20 +100,48 @@ func Unzip(srcArchive string, destDir string) (root string, filenames []string,
 	return "", filenames, nil
 }
 
+// openZip opens the zip archive `name` in `fsys`
+func openZip(fsys FS, name string) (*zip.Reader, io.Closer, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		dat, err := io.ReadAll(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		ra = bytes.NewReader(dat)
+	}
+	r, err := zip.NewReader(ra, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return r, f, nil
+}
+
 // writeDecompressedFile writes (de)compressed file to `fpath`
-func writeDecompressedFile(f *zip.File, fpath string) error {
+func writeDecompressedFile(fsys FS, f *zip.File, fpath string) error {
 	if f.FileInfo().IsDir() {
 		// Make Folder
-		os.MkdirAll(fpath, os.ModePerm)
+		fsys.MkdirAll(fpath, os.ModePerm)
 		return nil
 	}
 
 	// Make File
-	if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+	if err := fsys.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
 		return err
 	}
 
-	outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+	outFile, err := fsys.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
 	if err != nil {
 		err := fmt.Errorf("OpenFile() failed: %v", err)
 		return err
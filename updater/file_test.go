@@ -18,7 +18,7 @@ func TestFile_Unzip(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	zipFile := "./testdata/test.zip"
-	_, files, err := Unzip(zipFile, tempDir)
+	_, files, err := Unzip(OSFS{}, zipFile, tempDir)
 	assert.Nil(t, err)
 	// there are 4 files in the test.zip
 	assert.Equal(t, 4, len(files))
@@ -0,0 +1,132 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// FS is the filesystem the install pipeline works on: the temp directory
+// the update is downloaded and extracted to, the backups, the install
+// directory and the failed install sentinel. It is io/fs plus the write
+// operations the updater needs. Unlike io/fs, names are operating system
+// paths.
+type FS interface {
+	fs.StatFS
+	fs.ReadDirFS
+	fs.ReadFileFS
+
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	MkdirAll(path string, perm fs.FileMode) error
+	MkdirTemp(dir string, pattern string) (string, error)
+	Rename(oldpath string, newpath string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+}
+
+// File is a file opened for writing
+type File interface {
+	fs.File
+	io.Writer
+}
+
+// OSFS is the operating system's filesystem
+type OSFS struct{}
+
+func (OSFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (OSFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OSFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OSFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (OSFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (OSFS) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (OSFS) MkdirTemp(dir string, pattern string) (string, error) {
+	return os.MkdirTemp(dir, pattern)
+}
+
+func (OSFS) Rename(oldpath string, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+// fsOrOS returns `fsys`, or the operating system's filesystem if it is nil
+func fsOrOS(fsys FS) FS {
+	if fsys == nil {
+		return OSFS{}
+	}
+	return fsys
+}
+
+// pathExists returns true if `name` exists in `fsys`
+func pathExists(fsys FS, name string) bool {
+	_, err := fsOrOS(fsys).Stat(name)
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+// createFile creates or truncates `name` in `fsys`
+func createFile(fsys FS, name string) (File, error) {
+	return fsOrOS(fsys).OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+// writeFileAtomic writes the file via a temp file in the same directory so
+// readers never see a partially written file
+func writeFileAtomic(fsys FS, path string, dat []byte) error {
+	fsys = fsOrOS(fsys)
+
+	var tmp string
+	var f File
+	var err error
+	for i := 0; i < 10; i++ {
+		tmp = filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.%d.tmp", filepath.Base(path), rand.Uint32()))
+		f, err = fsys.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !errors.Is(err, fs.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer fsys.Remove(tmp)
+
+	_, err = f.Write(dat)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, path)
+}
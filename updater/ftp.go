@@ -0,0 +1,342 @@
+package updater
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default FTP control port and the login used when the URL has none
+const (
+	ftpDefaultPort       = "21"
+	ftpAnonymousUser     = "anonymous"
+	ftpAnonymousPassword = "anonymous"
+)
+
+// FTPGetFile downloads the file linked by an ftp:// or ftps:// URL in
+// passive mode and writes it to the writer. ftps:// URLs use explicit TLS
+// (AUTH TLS) for the control and data connections, with the TLS config of
+// `client`'s transport if it has one. The user and password are taken from
+// the URL, anonymous is used without them. Like RFC 1738 the path is
+// relative to the login directory, ftp://host/%2Fupdates/widget.wys is
+// /updates/widget.wys. The download is aborted when `ctx` is done.
+func FTPGetFile(ctx context.Context, client *http.Client, URL string, writer io.Writer) error {
+	u, err := url.Parse(URL)
+	if err != nil {
+		return err
+	}
+	if err := ftpGetFile(ctx, client, u, writer); err != nil {
+		return fmt.Errorf("Error downloading \"%s\": %w", u.Redacted(), err)
+	}
+	return nil
+}
+
+// ftpSession is an FTP control connection and its data connections
+type ftpSession struct {
+	host   string
+	conn   net.Conn
+	text   *textproto.Conn
+	tls    *tls.Config // nil for plain FTP
+	dialer *net.Dialer
+
+	mu     sync.Mutex
+	conns  []net.Conn // closed by close
+	closed bool
+}
+
+func ftpGetFile(ctx context.Context, client *http.Client, u *url.URL, writer io.Writer) error {
+	var tlsConfig *tls.Config
+	switch strings.ToLower(u.Scheme) {
+	case "ftp":
+	case "ftps":
+		tlsConfig = ftpTLSConfig(client, u.Hostname())
+	default:
+		return fmt.Errorf("not an FTP URL")
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+	if path == "" {
+		return fmt.Errorf("no file path")
+	}
+
+	// the path and login are sent as commands, a line break would start
+	// another command
+	if !isFTPArg(path) {
+		return fmt.Errorf("invalid character in file path")
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		if !isFTPArg(u.User.Username()) || !isFTPArg(password) {
+			return fmt.Errorf("invalid character in user or password")
+		}
+	}
+
+	timeout := time.Second * TimeoutClient
+	if client != nil && client.Timeout > 0 {
+		timeout = client.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	port := u.Port()
+	if port == "" {
+		port = ftpDefaultPort
+	}
+	s := &ftpSession{
+		host:   u.Hostname(),
+		tls:    tlsConfig,
+		dialer: &net.Dialer{Timeout: time.Second * TimeoutDial},
+	}
+	defer s.close()
+
+	// closing the connections unblocks reads and writes once `ctx` is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.close()
+		case <-done:
+		}
+	}()
+
+	conn, err := s.dial(ctx, port)
+	if err != nil {
+		return s.ctxErr(ctx, err)
+	}
+	s.setConn(conn)
+
+	if err := s.login(u); err != nil {
+		return s.ctxErr(ctx, err)
+	}
+	if _, err := s.cmd(2, "TYPE I"); err != nil {
+		return s.ctxErr(ctx, err)
+	}
+
+	data, err := s.passive(ctx)
+	if err != nil {
+		return s.ctxErr(ctx, err)
+	}
+
+	if _, err := s.cmd(1, "RETR %s", path); err != nil {
+		return s.ctxErr(ctx, err)
+	}
+	if _, err := io.Copy(writer, &ctxReader{ctx: ctx, r: data}); err != nil {
+		return s.ctxErr(ctx, err)
+	}
+	// the server confirms the transfer on the control connection
+	data.Close()
+	if _, _, err := s.text.ReadResponse(2); err != nil {
+		return s.ctxErr(ctx, err)
+	}
+
+	s.cmd(2, "QUIT")
+	return nil
+}
+
+// ftpTLSConfig returns the TLS config for FTPS to `host`, based on the TLS
+// config of `client`'s transport
+func ftpTLSConfig(client *http.Client, host string) *tls.Config {
+	config := &tls.Config{}
+	if client != nil {
+		if t, ok := client.Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+			config = t.TLSClientConfig.Clone()
+		}
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	// servers commonly require the data connection to resume the control
+	// connection's TLS session
+	if config.ClientSessionCache == nil {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	}
+	return config
+}
+
+// dial connects to `port` on the server, the connection is closed by close
+func (s *ftpSession) dial(ctx context.Context, port string) (net.Conn, error) {
+	conn, err := s.dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		conn.Close()
+		return nil, net.ErrClosed
+	}
+	s.conns = append(s.conns, conn)
+	return conn, nil
+}
+
+// close closes the connections
+func (s *ftpSession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *ftpSession) setConn(conn net.Conn) {
+	s.conn = conn
+	s.text = textproto.NewConn(conn)
+}
+
+// cmd sends a command and reads its reply, which must have a code starting
+// with `expect`
+func (s *ftpSession) cmd(expect int, format string, args ...interface{}) (string, error) {
+	if _, err := s.text.Cmd(format, args...); err != nil {
+		return "", err
+	}
+	_, msg, err := s.text.ReadResponse(expect)
+	return msg, err
+}
+
+// login reads the greeting, secures the control connection for FTPS and
+// logs in
+func (s *ftpSession) login(u *url.URL) error {
+	if _, _, err := s.text.ReadResponse(2); err != nil {
+		return err
+	}
+
+	if s.tls != nil {
+		if _, err := s.cmd(2, "AUTH TLS"); err != nil {
+			return err
+		}
+		conn := tls.Client(s.conn, s.tls)
+		if err := conn.Handshake(); err != nil {
+			return err
+		}
+		s.setConn(conn)
+	}
+
+	user, password := ftpAnonymousUser, ftpAnonymousPassword
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	if _, err := s.text.Cmd("USER %s", user); err != nil {
+		return err
+	}
+	code, _, err := s.text.ReadResponse(0)
+	switch {
+	case err != nil:
+		return err
+	case code == 331:
+		if _, err := s.cmd(2, "PASS %s", password); err != nil {
+			return err
+		}
+	case code/100 != 2:
+		return &textproto.Error{Code: code, Msg: "login failed"}
+	}
+
+	if s.tls != nil {
+		if _, err := s.cmd(2, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, err := s.cmd(2, "PROT P"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// passive opens a data connection in passive mode, with EPSV (RFC 2428)
+// and PASV if the server doesn't support it. The data connection is made
+// to the control connection's host, not the address in the PASV reply,
+// which is often wrong behind NAT.
+func (s *ftpSession) passive(ctx context.Context) (net.Conn, error) {
+	msg, err := s.cmd(2, "EPSV")
+	var port string
+	if err == nil {
+		port, err = parseEPSV(msg)
+	} else {
+		var protoErr *textproto.Error
+		if !errors.As(err, &protoErr) || protoErr.Code/100 != 5 {
+			return nil, err
+		}
+		msg, err = s.cmd(2, "PASV")
+		if err == nil {
+			port, err = parsePASV(msg)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.dial(ctx, port)
+	if err != nil {
+		return nil, err
+	}
+	if s.tls != nil {
+		conn = tls.Client(conn, s.tls)
+	}
+	return conn, nil
+}
+
+// ctxErr returns the error of `ctx` if it is done, the error is then
+// caused by closing the connections
+func (s *ftpSession) ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// isFTPArg returns true if `s` can be sent as the argument of an FTP
+// command, i.e., it has no CR, LF or NUL
+func isFTPArg(s string) bool {
+	return !strings.ContainsAny(s, "\r\n\x00")
+}
+
+// parseEPSV returns the port in an EPSV reply, e.g.,
+// "Entering Extended Passive Mode (|||6446|)"
+func parseEPSV(msg string) (string, error) {
+	start := strings.Index(msg, "(")
+	end := strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("invalid EPSV reply: %s", msg)
+	}
+	fields := strings.Split(msg[start+1:end], "|")
+	if len(fields) != 5 {
+		return "", fmt.Errorf("invalid EPSV reply: %s", msg)
+	}
+	if _, err := strconv.ParseUint(fields[3], 10, 16); err != nil {
+		return "", fmt.Errorf("invalid EPSV reply: %s", msg)
+	}
+	return fields[3], nil
+}
+
+// parsePASV returns the port in a PASV reply, e.g.,
+// "Entering Passive Mode (192,168,1,2,25,46)"
+func parsePASV(msg string) (string, error) {
+	start := strings.Index(msg, "(")
+	end := strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("invalid PASV reply: %s", msg)
+	}
+	fields := strings.Split(msg[start+1:end], ",")
+	if len(fields) != 6 {
+		return "", fmt.Errorf("invalid PASV reply: %s", msg)
+	}
+	hi, err1 := strconv.ParseUint(strings.TrimSpace(fields[4]), 10, 8)
+	lo, err2 := strconv.ParseUint(strings.TrimSpace(fields[5]), 10, 8)
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("invalid PASV reply: %s", msg)
+	}
+	return strconv.FormatUint(hi<<8|lo, 10), nil
+}
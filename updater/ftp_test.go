@@ -0,0 +1,350 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ftpTestServer is an in-process FTP server serving `files` in passive mode
+type ftpTestServer struct {
+	ln       net.Listener
+	files    map[string][]byte
+	user     string // anonymous logins are allowed if empty
+	password string
+	tls      *tls.Config // AUTH TLS is supported if set
+	noEPSV   bool        // EPSV isn't supported
+	onRetr   func()      // called before a file is sent
+	abortAt  int         // if set, the transfer is aborted after this many bytes
+
+	mu       sync.Mutex
+	commands []string
+}
+
+// newFTPTestServer starts an FTP server serving `files`, `configure` is
+// called before the server starts
+func newFTPTestServer(t *testing.T, files map[string][]byte, configure func(s *ftpTestServer)) *ftpTestServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &ftpTestServer{ln: ln, files: files}
+	if configure != nil {
+		configure(s)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// URL returns the URL of `path` on the server
+func (s *ftpTestServer) URL(scheme string, userinfo string, path string) string {
+	if userinfo != "" {
+		userinfo += "@"
+	}
+	return fmt.Sprintf("%s://%s%s/%s", scheme, userinfo, s.ln.Addr().String(), path)
+}
+
+// Commands returns the commands received, without their arguments
+func (s *ftpTestServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.commands...)
+}
+
+func (s *ftpTestServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 ready")
+
+	var user string
+	var loggedIn, protected bool
+	var pasv net.Listener
+	defer func() {
+		if pasv != nil {
+			pasv.Close()
+		}
+	}()
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		cmd = strings.ToUpper(cmd)
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd)
+		s.mu.Unlock()
+
+		switch cmd {
+		case "AUTH":
+			if s.tls == nil || arg != "TLS" {
+				text.PrintfLine("502 not supported")
+				continue
+			}
+			text.PrintfLine("234 ok")
+			conn = tls.Server(conn, s.tls)
+			text = textproto.NewConn(conn)
+		case "USER":
+			user = arg
+			text.PrintfLine("331 password required")
+		case "PASS":
+			if s.user != "" && (user != s.user || arg != s.password) {
+				text.PrintfLine("530 login incorrect")
+				continue
+			}
+			loggedIn = true
+			text.PrintfLine("230 logged in")
+		case "PBSZ":
+			text.PrintfLine("200 ok")
+		case "PROT":
+			protected = arg == "P"
+			text.PrintfLine("200 ok")
+		case "TYPE":
+			text.PrintfLine("200 ok")
+		case "EPSV", "PASV":
+			if cmd == "EPSV" && s.noEPSV {
+				text.PrintfLine("502 not supported")
+				continue
+			}
+			if pasv, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				text.PrintfLine("425 can't open data connection")
+				continue
+			}
+			port := pasv.Addr().(*net.TCPAddr).Port
+			if cmd == "EPSV" {
+				text.PrintfLine("229 Entering Extended Passive Mode (|||%d|)", port)
+			} else {
+				// the address is ignored by the client
+				text.PrintfLine("227 Entering Passive Mode (10,0,0,1,%d,%d)", port>>8, port&0xff)
+			}
+		case "RETR":
+			dat, ok := s.files[arg]
+			switch {
+			case !loggedIn:
+				text.PrintfLine("530 not logged in")
+				continue
+			case pasv == nil:
+				text.PrintfLine("425 use PASV first")
+				continue
+			case !ok:
+				text.PrintfLine("550 %s: no such file", arg)
+				continue
+			}
+			data, err := pasv.Accept()
+			if err != nil {
+				return
+			}
+			if protected {
+				data = tls.Server(data, s.tls)
+			}
+			text.PrintfLine("150 opening data connection")
+			if s.onRetr != nil {
+				s.onRetr()
+			}
+			if s.abortAt > 0 && s.abortAt < len(dat) {
+				data.Write(dat[:s.abortAt])
+				data.Close()
+				pasv.Close()
+				pasv = nil
+				text.PrintfLine("426 connection closed; transfer aborted")
+				continue
+			}
+			data.Write(dat)
+			data.Close()
+			pasv.Close()
+			pasv = nil
+			text.PrintfLine("226 transfer complete")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestFTP_FTPGetFile(t *testing.T) {
+	s := newFTPTestServer(t, map[string][]byte{"updates/widget.wys": []byte("wys")}, nil)
+
+	var buf bytes.Buffer
+	err := DownloadFileToWriter(context.Background(), nil, []string{s.URL("ftp", "", "updates/widget.wys")}, &buf, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "wys", buf.String())
+	assert.Equal(t, []string{"USER", "PASS", "TYPE", "EPSV", "RETR", "QUIT"}, s.Commands())
+
+	// missing file
+	err = FTPGetFile(context.Background(), nil, s.URL("ftp", "", "updates/missing.wys"), &buf)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "550")
+}
+
+func TestFTP_FTPGetFile_credentials(t *testing.T) {
+	s := newFTPTestServer(t, map[string][]byte{"widget.wys": []byte("wys")}, func(s *ftpTestServer) {
+		s.user = "widget"
+		s.password = "s3cret"
+	})
+
+	var buf bytes.Buffer
+	assert.Nil(t, FTPGetFile(context.Background(), nil, s.URL("ftp", "widget:s3cret", "widget.wys"), &buf))
+	assert.Equal(t, "wys", buf.String())
+
+	// anonymous
+	err := FTPGetFile(context.Background(), nil, s.URL("ftp", "", "widget.wys"), &buf)
+	assert.NotNil(t, err)
+
+	// the password isn't in the error
+	err = FTPGetFile(context.Background(), nil, s.URL("ftp", "widget:wrong", "widget.wys"), &buf)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "530")
+	assert.NotContains(t, err.Error(), "wrong")
+}
+
+func TestFTP_FTPGetFile_PASV(t *testing.T) {
+	s := newFTPTestServer(t, map[string][]byte{"widget.wys": []byte("wys")}, func(s *ftpTestServer) {
+		s.noEPSV = true
+	})
+
+	var buf bytes.Buffer
+	assert.Nil(t, FTPGetFile(context.Background(), nil, s.URL("ftp", "", "widget.wys"), &buf))
+	assert.Equal(t, "wys", buf.String())
+	assert.Equal(t, []string{"USER", "PASS", "TYPE", "EPSV", "PASV", "RETR", "QUIT"}, s.Commands())
+}
+
+func TestFTP_FTPGetFile_FTPS(t *testing.T) {
+	// the httptest server's certificate and a client trusting it
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	s := newFTPTestServer(t, map[string][]byte{"widget.wys": []byte("wys")}, func(s *ftpTestServer) {
+		s.tls = ts.TLS
+	})
+
+	var buf bytes.Buffer
+	assert.Nil(t, FTPGetFile(context.Background(), ts.Client(), s.URL("ftps", "", "widget.wys"), &buf))
+	assert.Equal(t, "wys", buf.String())
+	assert.Equal(t, []string{"AUTH", "USER", "PASS", "PBSZ", "PROT", "TYPE", "EPSV", "RETR", "QUIT"}, s.Commands())
+
+	// the certificate isn't trusted
+	err := FTPGetFile(context.Background(), nil, s.URL("ftps", "", "widget.wys"), &buf)
+	assert.NotNil(t, err)
+
+	// the server doesn't support TLS
+	plain := newFTPTestServer(t, map[string][]byte{"widget.wys": []byte("wys")}, nil)
+	err = FTPGetFile(context.Background(), ts.Client(), plain.URL("ftps", "", "widget.wys"), &buf)
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"AUTH"}, plain.Commands())
+}
+
+func TestFTP_FTPGetFile_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stall := make(chan struct{})
+	defer close(stall)
+	s := newFTPTestServer(t, map[string][]byte{"widget.wys": []byte("wys")}, func(s *ftpTestServer) {
+		s.onRetr = func() {
+			cancel()
+			<-stall
+		}
+	})
+
+	var buf bytes.Buffer
+	err := FTPGetFile(ctx, nil, s.URL("ftp", "", "widget.wys"), &buf)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestFTP_FTPGetFile_injection(t *testing.T) {
+	s := newFTPTestServer(t, map[string][]byte{"widget.wys": []byte("wys")}, nil)
+
+	// line breaks in the URL would send other commands
+	var buf bytes.Buffer
+	for _, u := range []string{
+		s.URL("ftp", "", "widget.wys%0D%0ADELE%20widget.wys"),
+		s.URL("ftp", "", "widget.wys%00"),
+		s.URL("ftp", "widget%0D%0ADELE%20widget.wys:s3cret", "widget.wys"),
+		s.URL("ftp", "widget:s3cret%0AQUIT", "widget.wys"),
+	} {
+		err := FTPGetFile(context.Background(), nil, u, &buf)
+		assert.NotNil(t, err, u)
+		assert.Contains(t, err.Error(), "invalid character")
+		assert.NotContains(t, err.Error(), "s3cret")
+	}
+	assert.Empty(t, s.Commands())
+}
+
+func TestFTP_DownloadFileToWriter_aborted(t *testing.T) {
+	aborted := newFTPTestServer(t, map[string][]byte{"widget.wys": []byte("widget wys")}, func(s *ftpTestServer) {
+		s.abortAt = 3
+	})
+	s := newFTPTestServer(t, map[string][]byte{"widget.wys": []byte("widget wys")}, nil)
+
+	// the partial content of the aborted transfer isn't kept
+	var buf bytes.Buffer
+	urls := []string{aborted.URL("ftp", "", "widget.wys"), s.URL("ftp", "", "widget.wys")}
+	assert.Nil(t, DownloadFileToWriter(context.Background(), nil, urls, &buf, nil))
+	assert.Equal(t, "widget wys", buf.String())
+}
+
+func TestFTP_parsePassive(t *testing.T) {
+	port, err := parseEPSV("Entering Extended Passive Mode (|||6446|)")
+	assert.Nil(t, err)
+	assert.Equal(t, "6446", port)
+	_, err = parseEPSV("Entering Extended Passive Mode (|||x|)")
+	assert.NotNil(t, err)
+	_, err = parseEPSV("Entering Extended Passive Mode")
+	assert.NotNil(t, err)
+
+	port, err = parsePASV("Entering Passive Mode (192,168,1,2,25,46)")
+	assert.Nil(t, err)
+	assert.Equal(t, "6446", port)
+	_, err = parsePASV("Entering Passive Mode (192,168,1,2,25)")
+	assert.NotNil(t, err)
+	_, err = parsePASV("Entering Passive Mode (192,168,1,2,256,46)")
+	assert.NotNil(t, err)
+}
+
+func TestFTP_Updater(t *testing.T) {
+	wys, err := os.ReadFile("./testdata/widgetX.1.0.1.wys")
+	assert.Nil(t, err)
+	wyu, err := os.ReadFile("./testdata/widgetX.1.0.1.wyu")
+	assert.Nil(t, err)
+	s := newFTPTestServer(t, map[string][]byte{"widget.wys": wys, "widget.wyu": wyu}, func(s *ftpTestServer) {
+		s.user = "widget"
+		s.password = "s3cret"
+	})
+
+	m, instDir, _, _ := updaterTestMemInstall(t)
+	u := NewUpdater(
+		WithArgs(Args{
+			WYSTestServer: s.URL("ftp", "widget:s3cret", "widget.wys"),
+			WYUTestServer: s.URL("ftp", "widget:s3cret", "widget.wyu"),
+		}),
+		WithInstallDir(instDir),
+		WithServiceController(&fakeServices{}),
+		WithFS(m),
+	)
+
+	result, err := u.Update(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, result.ExitCode)
+	assert.Equal(t, "1.0.1", readMemFile(t, m, filepath.Join(instDir, "WidgetX.txt")))
+}
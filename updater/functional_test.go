@@ -1,6 +1,7 @@
 package updater
 
 import (
+	"context"
 	"crypto/rsa"
 	"fmt"
 	"io/ioutil"
@@ -92,7 +93,7 @@ func TestFunctional_SameVersion(t *testing.T) {
 	uri := fixupTestURL(string(iuc.IucServerFileSite[0].Value), tsWYS.URL)
 
 	fp := fmt.Sprintf("%s/wys", tmpDir)
-	err = DownloadFileToDisk([]string{uri}, fp)
+	err = DownloadFileToDisk(context.Background(), nil, []string{uri}, fp, nil)
 	assert.Nil(t, err)
 
 	wys, err := info.ParseWYSFromFilePath(fp, args)
@@ -148,7 +149,7 @@ func TestFunctional_URLArgs(t *testing.T) {
 	turi := fixupTestURL(urls[0], tsWYS.URL)
 
 	fp := fmt.Sprintf("%s/wys", tmpDir)
-	err = DownloadFileToDisk([]string{turi}, fp)
+	err = DownloadFileToDisk(context.Background(), nil, []string{turi}, fp, nil)
 	assert.Nil(t, err)
 
 	wys, err := info.ParseWYSFromFilePath(fp, args)
@@ -164,7 +165,7 @@ func TestFunctional_URLArgs(t *testing.T) {
 
 	// download wyu
 	fp = fmt.Sprintf("%s/wyu", tmpDir)
-	err = DownloadFileToDisk([]string{turi}, fp)
+	err = DownloadFileToDisk(context.Background(), nil, []string{turi}, fp, nil)
 	assert.Nil(t, err)
 }
 
@@ -212,7 +213,7 @@ func TestFunctional_UpdateWithRollback(t *testing.T) {
 	turi := fixupTestURL(urls[0], tsWYS.URL)
 
 	fp := filepath.Join(tmpDir, "wys")
-	err = DownloadFileToDisk([]string{turi}, fp)
+	err = DownloadFileToDisk(context.Background(), nil, []string{turi}, fp, nil)
 	assert.Nil(t, err)
 
 	wys, err := info.ParseWYSFromFilePath(fp, args)
@@ -228,7 +229,7 @@ func TestFunctional_UpdateWithRollback(t *testing.T) {
 
 	// download wyu
 	fp = filepath.Join(tmpDir, "wyu")
-	err = DownloadFileToDisk([]string{turi}, fp)
+	err = DownloadFileToDisk(context.Background(), nil, []string{turi}, fp, nil)
 	assert.Nil(t, err)
 
 	key, err := ParsePublicKey(string(iuc.IucPublicKey.Value))
@@ -250,10 +251,10 @@ func TestFunctional_UpdateWithRollback(t *testing.T) {
 	}
 
 	// extract wyu to tmpDir
-	_, files, err := Unzip(fp, tmpDir)
+	_, files, err := Unzip(OSFS{}, fp, tmpDir)
 	assert.Nil(t, err)
 
-	udt, updates, err := GetUpdateDetails(files)
+	udt, updates, err := GetUpdateDetails(OSFS{}, files)
 	assert.Nil(t, err)
 
 	// the udt should specify stopping/starting the Spooler
@@ -264,12 +265,12 @@ func TestFunctional_UpdateWithRollback(t *testing.T) {
 	err = ioutil.WriteFile(path.Join(instDir, "WidgetX.txt"), []byte("1.0.0"), 0644)
 	assert.Nil(t, err)
 
-	backupDir, err := BackupFiles(updates, instDir)
+	backupDir, err := BackupFiles(OSFS{}, updates, instDir)
 	assert.Nil(t, err)
 
 	udt.ServiceToStopBeforeUpdate = []TLV{}
 	udt.ServiceToStartAfterUpdate = []TLV{}
-	err = InstallUpdate(udt, updates, instDir)
+	err = InstallUpdate(context.Background(), OSFS{}, udt, updates, instDir, nil, nil)
 	assert.Nil(t, err)
 
 	// read our "update"
@@ -278,7 +279,7 @@ func TestFunctional_UpdateWithRollback(t *testing.T) {
 	assert.Equal(t, "1.0.1", string(dat))
 
 	// rollback
-	err = RollbackFiles(backupDir, instDir)
+	err = RollbackFiles(OSFS{}, backupDir, instDir)
 	assert.Nil(t, err)
 
 	// original file should be restored
@@ -1,12 +1,17 @@
 package updater
 
 import (
+	"context"
 	"crypto/rsa"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 // Infoer interface used to make testing easier
@@ -17,91 +22,185 @@ type Infoer interface {
 }
 
 // Info struct for the Infoer interface
-type Info struct{}
+type Info struct {
+	// FS is the filesystem the WYC and WYS files are read from. The
+	// operating system's filesystem is used if it is nil.
+	FS FS
+}
 
 // Handler is the "main" called by cmd/main.go
 func Handler() int {
+	result := Result{StartTime: time.Now()}
+
 	args, err := ParseArgs(os.Args)
+
+	// log even if some of the arguments are bad, the log file may be fine
+	logger, e := NewLoggerFromArgs(args)
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+	}
+	defer logger.Close()
+	args.Logger = logger
+
+	events, e := NewEventSinkFromArgs(args)
+	if e != nil {
+		// events are nice to have, don't fail the update over them
+		logger.Warnf("%v", e)
+	}
+	if events != nil {
+		defer events.Close()
+		args.Events = events
+	}
+
 	if err != nil {
-		if args.Debug {
-			log.Println(err.Error())
+		logger.Errorf("%v", err)
+		err = withError(ErrConfig, err)
+		rc := exitCode(args, EXIT_ERROR, err)
+		result.finish(args.clock(), rc, err)
+		outputResult(args, result, err.Error())
+		return rc
+	}
+
+	// run until stopped, checking for updates on a schedule. The service
+	// takes the update lock for each check instead of holding it.
+	if args.Service {
+		logger.Infof("Starting updater service...")
+
+		rc, err := ServiceHandler(Info{}, args)
+		if err != nil {
+			logger.Errorf("%v", err)
+			LogOutputInfoMsg(args, err.Error())
 		}
-		LogErrorMsg(args, err.Error())
-		LogOutputInfoMsg(args, err.Error())
-		return EXIT_ERROR
+		return rc
 	}
 
+	// interrupting the updater stops the update, rolling back what was
+	// installed
+	u := NewUpdater(WithArgs(args))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var msg string
+	switch {
 	// check for updates
-	info := Info{}
-	if args.Quickcheck && args.Justcheck {
+	case args.Quickcheck && args.Justcheck:
 		// Quickcheck
-		if args.Debug {
-			log.Println("Quick Check and Just Check checking for Updates...")
+		logger.Debugf("Quick Check and Just Check checking for Updates...")
+
+		result, err = u.Check(ctx)
+		if err == nil {
+			// wyUpdate reports the version
+			msg = result.checkedVersion()
 		}
 
-		rc, err := CheckForUpdateHandler(info, args)
-		if nil != err {
-			if args.Debug {
-				log.Println(err.Error())
-			}
-			LogErrorMsg(args, err.Error())
-			LogOutputInfoMsg(args, err.Error())
+		switch result.ExitCode {
+		case EXIT_NO_UPDATE:
+			logger.Infof("No update available, version %s is installed", result.InstalledVersion)
+		case EXIT_UPDATE_AVALIABLE:
+			logger.Infof("Update available, version %s is installed, version %s is available", result.InstalledVersion, result.AvailableVersion)
 		}
+		// End Quickcheck
 
-		if args.Debug {
-			switch rc {
-			case EXIT_NO_UPDATE:
-				log.Println("No update available")
-			case EXIT_UPDATE_AVALIABLE:
-				log.Println("Update available")
-			}
+	// show what the update would do, the plan is output even without
+	// /outputinfo
+	case args.Dryrun:
+		logger.Infof("Dry run...")
+
+		result, err = u.DryRun(ctx)
+		args.Outputinfo = true
+		if result.Plan != nil {
+			msg = result.Plan.String()
 		}
 
-		// End Quickcheck
-		return rc
-	}
+	// download and verify the update, but don't install it
+	case args.Stage:
+		logger.Infof("Staging update...")
 
-	// update
-	if args.Fromservice {
-		if args.Debug {
-			log.Println("Updating...")
+		result, err = u.Stage(ctx)
+
+		if result.ExitCode == 0 && err == nil {
+			logger.Infof("Staging successful")
 		}
 
-		rc, err := UpdateHandler(info, (args))
-		if err != nil {
-			if args.Debug {
-				log.Println(err.Error())
-			}
-			LogErrorMsg(args, err.Error())
-			LogOutputInfoMsg(args, err.Error())
+	// install a previously staged update (no network access)
+	case args.Applystaged:
+		logger.Infof("Applying staged update...")
+
+		result, err = u.ApplyStaged(ctx)
+
+		if result.ExitCode == 0 && err == nil {
+			logger.Infof("Update to version %s successful", result.AvailableVersion)
 		}
 
-		if args.Debug && rc == 0 {
-			log.Println("Update successful")
+	// allow an update that failed to install to be tried again
+	case args.Clearfailed:
+		logger.Infof("Clearing failed install...")
+
+		result, err = u.ClearFailed(ctx)
+
+	// restore a previous version
+	case args.Rollback:
+		logger.Infof("Rolling back...")
+
+		result, err = u.Rollback(ctx, args.RollbackVersion)
+
+		if result.ExitCode == 0 && err == nil {
+			logger.Infof("Rollback to version %s successful", result.AvailableVersion)
 		}
-		return rc
+
+	// update
+	case args.Fromservice:
+		logger.Infof("Updating...")
+
+		result, err = u.Update(ctx)
+
+		if result.ExitCode == 0 && err == nil {
+			logger.Infof("Update to version %s successful", result.AvailableVersion)
+		}
+
+	default:
+		return EXIT_ERROR
 	}
 
-	return EXIT_ERROR
+	if err != nil {
+		logger.Errorf("%v", err)
+		msg = err.Error()
+	}
+
+	outputResult(args, result, msg)
+	return result.ExitCode
 }
 
 // UpdateHandler performs the update. Returns int exit code and error.
 func UpdateHandler(infoer Infoer, args Args) (int, error) {
-	candidateUpdateReq, err := NewCandidateUpdateRequest(args, infoer)
+	var result Result
+	return update(context.Background(), infoer, args, &result)
+}
+
+// update performs the update, filling in the details of the update in
+// `result`. Returns int exit code and error.
+func update(ctx context.Context, infoer Infoer, args Args, result *Result) (rc int, err error) {
+	defer func() { emitOutcome(args, result, rc, err) }()
+
+	result.Phase = PHASE_CHECK
+	candidateUpdateReq, err := NewCandidateUpdateRequest(ctx, args, infoer)
 	if err != nil {
 		return EXIT_ERROR, err
 	}
+	result.setCandidate(candidateUpdateReq)
+	emitEvent(args, EVENT_UPDATE_STARTED, "updating from version %s to %s", result.InstalledVersion, result.AvailableVersion)
 
-	tmpDir, err := CreateTempDir()
+	fsys := args.fs()
+	tmpDir, err := createTempDir(fsys, args.instDir())
 	if nil != err {
 		err = fmt.Errorf("failed to create temp dir; %w", err)
 		return EXIT_ERROR, err
 	}
-	defer DeleteDirectory(tmpDir)
+	defer DeleteDirectory(fsys, tmpDir)
 
 	// write the contents of the wys file to disk (contains details about the available update)
 	wysFilePath := filepath.Join(tmpDir, "wys")
-	err = os.WriteFile(wysFilePath, candidateUpdateReq.CandidateWysFileContent.Bytes(), 0644)
+	err = fsys.WriteFile(wysFilePath, candidateUpdateReq.CandidateWysFileContent.Bytes(), 0644)
 	if err != nil {
 		err = fmt.Errorf("failed to write WYS file to: %v; %w", wysFilePath, err)
 		return EXIT_ERROR, err
@@ -110,114 +209,335 @@ func UpdateHandler(infoer Infoer, args Args) (int, error) {
 	// download WYU (this is the archive with the updated files)
 	wys := candidateUpdateReq.ConfigWYS
 	wyuFilePath := filepath.Join(tmpDir, "wyu")
-	if err := wys.getWyuFile(args, wyuFilePath); err != nil {
+	args.Logger.Infof("Downloading version %s", wys.VersionToUpdate)
+	result.Phase = PHASE_DOWNLOAD
+	start := args.clock().Now()
+	downloaded, err := wys.getWyuFile(ctx, args, wyuFilePath)
+	if err != nil {
 		return EXIT_ERROR, err
 	}
+	if downloaded > 0 {
+		result.addDownload(downloaded, args.clock().Now().Sub(start))
+	}
 
 	iuc := candidateUpdateReq.ConfigIUC
-	if iuc.IucPublicKey.Value != nil {
-		if len(wys.FileSha1) == 0 {
-			err = fmt.Errorf("The update is not signed. All updates must be signed in order to be installed.")
-			return EXIT_ERROR, err
-		}
+	result.Phase = PHASE_VERIFY
+	if err := verifyWyuSignature(args, iuc, wys, wyuFilePath); err != nil {
+		return EXIT_ERROR, err
+	}
 
-		// convert the public key from the WYC file to an rsa.PublicKey
-		key, err := ParsePublicKey(string(iuc.IucPublicKey.Value))
-		var rsa rsa.PublicKey
-		rsa.N = key.Modulus
-		rsa.E = key.Exponent
+	// extract the WYU to tmpDir
+	_, files, err := Unzip(fsys, wyuFilePath, tmpDir)
+	if nil != err {
+		err = fmt.Errorf("error unzipping %s; %w", wyuFilePath, err)
+		return EXIT_ERROR, withError(ErrVerification, err)
+	}
 
-		// hash the downloaded WYU file
-		sha1hash, err := GenerateSHA1HashFromFilePath(wyuFilePath)
-		if nil != err {
-			err = fmt.Errorf("The downloaded file \"%s\" failed the signature validation: %w", wyuFilePath, err)
-			return EXIT_ERROR, err
-		}
+	return applyUpdate(ctx, args, iuc, wys.VersionToUpdate, files, wysFilePath, result)
+}
 
-		// verify the signature of the WYU file (the signed hash is included in the WYS file)
-		err = VerifyHash(&rsa, sha1hash, wys.FileSha1)
-		if nil != err {
-			err = fmt.Errorf("The downloaded file \"%s\" is not signed. %w", wyuFilePath, err)
-			return EXIT_ERROR, err
-		}
+// verifyWyuSignature verifies the downloaded WYU file against the signed
+// hash in the WYS file when the WYC file contains a public key
+func verifyWyuSignature(args Args, iuc ConfigIUC, wys ConfigWYS, wyuFilePath string) error {
+	err := checkWyuSignature(args.fs(), iuc, wys, wyuFilePath)
+	if errors.Is(err, ErrSignature) {
+		emitEvent(args, EVENT_SIGNATURE_FAILED, "version %s failed signature verification; %v", wys.VersionToUpdate, err)
 	}
+	return err
+}
 
-	// extract the WYU to tmpDir
-	_, files, err := Unzip(wyuFilePath, tmpDir)
+// checkWyuSignature does the verification for verifyWyuSignature
+func checkWyuSignature(fsys FS, iuc ConfigIUC, wys ConfigWYS, wyuFilePath string) error {
+	if iuc.IucPublicKey.Value == nil {
+		return nil
+	}
+
+	if len(wys.FileSha1) == 0 {
+		err := fmt.Errorf("The update is not signed. All updates must be signed in order to be installed.")
+		return withError(ErrSignature, err)
+	}
+
+	// convert the public key from the WYC file to an rsa.PublicKey
+	key, err := ParsePublicKey(string(iuc.IucPublicKey.Value))
 	if nil != err {
-		err = fmt.Errorf("error unzipping %s; %w", wyuFilePath, err)
-		return EXIT_ERROR, err
+		err = fmt.Errorf("error parsing public key; %w", err)
+		return withError(ErrConfig, err)
+	}
+	var rsa rsa.PublicKey
+	rsa.N = key.Modulus
+	rsa.E = key.Exponent
+
+	// hash the downloaded WYU file
+	sha1hash, err := generateSHA1HashFromFile(fsys, wyuFilePath)
+	if nil != err {
+		err = fmt.Errorf("The downloaded file \"%s\" failed the signature validation: %w", wyuFilePath, err)
+		return withError(ErrSignature, err)
 	}
 
+	// verify the signature of the WYU file (the signed hash is included in the WYS file)
+	err = VerifyHash(&rsa, sha1hash, wys.FileSha1)
+	if nil != err {
+		err = fmt.Errorf("The downloaded file \"%s\" is not signed. %w", wyuFilePath, err)
+		return withError(ErrSignature, err)
+	}
+
+	return nil
+}
+
+// applyUpdate installs the files extracted from a WYU archive into the
+// install directory, running the hooks in the archive and verifying the
+// services are healthy afterwards. It rolls back on failure. On success the
+// WYC file is updated with the new version number and the installed files
+// are recorded in `result`. If `ctx` is done before the update is installed
+// the install stops and what was installed is rolled back, the rollback
+// itself isn't cancelled.
+func applyUpdate(ctx context.Context, args Args, iuc ConfigIUC, version string, files []string, wysFilePath string, result *Result) (int, error) {
 	// get the details of the update
 	// the update "config" is "updtdetails.udt"
 	// the "files" are the updated files
-	udt, updates, err := GetUpdateDetails(files)
+	fsys := args.fs()
+	udt, updates, err := GetUpdateDetails(fsys, files)
 	if nil != err {
-		return EXIT_ERROR, err
+		return EXIT_ERROR, withError(ErrVerification, err)
 	}
 
-	// backup the existing files that will be overwritten by the update
-	instDir := GetExeDir()
-	backupDir, err := BackupFiles(updates, instDir)
-	defer DeleteDirectory(backupDir)
+	hooks, err := LoadHooks(fsys, files)
 	if nil != err {
-		// Errors from rollback may occur from missing expected files - ignore
-		RollbackFiles(backupDir, instDir)
-		return EXIT_ERROR, err
+		return EXIT_ERROR, withError(ErrVerification, err)
 	}
 
-	// TODO is there a way to clean this up
-	err = InstallUpdate(udt, updates, instDir)
+	// nothing has changed yet, a failed pre-install hook just stops the update
+	instDir := args.instDir()
+	result.Phase = PHASE_INSTALL
+	if err := hooks.Run(ctx, args, HOOK_PRE_INSTALL, instDir); err != nil {
+		return EXIT_ERROR, withError(ErrInstall, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return EXIT_ERROR, fmt.Errorf("update cancelled; %w", err)
+	}
+
+	result.Phase = PHASE_BACKUP
+
+	// backup the existing files that will be overwritten by the update, the
+	// backup is kept so the update can be rolled back later (/rollback)
+	installedVersion := string(iuc.IucInstalledVersion.Value)
+	args.Logger.Debugf("Backing up %d files in %s", len(updates), instDir)
+	backup, err := CreateBackup(fsys, instDir, args.Cdata, installedVersion, version, updates, udt, args.clock().Now())
 	if nil != err {
-		err = fmt.Errorf("error applying update; %w", err)
-		// TODO rollback should restore client.wyc
-		RollbackFiles(backupDir, instDir)
+		return EXIT_ERROR, withError(ErrInstall, err)
+	}
 
-		err = os.Rename(wysFilePath, filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME))
-		if err != nil {
-			err = fmt.Errorf("error renaming %s to failed install sentinel; %w", wysFilePath, err)
+	// TODO is there a way to clean this up
+	args.Logger.Infof("Installing version %s", version)
+	result.Phase = PHASE_INSTALL
+	err = InstallUpdate(ctx, fsys, udt, updates, instDir, args.services(), args.Logger)
+	if nil == err {
+		err = hooks.Run(ctx, args, HOOK_POST_INSTALL, instDir)
+		if nil == err {
+			result.Phase = PHASE_HEALTH
+			err = withError(ErrHealthCheck, VerifyUpdate(ctx, args, udt))
+			if nil != err && !isCancelled(err) {
+				emitEvent(args, EVENT_HEALTH_FAILED, "version %s failed verification; %v", version, err)
+			}
+		}
+		if nil != err {
+			// the new files may be in use
+			stopServices(args, udt)
 		}
+	}
+	if nil != err {
+		err = fmt.Errorf("error applying update; %w", err)
+		err = rollbackUpdate(args, udt, hooks, backup, instDir, version, wysFilePath, err, result)
+		return EXIT_ERROR, withError(ErrInstall, err)
+	}
 
-		// start services, best effort
+	if len(udt.ServiceToStartAfterUpdate) > 0 {
+		var services []string
 		for _, s := range udt.ServiceToStartAfterUpdate {
-			svc := ValueToString(&s)
-			_ = StartService(svc)
+			services = append(services, ValueToString(&s))
 		}
-		return EXIT_ERROR, err
+		emitEvent(args, EVENT_SERVICES_RESTARTED, "restarted services after update: %s", strings.Join(services, ", "))
 	}
 
+	args.Logger.Infof("Installed %d files", len(updates))
+	for _, f := range updates {
+		result.FilesChanged = append(result.FilesChanged, filepath.Base(f))
+	}
+
+	result.Phase = PHASE_COMPLETE
+
 	// we haven't erred, write latest version number and exit
 	// Newest version is recorded and we wipe out all temp files
-	UpdateWYCWithNewVersionNumber(iuc, args.Cdata, wys.VersionToUpdate)
+	if err := writeNewVersionNumber(fsys, iuc, args.Cdata, version); err != nil {
+		args.Logger.Warnf("failed to record version %s in %s; %v", version, args.Cdata, err)
+	}
+
+	if err := ClearFailedInstall(fsys, instDir); err != nil {
+		args.Logger.Warnf("failed to remove failed install sentinel; %v", err)
+	}
+
+	if args.Keepbackups > 0 {
+		if err := PruneBackups(fsys, instDir, args.Keepbackups); err != nil {
+			args.Logger.Warnf("failed to remove old backups; %v", err)
+		}
+	} else {
+		DeleteDirectory(fsys, backup.Dir())
+	}
 	return EXIT_SUCCESS, nil
 }
 
+// writeNewVersionNumber replaces the WYC file with one recording `version`
+// as the installed version
+func writeNewVersionNumber(fsys FS, iuc ConfigIUC, wycFilePath string, version string) error {
+	fsys = fsOrOS(fsys)
+	orig, err := fsys.ReadFile(wycFilePath)
+	if err != nil {
+		return err
+	}
+
+	dat, err := wycWithNewVersionNumber(iuc, orig, version)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fsys, wycFilePath, dat)
+}
+
+// rollbackUpdate restores the backed up files after a failed install, marks
+// the update as failed (so it isn't retried), runs the post-rollback hooks
+// and starts the services again. Returns `err` with any rollback errors
+// added. A cancelled update isn't marked as failed. The rollback runs to
+// completion even though the update's context is done.
+func rollbackUpdate(args Args, udt ConfigUDT, hooks Hooks, backup BackupManifest, instDir string, version string, wysFilePath string, err error, result *Result) error {
+	args.Logger.Errorf("%v; rolling back", err)
+
+	// the WYC file isn't changed until the update succeeds and the backup
+	// of the failed update isn't needed once it is restored. A backup that
+	// isn't fully restored is kept, it has the only copy of the files that
+	// weren't restored.
+	result.Rollback = ROLLBACK_SUCCEEDED
+	fsys := args.fs()
+	e := backup.RestoreFiles(fsys, instDir)
+	if e != nil {
+		err = withError(ErrRollbackFailed, fmt.Errorf("%w; error restoring backup, the backup is kept in %s; %v", err, backup.Dir(), e))
+		result.Rollback = ROLLBACK_FAILED
+		result.KeptBackups = append(result.KeptBackups, backup.Dir())
+		emitEvent(args, EVENT_ROLLBACK_PERFORMED, "rolled back failed update to version %s with errors; %v", version, e)
+	} else {
+		DeleteDirectory(fsys, backup.Dir())
+		emitEvent(args, EVENT_ROLLBACK_PERFORMED, "rolled back failed update to version %s", version)
+	}
+
+	// the update isn't retried until the retry backoff has passed
+	if !isCancelled(err) {
+		record, e := recordFailedInstall(fsys, instDir, wysFilePath, version, err, args.clock().Now())
+		if e != nil {
+			err = fmt.Errorf("%w; error recording failed install; %v", err, e)
+		}
+		result.FailedInstall = &record
+	}
+
+	// the update already failed, the policy doesn't matter
+	ctx := context.Background()
+	hooks.Run(ctx, args, HOOK_POST_ROLLBACK, instDir)
+
+	// start services, best effort
+	var started []string
+	for _, s := range udt.ServiceToStartAfterUpdate {
+		svc := ValueToString(&s)
+		if args.services().StartService(ctx, svc, args.Logger) == nil {
+			started = append(started, svc)
+		}
+	}
+	if len(started) > 0 {
+		emitEvent(args, EVENT_SERVICES_RESTARTED, "restarted services after rollback: %s", strings.Join(started, ", "))
+	}
+
+	return err
+}
+
+// stopServices stops the services that are stopped before an update, best
+// effort. It is used to roll back, which isn't cancelled.
+func stopServices(args Args, udt ConfigUDT) {
+	for _, s := range udt.ServiceToStopBeforeUpdate {
+		svc := ValueToString(&s)
+		if exists, _ := args.services().DoesServiceExist(svc); exists {
+			args.services().StopService(context.Background(), svc, args.Logger)
+		}
+	}
+}
+
+// recordedRun runs one of the handlers and records the result. It is used by
+// the scheduler so each cycle is recorded like a run from the command line.
+func recordedRun(ctx context.Context, infoer Infoer, args Args, action string, handler func(context.Context, Infoer, Args, *Result) (int, error)) (int, error) {
+	result := Result{Action: action, StartTime: args.clock().Now()}
+	rc, err := handler(ctx, infoer, args, &result)
+	result.finish(args.clock(), exitCode(args, rc, err), err)
+	recordResult(ctx, args, result)
+	return rc, err
+}
+
+// recordResult sends the status report and writes the metrics for a
+// finished run. Failures are logged, they don't fail the run.
+func recordResult(ctx context.Context, args Args, result Result) {
+	if err := SendReport(ctx, args, result); err != nil {
+		args.Logger.Warnf("%v", err)
+	}
+	if err := WriteMetrics(args, result); err != nil {
+		args.Logger.Warnf("%v", err)
+	}
+}
+
+// emitOutcome emits the event for how an update ended
+func emitOutcome(args Args, result *Result, rc int, err error) {
+	if rc == EXIT_SUCCESS && err == nil {
+		emitEvent(args, EVENT_UPDATE_SUCCEEDED, "updated from version %s to %s", result.InstalledVersion, result.AvailableVersion)
+		return
+	}
+
+	if err == nil {
+		err = fmt.Errorf("exit code %d", rc)
+	}
+	if len(result.AvailableVersion) == 0 {
+		emitEvent(args, EVENT_UPDATE_FAILED, "update failed; %v", err)
+		return
+	}
+	emitEvent(args, EVENT_UPDATE_FAILED, "update to version %s failed; %v", result.AvailableVersion, err)
+}
+
 // CheckForUpdateHandler checks to see if an update is availible. Returns int
-// exit code and error.
+// exit code and error. Like wyUpdate, the version is returned as the error
+// when no other error occurred.
 func CheckForUpdateHandler(infoer Info, args Args) (int, error) {
-	candidateUpdateReq, err := NewCandidateUpdateRequest(args, infoer)
+	var result Result
+	rc, err := checkForUpdate(context.Background(), infoer, args, &result)
+	if err != nil {
+		return rc, err
+	}
+	return rc, fmt.Errorf(result.checkedVersion())
+}
+
+// checkForUpdate checks to see if an update is availible, filling in the
+// installed and available versions in `result`. Returns int exit code and
+// error.
+func checkForUpdate(ctx context.Context, infoer Infoer, args Args, result *Result) (int, error) {
+	result.Phase = PHASE_CHECK
+	candidateUpdateReq, err := NewCandidateUpdateRequest(ctx, args, infoer)
+	result.setFailedInstall(args)
 	if err != nil {
 		return EXIT_ERROR, err
 	}
+	result.setCandidate(candidateUpdateReq)
+	result.Phase = PHASE_COMPLETE
 
-	iuc := candidateUpdateReq.ConfigIUC
-	wys := candidateUpdateReq.ConfigWYS
 	// compare versions
-	rc := CompareVersions(string(iuc.IucInstalledVersion.Value), wys.VersionToUpdate)
+	rc := CompareVersions(result.InstalledVersion, result.AvailableVersion)
 	switch rc {
 	case A_LESS_THAN_B:
 		// need update
-		err = fmt.Errorf(wys.VersionToUpdate)
-		return EXIT_UPDATE_AVALIABLE, err
-	case A_EQUAL_TO_B:
-		// no update
-		err = fmt.Errorf(wys.VersionToUpdate)
-		return EXIT_NO_UPDATE, err
-	case A_GREATER_THAN_B:
+		return EXIT_UPDATE_AVALIABLE, nil
+	case A_EQUAL_TO_B, A_GREATER_THAN_B:
 		// no update
-		err = fmt.Errorf(string(iuc.IucInstalledVersion.Value))
-		return EXIT_NO_UPDATE, err
+		return EXIT_NO_UPDATE, nil
 	default:
 		// unknown case
 		return EXIT_ERROR, fmt.Errorf("unknown case")
@@ -76,7 +76,7 @@ func TearDown(f string) {
 }
 
 func TestHandler_UpdateHandler_InvalidWYC(t *testing.T) {
-	os.Remove(lastWyuFilePath)
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
 
 	wycFile := "./testdata/foo.wyc"
 	wysFile := "./testdata/widgetX.1.0.1.wys"
@@ -119,7 +119,7 @@ func TestHandler_UpdateHandler_InvalidWYC(t *testing.T) {
 }
 
 func TestHandler_UpdateHandler_download_WYS_error(t *testing.T) {
-	os.Remove(lastWyuFilePath)
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
 
 	wycFile := "./testdata/client.1.0.1.wyc"
 	wysFile := "./testdata/widgetX.1.0.1.wys"
@@ -159,7 +159,7 @@ func TestHandler_UpdateHandler_download_WYS_error(t *testing.T) {
 }
 
 func TestHandler_UpdateHandler_invalid_WYS_error(t *testing.T) {
-	os.Remove(lastWyuFilePath)
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
 
 	wycFile := "./testdata/client.1.0.1.wyc"
 	// wysFile := "./testdata/widgetX.1.0.1.wys"
@@ -195,7 +195,7 @@ func TestHandler_UpdateHandler_invalid_WYS_error(t *testing.T) {
 }
 
 func TestHandler_UpdateHandler_download_WYU_error(t *testing.T) {
-	os.Remove(lastWyuFilePath)
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
 
 	wycFile := "./testdata/client.1.0.1.wyc"
 	wysFile := "./testdata/widgetX.1.0.1.wys"
@@ -235,7 +235,7 @@ func TestHandler_UpdateHandler_download_WYU_error(t *testing.T) {
 }
 
 func TestHandler_UpdateHandler_invalid_WYU_error(t *testing.T) {
-	os.Remove(lastWyuFilePath)
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
 
 	wycFile := "./testdata/client.1.0.1.wyc"
 	wysFile := "./testdata/widgetX.1.0.1.wys"
@@ -274,7 +274,7 @@ func TestHandler_UpdateHandler_invalid_WYU_error(t *testing.T) {
 }
 
 func TestHandler_UpdateHandler_update_not_signed(t *testing.T) {
-	os.Remove(lastWyuFilePath)
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
 
 	wycFile := "./testdata/client.1.0.1.wyc"
 	wysFile := "./testdata/widgetX.1.0.1.wys"
@@ -315,7 +315,7 @@ func TestHandler_UpdateHandler_update_not_signed(t *testing.T) {
 }
 
 func TestHandler_UpdateHandler_signature_verification_error(t *testing.T) {
-	os.Remove(lastWyuFilePath)
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
 
 	wycFile := "./testdata/client.1.0.1.wyc"
 	wysFile := "./testdata/widgetX.1.0.1.wys"
@@ -356,7 +356,7 @@ func TestHandler_UpdateHandler_signature_verification_error(t *testing.T) {
 }
 
 func TestHandler_UpdateHandler_checksum_error(t *testing.T) {
-	os.Remove(lastWyuFilePath)
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
 
 	wycFile := "./testdata/client.1.0.1.wyc"
 	wysFile := "./testdata/widgetX.1.0.1.wys"
@@ -5,15 +5,19 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestHandler_UpdateHandler(t *testing.T) {
-	os.Remove(lastWyuFilePath)
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
 
-	wycFile := "./testdata/client.1.0.1.wyc"
+	// the WYC file is updated with the new version, don't change testdata
+	wycFile := filepath.Join(t.TempDir(), CLIENT_WYC)
+	_, err := CopyFile(OSFS{}, "./testdata/client.1.0.1.wyc", wycFile)
+	assert.Nil(t, err)
 	wysFile := "./testdata/widgetX.1.0.1.wys"
 	wyuFile := "./testdata/widgetX.1.0.1.wyu"
 
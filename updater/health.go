@@ -0,0 +1,118 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Health check defaults
+const (
+	DEFAULT_HEALTH_GRACE   = 10 * time.Second
+	DEFAULT_HEALTH_TIMEOUT = 30 * time.Second
+)
+
+// healthProbeInterval is the time between attempts to probe the health URL
+// or pipe
+var healthProbeInterval = time.Second
+
+// VerifyUpdate checks the update is healthy once the services are started.
+// After the grace period (-healthgrace, 0 checks right away) each service
+// started after the update must still be running, and the health URL
+// (-healthurl) and named pipe (-healthpipe) must respond within
+// -healthtimeout. Nothing is checked if there are no services and no
+// probes. The check stops once `ctx` is done.
+func VerifyUpdate(ctx context.Context, args Args, udt ConfigUDT) error {
+	var services []string
+	for _, s := range udt.ServiceToStartAfterUpdate {
+		svc := ValueToString(&s)
+		if exists, _ := args.services().DoesServiceExist(svc); exists {
+			services = append(services, svc)
+		}
+	}
+
+	if len(services) == 0 && len(args.Healthurl) == 0 && len(args.Healthpipe) == 0 {
+		return nil
+	}
+
+	// give a crashing service time to crash
+	if args.Healthgrace > 0 {
+		args.Logger.Infof("Verifying the update in %v", args.Healthgrace)
+		if err := args.clock().Sleep(ctx, args.Healthgrace); err != nil {
+			return fmt.Errorf("health check cancelled; %w", err)
+		}
+	}
+
+	for _, svc := range services {
+		running, err := args.services().IsServiceRunning(svc)
+		if err != nil {
+			return fmt.Errorf("failed to get the state of service %s; %w", svc, err)
+		}
+		if !running {
+			return fmt.Errorf("service %s is not running", svc)
+		}
+		args.Logger.Debugf("Service %s is running", svc)
+	}
+
+	if len(args.Healthurl) > 0 {
+		err := retryProbe(ctx, args.clock(), args.Healthtimeout, func() error {
+			return probeHealthURL(ctx, args.Healthurl)
+		})
+		if err != nil {
+			return fmt.Errorf("health check %s failed; %w", args.Healthurl, err)
+		}
+		args.Logger.Debugf("Health check %s passed", args.Healthurl)
+	}
+
+	if len(args.Healthpipe) > 0 {
+		err := retryProbe(ctx, args.clock(), args.Healthtimeout, func() error {
+			return probePipe(args.Healthpipe)
+		})
+		if err != nil {
+			return fmt.Errorf("health check of pipe %s failed; %w", args.Healthpipe, err)
+		}
+		args.Logger.Debugf("Health check of pipe %s passed", args.Healthpipe)
+	}
+
+	return nil
+}
+
+// retryProbe calls probe until it succeeds or `timeout` has passed on
+// `clock`, returning the last error, or until `ctx` is done
+func retryProbe(ctx context.Context, clock Clock, timeout time.Duration, probe func() error) error {
+	deadline := clock.Now().Add(timeout)
+	for {
+		err := probe()
+		if err == nil || !clock.Now().Add(healthProbeInterval).Before(deadline) {
+			return err
+		}
+		if e := clock.Sleep(ctx, healthProbeInterval); e != nil {
+			return fmt.Errorf("%v; %w", err, e)
+		}
+	}
+}
+
+// probeHealthURL GETs the URL, any 2xx status is healthy
+func probeHealthURL(ctx context.Context, URL string) error {
+	httpClient := newHTTPClient()
+	httpClient.Timeout = 5 * time.Second
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, URL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &HTTPStatusError{URL: URL, StatusCode: resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package updater
+
+import (
+	"net"
+	"time"
+)
+
+// probePipe connects to the Unix domain socket, the closest thing to a
+// named pipe on other platforms
+func probePipe(name string) error {
+	conn, err := net.DialTimeout("unix", name, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
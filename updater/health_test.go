@@ -0,0 +1,162 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth_VerifyUpdate_nothing_to_check(t *testing.T) {
+	var args Args
+	args.Healthgrace = time.Hour
+
+	// returns without waiting for the grace period
+	assert.Nil(t, VerifyUpdate(context.Background(), args, ConfigUDT{}))
+}
+
+func TestHealth_VerifyUpdate_url(t *testing.T) {
+	healthProbeInterval = 10 * time.Millisecond
+	defer func() { healthProbeInterval = time.Second }()
+
+	// healthy after a couple of tries
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	var args Args
+	args.Healthurl = ts.URL
+	args.Healthtimeout = 5 * time.Second
+
+	assert.Nil(t, VerifyUpdate(context.Background(), args, ConfigUDT{}))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestHealth_VerifyUpdate_url_unhealthy(t *testing.T) {
+	healthProbeInterval = 10 * time.Millisecond
+	defer func() { healthProbeInterval = time.Second }()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	var args Args
+	args.Healthurl = ts.URL
+	args.Healthtimeout = 100 * time.Millisecond
+
+	err := VerifyUpdate(context.Background(), args, ConfigUDT{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Internal Server Error")
+}
+
+func TestHealth_VerifyUpdate_clock(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	// the grace period and the probe retries wait on the updater's clock
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	var args Args
+	args.Clock = clock
+	args.Healthurl = ts.URL
+	args.Healthgrace = time.Minute
+	args.Healthtimeout = 10 * time.Second
+
+	err := VerifyUpdate(context.Background(), args, ConfigUDT{})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Service Unavailable")
+	assert.Equal(t, start.Add(time.Minute+9*time.Second), clock.now)
+
+	// the grace period is cut short once the update is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	args.Clock = nil
+	err = VerifyUpdate(ctx, args, ConfigUDT{})
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestHealth_VerifyUpdate_pipe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipe servers aren't available in the standard library")
+	}
+
+	sock := filepath.Join(t.TempDir(), "health.sock")
+	ln, err := net.Listen("unix", sock)
+	assert.Nil(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	var args Args
+	args.Healthpipe = sock
+	args.Healthtimeout = time.Second
+	assert.Nil(t, VerifyUpdate(context.Background(), args, ConfigUDT{}))
+
+	args.Healthpipe = filepath.Join(t.TempDir(), "missing.sock")
+	args.Healthtimeout = 0
+	assert.NotNil(t, VerifyUpdate(context.Background(), args, ConfigUDT{}))
+}
+
+func TestHealth_applyUpdate_rollback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	// the "installed" file the update replaces
+	instDir := GetExeDir()
+	installed := filepath.Join(instDir, "WidgetX.txt")
+	sentinel := filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)
+	assert.Nil(t, os.WriteFile(installed, []byte("old"), 0644))
+	defer os.Remove(installed)
+	defer os.Remove(sentinel)
+
+	tmpDir := t.TempDir()
+	_, files, err := Unzip(OSFS{}, "./testdata/widgetX.1.0.1.wyu", tmpDir)
+	assert.Nil(t, err)
+	wysFilePath := filepath.Join(tmpDir, "wys")
+	assert.Nil(t, copyFile("./testdata/widgetX.1.0.1.wys", wysFilePath))
+
+	var sink MemorySink
+	var args Args
+	args.Healthurl = ts.URL
+	args.Events = &sink
+
+	var result Result
+	rc, err := applyUpdate(context.Background(), args, ConfigIUC{}, "1.0.1", files, wysFilePath, &result)
+	assert.Equal(t, EXIT_ERROR, rc)
+	assert.NotNil(t, err)
+	assert.Equal(t, PHASE_HEALTH, result.Phase)
+	assert.Equal(t, ROLLBACK_SUCCEEDED, result.Rollback)
+	assert.Contains(t, sink.Types(), EVENT_HEALTH_FAILED)
+	assert.Contains(t, sink.Types(), EVENT_ROLLBACK_PERFORMED)
+
+	// the old file is back and the update won't be tried again
+	dat, err := os.ReadFile(installed)
+	assert.Nil(t, err)
+	assert.Equal(t, "old", string(dat))
+	assert.True(t, fileExists(sentinel))
+}
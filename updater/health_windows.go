@@ -0,0 +1,30 @@
+//go:build windows
+// +build windows
+
+package updater
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// probePipe connects to the named pipe. A pipe that is busy with another
+// client still has a server, so it counts as healthy.
+func probePipe(name string) error {
+	path := name
+	if !strings.HasPrefix(path, `\\`) {
+		path = `\\.\pipe\` + name
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, windows.ERROR_PIPE_BUSY) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,231 @@
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Hook phases
+const (
+	HOOK_PRE_INSTALL   = "pre_install"   // before the files are backed up and replaced
+	HOOK_POST_INSTALL  = "post_install"  // after the files are replaced and the services started
+	HOOK_POST_ROLLBACK = "post_rollback" // after a failed update was rolled back
+)
+
+// Hook failure policies
+const (
+	HOOK_ON_FAILURE_ROLLBACK = "rollback" // fail the update (rolling back if anything was installed)
+	HOOK_ON_FAILURE_CONTINUE = "continue" // log the failure and carry on
+)
+
+// DEFAULT_HOOK_TIMEOUT is how long a hook may run when no timeout is given
+const DEFAULT_HOOK_TIMEOUT = 5 * time.Minute
+
+// hookWaitDelay is how long to wait for the output of a hook that was
+// killed, in case it left children holding on to its output
+const hookWaitDelay = 5 * time.Second
+
+// Hook is an executable run while installing an update
+type Hook struct {
+	// Path is relative to the root of the WYU archive. If it doesn't exist
+	// there it is relative to the install directory (e.g., a file the
+	// update installs).
+	Path      string   `json:"path"`
+	Args      []string `json:"args,omitempty"`
+	Timeout   string   `json:"timeout,omitempty"`    // e.g., "30s", defaults to DEFAULT_HOOK_TIMEOUT
+	OnFailure string   `json:"on_failure,omitempty"` // HOOK_ON_FAILURE_*, defaults to rollback
+
+	timeout time.Duration
+}
+
+// Hooks is the hooks manifest (HOOKS_MANIFEST_FILE_NAME) in the root of a
+// WYU archive. Files in the HOOKS_DIR_NAME directory of the archive are only
+// used by the hooks, they aren't installed.
+type Hooks struct {
+	PreInstall   []Hook `json:"pre_install,omitempty"`
+	PostInstall  []Hook `json:"post_install,omitempty"`
+	PostRollback []Hook `json:"post_rollback,omitempty"`
+
+	// dir is the root of the extracted WYU archive
+	dir string
+}
+
+// LoadHooks reads the hooks manifest from the files extracted from a WYU
+// archive. No hooks are returned if the archive doesn't have a manifest.
+func LoadHooks(fsys FS, extractedFiles []string) (hooks Hooks, err error) {
+	root, ok := wyuRoot(extractedFiles)
+	if !ok {
+		return hooks, nil
+	}
+
+	manifestPath := filepath.Join(root, HOOKS_MANIFEST_FILE_NAME)
+	dat, err := fsOrOS(fsys).ReadFile(manifestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return hooks, nil
+	}
+	if err != nil {
+		return hooks, err
+	}
+
+	if err := json.Unmarshal(dat, &hooks); err != nil {
+		return Hooks{}, fmt.Errorf("error parsing hooks manifest %s; %w", manifestPath, err)
+	}
+	hooks.dir = root
+
+	for _, phase := range []*[]Hook{&hooks.PreInstall, &hooks.PostInstall, &hooks.PostRollback} {
+		for i := range *phase {
+			if err := (*phase)[i].validate(); err != nil {
+				return Hooks{}, fmt.Errorf("invalid hook in %s; %w", manifestPath, err)
+			}
+		}
+	}
+
+	return hooks, nil
+}
+
+// validate checks the hook and fills in the defaults
+func (h *Hook) validate() error {
+	// the path may not leave the WYU archive or the install directory
+	if !filepath.IsLocal(h.Path) {
+		return fmt.Errorf("hook path %q must be a relative path inside the update", h.Path)
+	}
+
+	h.timeout = DEFAULT_HOOK_TIMEOUT
+	if len(h.Timeout) > 0 {
+		timeout, err := time.ParseDuration(h.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("hook %s has an invalid timeout %q", h.Path, h.Timeout)
+		}
+		h.timeout = timeout
+	}
+
+	switch h.OnFailure {
+	case "":
+		h.OnFailure = HOOK_ON_FAILURE_ROLLBACK
+	case HOOK_ON_FAILURE_ROLLBACK, HOOK_ON_FAILURE_CONTINUE:
+	default:
+		return fmt.Errorf("hook %s has an unknown on_failure policy %q", h.Path, h.OnFailure)
+	}
+	return nil
+}
+
+// Run runs the hooks for `phase` in order. The first hook that fails with
+// the rollback policy stops the run and its error is returned. A hook is
+// killed if `ctx` is done while it runs, that fails regardless of the
+// policy.
+func (h Hooks) Run(ctx context.Context, args Args, phase string, instDir string) error {
+	var hooks []Hook
+	switch phase {
+	case HOOK_PRE_INSTALL:
+		hooks = h.PreInstall
+	case HOOK_POST_INSTALL:
+		hooks = h.PostInstall
+	case HOOK_POST_ROLLBACK:
+		hooks = h.PostRollback
+	default:
+		return fmt.Errorf("unknown hook phase %s", phase)
+	}
+
+	for _, hook := range hooks {
+		err := h.runHook(ctx, args, phase, hook, instDir)
+		if err == nil {
+			continue
+		}
+		if isCancelled(err) {
+			return withError(ErrHook, fmt.Errorf("%s hook cancelled; %w", phase, err))
+		}
+
+		emitEvent(args, EVENT_HOOK_FAILED, "%s hook failed; %v", phase, err)
+		if hook.OnFailure == HOOK_ON_FAILURE_CONTINUE {
+			args.Logger.Warnf("%s hook failed, continuing; %v", phase, err)
+			continue
+		}
+		return withError(ErrHook, fmt.Errorf("%s hook failed; %w", phase, err))
+	}
+	return nil
+}
+
+// runHook runs a single hook in the install directory, logging its output
+func (h Hooks) runHook(ctx context.Context, args Args, phase string, hook Hook, instDir string) error {
+	path := h.path(args.fs(), hook, instDir)
+
+	timeout := hook.timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_HOOK_TIMEOUT
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s not run; %w", hook.Path, err)
+	}
+	hookCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args.Logger.Infof("Running %s hook %s %s", phase, hook.Path, strings.Join(hook.Args, " "))
+
+	cmd := exec.CommandContext(hookCtx, path, hook.Args...)
+	cmd.Dir = instDir
+	cmd.WaitDelay = hookWaitDelay
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	start := time.Now()
+	err := cmd.Run()
+
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		args.Logger.Infof("[%s] %s", hook.Path, scanner.Text())
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s killed; %w", hook.Path, err)
+	}
+	if hookCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out after %v", hook.Path, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s; %w", hook.Path, err)
+	}
+
+	args.Logger.Debugf("%s hook %s finished in %v", phase, hook.Path, time.Since(start))
+	return nil
+}
+
+// path returns the path of the hook's executable, in the WYU archive if it
+// is there and the install directory otherwise
+func (h Hooks) path(fsys FS, hook Hook, instDir string) string {
+	path := filepath.Join(h.dir, hook.Path)
+	if len(h.dir) == 0 || !pathExists(fsys, path) {
+		path = filepath.Join(instDir, hook.Path)
+	}
+	return path
+}
+
+// wyuRoot returns the root of the extracted WYU archive, the directory the
+// update details are in
+func wyuRoot(extractedFiles []string) (string, bool) {
+	for _, f := range extractedFiles {
+		if filepath.Base(f) == UPDTDETAILS_UDT {
+			return filepath.Dir(f), true
+		}
+	}
+	return "", false
+}
+
+// isHookFile returns true for the hooks manifest and the files in the hooks
+// directory of an extracted WYU archive rooted at `root`
+func isHookFile(root string, f string) bool {
+	rel, err := filepath.Rel(root, f)
+	if err != nil {
+		return false
+	}
+	return rel == HOOKS_MANIFEST_FILE_NAME || strings.HasPrefix(rel, HOOKS_DIR_NAME+string(filepath.Separator))
+}
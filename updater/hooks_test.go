@@ -0,0 +1,216 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeHookScript writes a script to dir/hooks that prints `output` and
+// exits with `exitCode`. Returns the hook path relative to dir.
+func writeHookScript(t *testing.T, dir string, name string, output string, exitCode int) string {
+	hooksDir := filepath.Join(dir, HOOKS_DIR_NAME)
+	assert.Nil(t, os.MkdirAll(hooksDir, 0755))
+
+	var script string
+	if runtime.GOOS == "windows" {
+		name += ".cmd"
+		script = fmt.Sprintf("@echo %s\r\n@exit /b %d\r\n", output, exitCode)
+	} else {
+		name += ".sh"
+		script = fmt.Sprintf("#!/bin/sh\necho %s\nexit %d\n", output, exitCode)
+	}
+
+	assert.Nil(t, os.WriteFile(filepath.Join(hooksDir, name), []byte(script), 0755))
+	return filepath.Join(HOOKS_DIR_NAME, name)
+}
+
+// writeHooksManifest writes the manifest and an empty update details file
+// to dir, returning the "extracted" files
+func writeHooksManifest(t *testing.T, dir string, hooks Hooks) []string {
+	dat, err := json.Marshal(hooks)
+	assert.Nil(t, err)
+
+	manifest := filepath.Join(dir, HOOKS_MANIFEST_FILE_NAME)
+	assert.Nil(t, os.WriteFile(manifest, dat, 0644))
+	udt := filepath.Join(dir, UPDTDETAILS_UDT)
+	assert.Nil(t, os.WriteFile(udt, nil, 0644))
+	return []string{udt, manifest}
+}
+
+func TestHooks_LoadHooks(t *testing.T) {
+	dir := t.TempDir()
+	files := writeHooksManifest(t, dir, Hooks{
+		PreInstall:  []Hook{{Path: "hooks/check.exe", Timeout: "30s"}},
+		PostInstall: []Hook{{Path: "migrate.exe", Args: []string{"--up"}, OnFailure: HOOK_ON_FAILURE_CONTINUE}},
+	})
+
+	hooks, err := LoadHooks(OSFS{}, files)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(hooks.PreInstall))
+	assert.Equal(t, HOOK_ON_FAILURE_ROLLBACK, hooks.PreInstall[0].OnFailure)
+	assert.Equal(t, "30s", hooks.PreInstall[0].timeout.String())
+	assert.Equal(t, DEFAULT_HOOK_TIMEOUT, hooks.PostInstall[0].timeout)
+	assert.Equal(t, []string{"--up"}, hooks.PostInstall[0].Args)
+	assert.Equal(t, dir, hooks.dir)
+}
+
+func TestHooks_LoadHooks_none(t *testing.T) {
+	dir := t.TempDir()
+	udt := filepath.Join(dir, UPDTDETAILS_UDT)
+	assert.Nil(t, os.WriteFile(udt, nil, 0644))
+
+	hooks, err := LoadHooks(OSFS{}, []string{udt})
+	assert.Nil(t, err)
+	assert.Empty(t, hooks.PreInstall)
+	assert.Nil(t, hooks.Run(context.Background(), Args{}, HOOK_PRE_INSTALL, dir))
+}
+
+func TestHooks_LoadHooks_invalid(t *testing.T) {
+	for _, hook := range []Hook{
+		{Path: ""},
+		{Path: filepath.Join(t.TempDir(), "abs.exe")},
+		{Path: "../escape.exe"},
+		{Path: filepath.Join(HOOKS_DIR_NAME, "..", "..", "escape.exe")},
+		{Path: "hooks/check.exe", Timeout: "soon"},
+		{Path: "hooks/check.exe", OnFailure: "shrug"},
+	} {
+		files := writeHooksManifest(t, t.TempDir(), Hooks{PostInstall: []Hook{hook}})
+		_, err := LoadHooks(OSFS{}, files)
+		assert.NotNil(t, err, hook.Path)
+	}
+}
+
+func TestHooks_GetUpdateDetails_skips_hooks(t *testing.T) {
+	dir := t.TempDir()
+	_, files, err := Unzip(OSFS{}, "./testdata/widgetX.1.0.1.wyu", dir)
+	assert.Nil(t, err)
+
+	script := writeHookScript(t, dir, "check", "ok", 0)
+	manifest := filepath.Join(dir, HOOKS_MANIFEST_FILE_NAME)
+	assert.Nil(t, os.WriteFile(manifest, []byte(`{}`), 0644))
+	files = append(files, manifest, filepath.Join(dir, script))
+
+	_, updates, err := GetUpdateDetails(OSFS{}, files)
+	assert.Nil(t, err)
+	for _, f := range updates {
+		assert.NotEqual(t, HOOKS_MANIFEST_FILE_NAME, filepath.Base(f))
+		assert.NotEqual(t, filepath.Base(script), filepath.Base(f))
+	}
+	assert.Contains(t, updates, filepath.Join(dir, "base", "WidgetX.txt"))
+}
+
+func TestHooks_Run(t *testing.T) {
+	dir := t.TempDir()
+	instDir := t.TempDir()
+
+	hooks := Hooks{
+		PostInstall: []Hook{
+			{Path: writeHookScript(t, dir, "migrate", "migrated", 0)},
+			{Path: writeHookScript(t, dir, "optional", "optional failed", 3), OnFailure: HOOK_ON_FAILURE_CONTINUE},
+		},
+		PostRollback: []Hook{
+			{Path: writeHookScript(t, dir, "required", "required failed", 4)},
+			{Path: writeHookScript(t, dir, "never", "never runs", 0)},
+		},
+		dir: dir,
+	}
+
+	var log bytes.Buffer
+	var sink MemorySink
+	var args Args
+	args.Logger, _ = NewLogger(LogConfig{Level: LOG_INFO, Console: &log})
+	args.Events = &sink
+
+	// a failed hook with the continue policy doesn't fail the phase
+	assert.Nil(t, hooks.Run(context.Background(), args, HOOK_POST_INSTALL, instDir))
+	assert.Contains(t, log.String(), "migrated")
+	assert.Contains(t, log.String(), "optional failed")
+	assert.Equal(t, []EventType{EVENT_HOOK_FAILED}, sink.Types())
+
+	// a failed hook with the rollback policy stops the phase
+	err := hooks.Run(context.Background(), args, HOOK_POST_ROLLBACK, instDir)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "required")
+	assert.NotContains(t, log.String(), "never runs")
+}
+
+func TestHooks_Run_installed_file(t *testing.T) {
+	// hooks not in the WYU archive are run from the install directory
+	instDir := t.TempDir()
+	hooks := Hooks{
+		PreInstall: []Hook{{Path: writeHookScript(t, instDir, "installed", "installed hook", 0)}},
+		dir:        t.TempDir(),
+	}
+
+	var log bytes.Buffer
+	var args Args
+	args.Logger, _ = NewLogger(LogConfig{Level: LOG_INFO, Console: &log})
+
+	assert.Nil(t, hooks.Run(context.Background(), args, HOOK_PRE_INSTALL, instDir))
+	assert.Contains(t, log.String(), "installed hook")
+}
+
+func TestHooks_path(t *testing.T) {
+	m := NewMemFS()
+	dir := filepath.Join(string(filepath.Separator), "wyu")
+	instDir := filepath.Join(string(filepath.Separator), "inst")
+	assert.Nil(t, m.MkdirAll(filepath.Join(dir, HOOKS_DIR_NAME), 0755))
+	assert.Nil(t, m.WriteFile(filepath.Join(dir, HOOKS_DIR_NAME, "check.exe"), nil, 0755))
+	hooks := Hooks{dir: dir}
+
+	// the hook is looked up on the updater's filesystem
+	hook := Hook{Path: filepath.Join(HOOKS_DIR_NAME, "check.exe")}
+	assert.Equal(t, filepath.Join(dir, hook.Path), hooks.path(m, hook, instDir))
+
+	hook = Hook{Path: "installed.exe"}
+	assert.Equal(t, filepath.Join(instDir, hook.Path), hooks.path(m, hook, instDir))
+}
+
+func TestHooks_Run_timeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sleep in cmd scripts")
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "slow.sh")
+	assert.Nil(t, os.WriteFile(script, []byte("#!/bin/sh\nexec sleep 10\n"), 0755))
+
+	hook := Hook{Path: "slow.sh", Timeout: "100ms"}
+	assert.Nil(t, hook.validate())
+	hooks := Hooks{PreInstall: []Hook{hook}, dir: dir}
+
+	err := hooks.Run(context.Background(), Args{}, HOOK_PRE_INSTALL, dir)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+}
+
+func TestHooks_Run_cancelled(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sleep in cmd scripts")
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "slow.sh")
+	assert.Nil(t, os.WriteFile(script, []byte("#!/bin/sh\nexec sleep 10\n"), 0755))
+
+	// a cancelled hook fails regardless of the policy
+	hook := Hook{Path: "slow.sh", OnFailure: HOOK_ON_FAILURE_CONTINUE}
+	assert.Nil(t, hook.validate())
+	hooks := Hooks{PreInstall: []Hook{hook}, dir: dir}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := hooks.Run(ctx, Args{}, HOOK_PRE_INSTALL, dir)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, ERROR_CLASS_CANCELLED, ErrorClass(err))
+}
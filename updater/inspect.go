@@ -0,0 +1,235 @@
+package updater
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"strings"
+)
+
+// WYCDetails are the decoded details of a WYC file
+type WYCDetails struct {
+	CompanyName          string   `json:"company_name"`
+	ProductName          string   `json:"product_name"`
+	GUID                 string   `json:"guid"`
+	InstalledVersion     string   `json:"installed_version"`
+	ServerFileSites      []string `json:"server_file_sites"`
+	WyupdateServerSites  []string `json:"wyupdate_server_sites,omitempty"`
+	HeaderImageAlignment string   `json:"header_image_alignment,omitempty"`
+	HeaderTextIndent     int      `json:"header_text_indent"`
+	HeaderTextColor      string   `json:"header_text_color,omitempty"`
+	HeaderFilename       string   `json:"header_filename,omitempty"`
+	SideImageFilename    string   `json:"side_image_filename,omitempty"`
+	LanguageCulture      string   `json:"language_culture,omitempty"`
+	LanguageFilename     string   `json:"language_filename,omitempty"`
+	HideHeaderDivider    bool     `json:"hide_header_divider"`
+	CloseWyupdate        bool     `json:"close_wyupdate"`
+	CustomTitleBar       string   `json:"custom_title_bar,omitempty"`
+	PublicKey            string   `json:"public_key,omitempty"`
+	PublicKeyFingerprint string   `json:"public_key_fingerprint,omitempty"`
+	PublicKeyError       string   `json:"public_key_error,omitempty"`
+	ReportURL            string   `json:"report_url,omitempty"`
+}
+
+// WYSDetails are the decoded details of a WYS file
+type WYSDetails struct {
+	CurrentLastVersion string   `json:"current_last_version"`
+	VersionToUpdate    string   `json:"version_to_update"`
+	MinClientVersion   string   `json:"min_client_version,omitempty"`
+	ServerFileSite     string   `json:"server_file_site,omitempty"`
+	UpdateFileSites    []string `json:"update_file_sites"`
+	UpdateFileSize     int64    `json:"update_file_size"`
+	UpdateFileAdler32  int64    `json:"update_file_adler32"`
+	FileSignature      string   `json:"file_signature,omitempty"` // hex
+	LatestChanges      string   `json:"latest_changes,omitempty"`
+	RTFSize            int      `json:"rtf_size,omitempty"`
+	UpdateErrorText    string   `json:"update_error_text,omitempty"`
+	UpdateErrorLink    string   `json:"update_error_link,omitempty"`
+	WYSFolder          int      `json:"wys_folder,omitempty"`
+}
+
+// WYUDetails are the decoded details of a WYU file
+type WYUDetails struct {
+	ServicesToStop  []string         `json:"services_to_stop"`
+	ServicesToStart []string         `json:"services_to_start"`
+	RegistryChanges int              `json:"registry_changes"`
+	Files           []WYUFileDetails `json:"files"`
+}
+
+// WYUFileDetails describes a file in a WYU archive
+type WYUFileDetails struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Adler32 int64  `json:"adler32"`
+	// ExpectedAdler32 is the checksum in updtdetails.udt, if it has one
+	// for the file
+	ExpectedAdler32 int64 `json:"expected_adler32,omitempty"`
+	// Hook is true for the hooks manifest and hook scripts, they aren't
+	// installed
+	Hook bool `json:"hook,omitempty"`
+}
+
+// InspectWYC decodes the WYC file `dat`
+func InspectWYC(dat []byte) (WYCDetails, error) {
+	zipr, err := zip.NewReader(bytes.NewReader(dat), int64(len(dat)))
+	if err != nil {
+		return WYCDetails{}, err
+	}
+	if !zipHasFile(zipr, IUCLIENT_IUC) {
+		return WYCDetails{}, fmt.Errorf("no %s in the WYC file", IUCLIENT_IUC)
+	}
+	config, err := readWYC(zipr)
+	if err != nil {
+		return WYCDetails{}, err
+	}
+
+	details := WYCDetails{
+		CompanyName:          ValueToString(&config.IucCompanyName),
+		ProductName:          ValueToString(&config.IucProductName),
+		GUID:                 ValueToString(&config.IucGUID),
+		InstalledVersion:     ValueToString(&config.IucInstalledVersion),
+		ServerFileSites:      tlvStrings(config.IucServerFileSite),
+		WyupdateServerSites:  tlvStrings(config.IucWyupdateServerSite),
+		HeaderImageAlignment: ValueToString(&config.IucHeaderImageAlignment),
+		HeaderTextColor:      ValueToString(&config.IucHeaderTextColor),
+		HeaderFilename:       ValueToString(&config.IucHeaderFilename),
+		SideImageFilename:    ValueToString(&config.IucSideImageFilename),
+		LanguageCulture:      ValueToString(&config.IucLanguageCulture),
+		LanguageFilename:     ValueToString(&config.IucLanguageFilename),
+		CustomTitleBar:       ValueToString(&config.IucCustomTitleBar),
+		PublicKey:            ValueToString(&config.IucPublicKey),
+		ReportURL:            config.ReportURL,
+	}
+	if len(config.IucHeaderTextIndent.Value) == 4 {
+		details.HeaderTextIndent = ValueToInt(&config.IucHeaderTextIndent)
+	}
+	if len(config.IucHideHeaderDivider.Value) == 4 {
+		details.HideHeaderDivider = ValueToBool(&config.IucHideHeaderDivider)
+	}
+	if len(config.IucCloseWyupate.Value) == 4 {
+		details.CloseWyupdate = ValueToBool(&config.IucCloseWyupate)
+	}
+
+	// a key the updater can't parse is reported, not an error, so the
+	// rest of the file can be inspected
+	if details.PublicKey != "" {
+		key, err := ParsePublicKey(details.PublicKey)
+		if err == nil {
+			details.PublicKeyFingerprint, err = KeyFingerprint(&key.PublicKey)
+		}
+		if err != nil {
+			details.PublicKeyError = err.Error()
+		}
+	}
+	return details, nil
+}
+
+// InspectWYS decodes the WYS file `dat`
+func InspectWYS(dat []byte) (WYSDetails, error) {
+	wys, err := Info{}.ParseWYSFromReader(bytes.NewReader(dat), int64(len(dat)))
+	if err != nil {
+		return WYSDetails{}, err
+	}
+
+	return WYSDetails{
+		CurrentLastVersion: wys.CurrentLastVersion,
+		VersionToUpdate:    wys.VersionToUpdate,
+		MinClientVersion:   wys.MinClientVersion,
+		ServerFileSite:     wys.ServerFileSite,
+		UpdateFileSites:    wys.UpdateFileSite,
+		UpdateFileSize:     wys.UpdateFileSize,
+		UpdateFileAdler32:  wys.UpdateFileAdler32,
+		FileSignature:      hex.EncodeToString(wys.FileSha1),
+		LatestChanges:      wys.LatestChanges,
+		RTFSize:            len(wys.RTF),
+		UpdateErrorText:    wys.UpdateErrorText,
+		UpdateErrorLink:    wys.UpdateErrorLink,
+		WYSFolder:          wys.WYSFolder,
+	}, nil
+}
+
+// InspectWYU decodes the WYU file `dat`, listing its files with their
+// sizes and checksums
+func InspectWYU(dat []byte) (WYUDetails, error) {
+	var details WYUDetails
+	zipr, err := zip.NewReader(bytes.NewReader(dat), int64(len(dat)))
+	if err != nil {
+		return details, err
+	}
+
+	var udt *ConfigUDT
+	for _, f := range zipr.File {
+		if f.Name != UPDTDETAILS_UDT {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return details, err
+		}
+		parsed, err := readUDT(rc)
+		rc.Close()
+		if err != nil {
+			return details, fmt.Errorf("%s; %w", UPDTDETAILS_UDT, err)
+		}
+		udt = &parsed
+	}
+	if udt == nil {
+		return details, fmt.Errorf("no %s in the WYU file", UPDTDETAILS_UDT)
+	}
+
+	details.ServicesToStop = tlvStrings(udt.ServiceToStopBeforeUpdate)
+	details.ServicesToStart = tlvStrings(udt.ServiceToStartAfterUpdate)
+	if len(udt.NumberOfRegistryChanges.Value) == 4 {
+		details.RegistryChanges = ValueToInt(&udt.NumberOfRegistryChanges)
+	}
+
+	expected := make(map[string]int64)
+	for _, file := range udt.Files {
+		expected[strings.ReplaceAll(file.RelativePath, `\`, "/")] = file.NewFileAdler32
+	}
+
+	for _, f := range zipr.File {
+		if f.Name == UPDTDETAILS_UDT || f.FileInfo().IsDir() {
+			continue
+		}
+		sum, err := zipFileAdler32(f)
+		if err != nil {
+			return details, fmt.Errorf("%s; %w", f.Name, err)
+		}
+		details.Files = append(details.Files, WYUFileDetails{
+			Name:            f.Name,
+			Size:            int64(f.UncompressedSize64),
+			Adler32:         int64(sum),
+			ExpectedAdler32: expected[f.Name],
+			Hook:            f.Name == HOOKS_MANIFEST_FILE_NAME || strings.HasPrefix(f.Name, HOOKS_DIR_NAME+"/"),
+		})
+	}
+	return details, nil
+}
+
+// zipFileAdler32 returns the Adler32 of the contents of `f`
+func zipFileAdler32(f *zip.File) (uint32, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	sum := adler32.New()
+	if _, err := io.Copy(sum, rc); err != nil {
+		return 0, err
+	}
+	return sum.Sum32(), nil
+}
+
+// tlvStrings returns the values of `tlvs` as strings
+func tlvStrings(tlvs []TLV) []string {
+	s := make([]string, 0, len(tlvs))
+	for _, tlv := range tlvs {
+		s = append(s, ValueToString(&tlv))
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package updater
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspect_InspectWYC(t *testing.T) {
+	dat, err := os.ReadFile("./testdata/client.1.0.0.wyc")
+	assert.Nil(t, err)
+
+	details, err := InspectWYC(dat)
+	assert.Nil(t, err)
+	assert.Equal(t, "WidgetX", details.ProductName)
+	assert.Equal(t, "1.0.0", details.InstalledVersion)
+	assert.Equal(t, []string{"http://127.0.0.1/updates/wyserver.wys?key=%urlargs%"}, details.ServerFileSites)
+	assert.Equal(t, 80, details.HeaderTextIndent)
+	assert.True(t, details.HideHeaderDivider)
+	assert.Equal(t, 64, len(details.PublicKeyFingerprint))
+	assert.Empty(t, details.PublicKeyError)
+
+	_, err = InspectWYC([]byte("not a zip"))
+	assert.NotNil(t, err)
+}
+
+func TestInspect_InspectWYS(t *testing.T) {
+	dat, err := os.ReadFile("./testdata/widgetX.1.0.1.wys")
+	assert.Nil(t, err)
+
+	details, err := InspectWYS(dat)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.1", details.VersionToUpdate)
+	assert.Equal(t, int64(458), details.UpdateFileSize)
+	assert.Equal(t, 2, len(details.UpdateFileSites))
+
+	wys, err := Info{}.ParseWYSFromReader(bytes.NewReader(dat), int64(len(dat)))
+	assert.Nil(t, err)
+	assert.Equal(t, hex.EncodeToString(wys.FileSha1), details.FileSignature)
+}
+
+func TestInspect_InspectWYU(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "widget.exe"), []byte("widget 1.0.1"), 0644))
+	var buf bytes.Buffer
+	udt, err := WYUBuilder{Dir: dir, ServicesToStop: []string{"widget"}}.Build(&buf)
+	assert.Nil(t, err)
+
+	details, err := InspectWYU(buf.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"widget"}, details.ServicesToStop)
+	assert.Equal(t, []string{}, details.ServicesToStart)
+	assert.Equal(t, 1, len(details.Files))
+	assert.Equal(t, "base/widget.exe", details.Files[0].Name)
+	assert.Equal(t, int64(len("widget 1.0.1")), details.Files[0].Size)
+	assert.Equal(t, udt.Files[0].NewFileAdler32, details.Files[0].Adler32)
+	assert.Equal(t, details.Files[0].Adler32, details.Files[0].ExpectedAdler32)
+
+	// a WYU file from wyBuild doesn't have checksums
+	dat, err := os.ReadFile("./testdata/widgetX.1.0.1.wyu")
+	assert.Nil(t, err)
+	details, err = InspectWYU(dat)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(details.Files))
+	assert.NotZero(t, details.Files[0].Adler32)
+	assert.Zero(t, details.Files[0].ExpectedAdler32)
+
+	// no updtdetails.udt
+	dat, err = os.ReadFile("./testdata/client.1.0.0.wyc")
+	assert.Nil(t, err)
+	_, err = InspectWYU(dat)
+	assert.NotNil(t, err)
+}
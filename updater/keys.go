@@ -0,0 +1,233 @@
+package updater
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DEFAULT_KEY_BITS is the size of keys generated by wyBuild
+const DEFAULT_KEY_BITS = 2048
+
+// rsaKeyValue is the .NET XML format of an RSA key, as written by
+// RSA.ToXmlString. The private fields are empty for a public key.
+type rsaKeyValue struct {
+	XMLName  xml.Name `xml:"RSAKeyValue"`
+	Modulus  string   `xml:"Modulus"`
+	Exponent string   `xml:"Exponent"`
+	P        string   `xml:"P,omitempty"`
+	Q        string   `xml:"Q,omitempty"`
+	DP       string   `xml:"DP,omitempty"`
+	DQ       string   `xml:"DQ,omitempty"`
+	InverseQ string   `xml:"InverseQ,omitempty"`
+	D        string   `xml:"D,omitempty"`
+}
+
+// GenerateKey generates an RSA key pair to sign updates with
+func GenerateKey(bits int) (*rsa.PrivateKey, error) {
+	if bits < 1024 {
+		return nil, fmt.Errorf("key size %d is too small", bits)
+	}
+	return rsa.GenerateKey(rand.Reader, bits)
+}
+
+// PublicKeyXML returns `pub` as <RSAKeyValue> XML, the format of
+// STRING_IUC_PUBLIC_KEY that ParsePublicKey reads
+func PublicKeyXML(pub *rsa.PublicKey) string {
+	return marshalKeyXML(rsaKeyValue{
+		Modulus:  base64.StdEncoding.EncodeToString(pub.N.Bytes()),
+		Exponent: base64.StdEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	})
+}
+
+// PrivateKeyXML returns `priv` as <RSAKeyValue> XML with the private
+// parameters, the format wyBuild stores its keys in
+func PrivateKeyXML(priv *rsa.PrivateKey) (string, error) {
+	if len(priv.Primes) != 2 {
+		return "", fmt.Errorf("multi-prime keys can't be written as XML")
+	}
+	priv.Precompute()
+
+	// .NET expects the parameters padded to the size of the modulus, or
+	// half of it for the CRT parameters
+	size := (priv.N.BitLen() + 7) / 8
+	half := (size + 1) / 2
+	return marshalKeyXML(rsaKeyValue{
+		Modulus:  base64.StdEncoding.EncodeToString(priv.N.Bytes()),
+		Exponent: base64.StdEncoding.EncodeToString(big.NewInt(int64(priv.E)).Bytes()),
+		P:        base64.StdEncoding.EncodeToString(padBytes(priv.Primes[0], half)),
+		Q:        base64.StdEncoding.EncodeToString(padBytes(priv.Primes[1], half)),
+		DP:       base64.StdEncoding.EncodeToString(padBytes(priv.Precomputed.Dp, half)),
+		DQ:       base64.StdEncoding.EncodeToString(padBytes(priv.Precomputed.Dq, half)),
+		InverseQ: base64.StdEncoding.EncodeToString(padBytes(priv.Precomputed.Qinv, half)),
+		D:        base64.StdEncoding.EncodeToString(padBytes(priv.D, size)),
+	}), nil
+}
+
+// padBytes returns `x` as big-endian bytes padded to `size`. A value that
+// doesn't fit, e.g., the larger prime of a key with unbalanced primes, isn't
+// padded.
+func padBytes(x *big.Int, size int) []byte {
+	if n := len(x.Bytes()); n > size {
+		size = n
+	}
+	return x.FillBytes(make([]byte, size))
+}
+
+// ParsePrivateKeyXML parses an <RSAKeyValue> with the private parameters
+func ParsePrivateKeyXML(s string) (*rsa.PrivateKey, error) {
+	var kv rsaKeyValue
+	if err := xml.Unmarshal([]byte(s), &kv); err != nil {
+		return nil, err
+	}
+
+	var n, e, p, q, d big.Int
+	for _, f := range []struct {
+		name  string
+		value string
+		z     *big.Int
+	}{
+		{"Modulus", kv.Modulus, &n},
+		{"Exponent", kv.Exponent, &e},
+		{"P", kv.P, &p},
+		{"Q", kv.Q, &q},
+		{"D", kv.D, &d},
+	} {
+		if f.value == "" {
+			return nil, fmt.Errorf("RSAKeyValue has no %s", f.name)
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(f.value))
+		if err != nil {
+			return nil, fmt.Errorf("RSAKeyValue %s; %w", f.name, err)
+		}
+		f.z.SetBytes(data)
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("RSAKeyValue exponent is too large")
+	}
+
+	priv := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: &n, E: int(e.Int64())},
+		D:         &d,
+		Primes:    []*big.Int{&p, &q},
+	}
+	if err := priv.Validate(); err != nil {
+		return nil, err
+	}
+	priv.Precompute()
+	return priv, nil
+}
+
+// MarshalPrivateKeyPEM returns `priv` as a PKCS #8 "PRIVATE KEY" PEM block
+func MarshalPrivateKeyPEM(priv *rsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// MarshalPublicKeyPEM returns `pub` as a PKIX "PUBLIC KEY" PEM block
+func MarshalPublicKeyPEM(pub *rsa.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// ParsePublicKeyPEM parses a PEM encoded RSA public key (PKIX or PKCS #1)
+func ParsePublicKeyPEM(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("not an RSA public key")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// ReadPrivateKey parses a private key in either PEM or <RSAKeyValue> XML
+func ReadPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	if isKeyXML(data) {
+		return ParsePrivateKeyXML(string(data))
+	}
+	return ParsePrivateKeyPEM(data)
+}
+
+// ReadPublicKey parses a public key in either PEM or <RSAKeyValue> XML. A
+// private key is accepted too, its public half is returned.
+func ReadPublicKey(data []byte) (*rsa.PublicKey, error) {
+	if isKeyXML(data) {
+		key, err := ParsePublicKey(string(data))
+		if err != nil {
+			return nil, err
+		}
+		return &key.PublicKey, nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block != nil && strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		priv, err := ParsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		return &priv.PublicKey, nil
+	}
+	return ParsePublicKeyPEM(data)
+}
+
+// IsPrivateKey returns true if `data` holds a private key in PEM or XML
+func IsPrivateKey(data []byte) bool {
+	if isKeyXML(data) {
+		var kv rsaKeyValue
+		return xml.Unmarshal(data, &kv) == nil && kv.D != ""
+	}
+	block, _ := pem.Decode(data)
+	return block != nil && strings.HasSuffix(block.Type, "PRIVATE KEY")
+}
+
+// KeyFingerprint returns the hex SHA256 of the PKIX encoding of `pub`, so
+// the same key has the same fingerprint in every format
+func KeyFingerprint(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// isKeyXML returns true if `data` looks like an <RSAKeyValue>
+func isKeyXML(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("<"))
+}
+
+// marshalKeyXML returns the XML of `kv` on one line, like .NET
+func marshalKeyXML(kv rsaKeyValue) string {
+	// rsaKeyValue only has strings, it always marshals
+	dat, _ := xml.Marshal(kv)
+	return string(dat)
+}
@@ -0,0 +1,140 @@
+package updater
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeys_PublicKeyXML(t *testing.T) {
+	priv, err := GenerateKey(DEFAULT_KEY_BITS)
+	assert.Nil(t, err)
+
+	s := PublicKeyXML(&priv.PublicKey)
+	assert.True(t, strings.HasPrefix(s, "<RSAKeyValue><Modulus>"))
+	assert.Contains(t, s, "<Exponent>AQAB</Exponent>")
+	assert.NotContains(t, s, "<D>")
+
+	// the XML is what the updater verifies signatures with
+	key, err := ParsePublicKey(s)
+	assert.Nil(t, err)
+	assert.True(t, priv.PublicKey.Equal(&key.PublicKey))
+
+	hashed := sha1.Sum([]byte("widget"))
+	sig, err := SignHash(priv, hashed[:])
+	assert.Nil(t, err)
+	assert.Nil(t, VerifyHash(&key.PublicKey, hashed[:], sig))
+
+	_, err = GenerateKey(512)
+	assert.NotNil(t, err)
+}
+
+func TestKeys_PrivateKeyXML(t *testing.T) {
+	priv, err := GenerateKey(DEFAULT_KEY_BITS)
+	assert.Nil(t, err)
+
+	s, err := PrivateKeyXML(priv)
+	assert.Nil(t, err)
+	for _, tag := range []string{"Modulus", "Exponent", "P", "Q", "DP", "DQ", "InverseQ", "D"} {
+		assert.Contains(t, s, "<"+tag+">")
+	}
+
+	parsed, err := ParsePrivateKeyXML(s)
+	assert.Nil(t, err)
+	assert.True(t, priv.Equal(parsed))
+	assert.True(t, IsPrivateKey([]byte(s)))
+
+	// a public key isn't a private key
+	_, err = ParsePrivateKeyXML(PublicKeyXML(&priv.PublicKey))
+	assert.NotNil(t, err)
+	assert.False(t, IsPrivateKey([]byte(PublicKeyXML(&priv.PublicKey))))
+
+	_, err = ParsePrivateKeyXML(strings.Replace(s, "<D>", "<D>!", 1))
+	assert.NotNil(t, err)
+}
+
+func TestKeys_PrivateKeyXML_unbalanced(t *testing.T) {
+	// an imported key whose primes aren't the same size
+	e := big.NewInt(65537)
+	one := big.NewInt(1)
+	var priv *rsa.PrivateKey
+	for priv == nil {
+		p, err := rand.Prime(rand.Reader, 640)
+		assert.Nil(t, err)
+		q, err := rand.Prime(rand.Reader, 400)
+		assert.Nil(t, err)
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		d := new(big.Int).ModInverse(e, phi)
+		if d == nil {
+			continue
+		}
+		priv = &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: new(big.Int).Mul(p, q), E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+	}
+	assert.Nil(t, priv.Validate())
+
+	s, err := PrivateKeyXML(priv)
+	assert.Nil(t, err)
+	parsed, err := ParsePrivateKeyXML(s)
+	assert.Nil(t, err)
+	assert.True(t, priv.Equal(parsed))
+}
+
+func TestKeys_PEM(t *testing.T) {
+	priv, err := GenerateKey(DEFAULT_KEY_BITS)
+	assert.Nil(t, err)
+
+	privPEM, err := MarshalPrivateKeyPEM(priv)
+	assert.Nil(t, err)
+	assert.True(t, IsPrivateKey(privPEM))
+	parsed, err := ReadPrivateKey(privPEM)
+	assert.Nil(t, err)
+	assert.True(t, priv.Equal(parsed))
+
+	pubPEM, err := MarshalPublicKeyPEM(&priv.PublicKey)
+	assert.Nil(t, err)
+	assert.False(t, IsPrivateKey(pubPEM))
+
+	// every format has the same public key
+	privXML, err := PrivateKeyXML(priv)
+	assert.Nil(t, err)
+	for _, dat := range [][]byte{privPEM, pubPEM, []byte(privXML), []byte(PublicKeyXML(&priv.PublicKey))} {
+		pub, err := ReadPublicKey(dat)
+		assert.Nil(t, err)
+		assert.True(t, priv.PublicKey.Equal(pub))
+	}
+
+	_, err = ParsePublicKeyPEM(privPEM)
+	assert.NotNil(t, err)
+	_, err = ReadPublicKey([]byte("not a key"))
+	assert.NotNil(t, err)
+}
+
+func TestKeys_KeyFingerprint(t *testing.T) {
+	priv, err := GenerateKey(DEFAULT_KEY_BITS)
+	assert.Nil(t, err)
+	other, err := GenerateKey(DEFAULT_KEY_BITS)
+	assert.Nil(t, err)
+
+	fp, err := KeyFingerprint(&priv.PublicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 64, len(fp))
+
+	key, err := ParsePublicKey(PublicKeyXML(&priv.PublicKey))
+	assert.Nil(t, err)
+	fp2, err := KeyFingerprint(&key.PublicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, fp, fp2)
+
+	fp3, err := KeyFingerprint(&other.PublicKey)
+	assert.Nil(t, err)
+	assert.NotEqual(t, fp, fp3)
+}
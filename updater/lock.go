@@ -0,0 +1,217 @@
+package updater
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned when the lock is already held by another process
+var ErrLocked = errors.New("lock is held by another process")
+
+// ErrUpdateInProgress is returned when another updater is working on the
+// same install directory
+var ErrUpdateInProgress = fmt.Errorf("another update is in progress; %w", ErrLocked)
+
+// staleLockGrace is how long a lock file without a valid PID is honored. The
+// holder may not have written its PID yet.
+const staleLockGrace = 10 * time.Second
+
+// InstanceLock is an exclusive lock backed by a lock file. The lock file
+// contains the PID of the process holding the lock and is locked (see
+// lockFile) while it is held. A lock file left behind by a process that no
+// longer exists is considered stale and is taken over.
+type InstanceLock struct {
+	path         string
+	file         *os.File
+	releaseMutex func()
+}
+
+// AcquireInstanceLock creates the lock file at `path`. ErrLocked is returned
+// if the lock file already exists and the process that created it is still
+// running.
+func AcquireInstanceLock(path string) (*InstanceLock, error) {
+	lock, err := createLockFile(path)
+	if !errors.Is(err, os.ErrExist) {
+		return lock, err
+	}
+
+	if !lockFileIsStale(path) {
+		return nil, fmt.Errorf("%s; %w", path, ErrLocked)
+	}
+
+	// the previous holder went away without releasing the lock
+	lock, err = takeOverLockFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// released in the meantime
+		lock, err = createLockFile(path)
+	}
+	if errors.Is(err, os.ErrExist) || errors.Is(err, ErrLocked) {
+		// someone else took the lock first
+		return nil, fmt.Errorf("%s; %w", path, ErrLocked)
+	}
+	return lock, err
+}
+
+// AcquireUpdateLock takes the lock that must be held while updating the
+// files in `instDir`. On Windows a named mutex is held in addition to the
+// lock file; the mutex is released by the OS if the process dies.
+// ErrUpdateInProgress is returned if another updater holds the lock.
+func AcquireUpdateLock(instDir string) (*InstanceLock, error) {
+	releaseMutex, err := acquireNamedMutex(updateMutexName(instDir))
+	if errors.Is(err, ErrLocked) {
+		return nil, ErrUpdateInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := AcquireInstanceLock(filepath.Join(instDir, UPDATE_LOCK_FILE_NAME))
+	if err != nil {
+		releaseMutex()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%w (%v)", ErrUpdateInProgress, err)
+		}
+		return nil, err
+	}
+
+	lock.releaseMutex = releaseMutex
+	return lock, nil
+}
+
+// Release releases the lock by removing the lock file
+func (l *InstanceLock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	l.file.Close()
+	l.file = nil
+	err := os.Remove(l.path)
+
+	if l.releaseMutex != nil {
+		l.releaseMutex()
+		l.releaseMutex = nil
+	}
+	return err
+}
+
+// createLockFile exclusively creates the lock file, locks it and writes our
+// PID to it
+func createLockFile(path string) (*InstanceLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	_, err = f.WriteString(strconv.Itoa(os.Getpid()))
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	return &InstanceLock{path: path, file: f}, nil
+}
+
+// takeOverLockFile replaces the PID in the stale lock file at `path` with
+// ours. The lock file is replaced in place, not removed and created again,
+// and locked first (see lockFile), so of the updaters that found it stale
+// only one takes it over. Once locked it is checked again, it may have been
+// released or taken over in the meantime, and after writing our PID it is
+// read back to make sure it is still the lock file at `path`.
+func takeOverLockFile(path string) (*InstanceLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if !isLockFileAt(f, path) || !lockFileIsStale(path) {
+		f.Close()
+		return nil, ErrLocked
+	}
+
+	pid := strconv.Itoa(os.Getpid())
+	if _, err := f.WriteAt([]byte(pid), 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(int64(len(pid))); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	dat, err := os.ReadFile(path)
+	if err != nil || string(dat) != pid || !isLockFileAt(f, path) {
+		f.Close()
+		return nil, ErrLocked
+	}
+
+	return &InstanceLock{path: path, file: f}, nil
+}
+
+// isLockFileAt returns true if `f` is the file at `path`, i.e., it hasn't
+// been removed or replaced
+func isLockFileAt(f *os.File, path string) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	fi, err := os.Stat(path)
+	return err == nil && os.SameFile(opened, fi)
+}
+
+// lockFileIsStale returns true if the process that wrote the lock file is
+// no longer running
+func lockFileIsStale(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		// gone already, let the caller try again
+		return true
+	}
+
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(dat)))
+	if err != nil || pid <= 0 {
+		// no PID, only stale if it has been like this for a while
+		return time.Since(fi.ModTime()) > staleLockGrace
+	}
+
+	if pid == os.Getpid() {
+		return false
+	}
+
+	return !processExists(pid)
+}
+
+// updateMutexName returns the name of the mutex guarding `instDir`. The
+// name is derived from the install directory so updaters installed in
+// different locations don't block each other.
+func updateMutexName(instDir string) string {
+	abs, err := filepath.Abs(instDir)
+	if err != nil {
+		abs = instDir
+	}
+	sum := sha1.Sum([]byte(strings.ToLower(filepath.Clean(abs))))
+	return `Global\win-service-updater-` + hex.EncodeToString(sum[:8])
+}
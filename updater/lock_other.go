@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package updater
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// processExists returns true if a process with `pid` is running
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// acquireNamedMutex is a no-op, named mutexes only exist on Windows
+func acquireNamedMutex(name string) (release func(), err error) {
+	return func() {}, nil
+}
+
+// lockFile takes an exclusive advisory lock (flock) on the lock file `f`.
+// ErrLocked is returned if the lock is held through another open file. The
+// lock is released when `f` is closed.
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+	return err
+}
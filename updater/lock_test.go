@@ -0,0 +1,177 @@
+package updater
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLock_AcquireInstanceLock(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), SERVICE_LOCK_FILE_NAME)
+
+	lock, err := AcquireInstanceLock(lockPath)
+	assert.Nil(t, err)
+
+	// the lock file contains our PID
+	dat, err := os.ReadFile(lockPath)
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(dat))
+
+	// the lock can't be taken twice
+	_, err = AcquireInstanceLock(lockPath)
+	assert.True(t, errors.Is(err, ErrLocked))
+
+	assert.Nil(t, lock.Release())
+	assert.False(t, fileExists(lockPath))
+
+	// once released it can be acquired again
+	lock, err = AcquireInstanceLock(lockPath)
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Release())
+}
+
+func TestLock_Release_nil(t *testing.T) {
+	var lock *InstanceLock
+	assert.Nil(t, lock.Release())
+}
+
+func TestLock_AcquireInstanceLock_stale(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), UPDATE_LOCK_FILE_NAME)
+
+	// run a process to completion so we have the PID of a process that
+	// no longer exists
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	assert.Nil(t, cmd.Run())
+	deadPID := cmd.ProcessState.Pid()
+
+	err := os.WriteFile(lockPath, []byte(strconv.Itoa(deadPID)), 0644)
+	assert.Nil(t, err)
+
+	lock, err := AcquireInstanceLock(lockPath)
+	assert.Nil(t, err)
+	defer lock.Release()
+
+	dat, err := os.ReadFile(lockPath)
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(dat))
+}
+
+func TestLock_AcquireInstanceLock_stale_race(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	assert.Nil(t, cmd.Run())
+	deadPID := cmd.ProcessState.Pid()
+
+	for round := 0; round < 20; round++ {
+		lockPath := filepath.Join(t.TempDir(), UPDATE_LOCK_FILE_NAME)
+		assert.Nil(t, os.WriteFile(lockPath, []byte(strconv.Itoa(deadPID)), 0644))
+
+		// updaters finding the same stale lock can't all take it over
+		var wg sync.WaitGroup
+		locks := make([]*InstanceLock, 8)
+		errs := make([]error, len(locks))
+		start := make(chan struct{})
+		for i := range locks {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				locks[i], errs[i] = AcquireInstanceLock(lockPath)
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+
+		held := 0
+		for i, lock := range locks {
+			if errs[i] == nil {
+				held++
+				continue
+			}
+			assert.True(t, errors.Is(errs[i], ErrLocked), errs[i].Error())
+			assert.Nil(t, lock)
+		}
+		assert.Equal(t, 1, held)
+
+		for _, lock := range locks {
+			assert.Nil(t, lock.Release())
+		}
+		assert.False(t, fileExists(lockPath))
+	}
+}
+
+func TestLock_takeOverLockFile(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	assert.Nil(t, cmd.Run())
+	deadPID := cmd.ProcessState.Pid()
+
+	lockPath := filepath.Join(t.TempDir(), UPDATE_LOCK_FILE_NAME)
+	assert.Nil(t, os.WriteFile(lockPath, []byte(strconv.Itoa(deadPID)), 0644))
+	lock, err := AcquireInstanceLock(lockPath)
+	assert.Nil(t, err)
+
+	// an updater that found the lock stale before it was taken over can't
+	// take it over again
+	_, err = takeOverLockFile(lockPath)
+	assert.True(t, errors.Is(err, ErrLocked))
+	dat, err := os.ReadFile(lockPath)
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(dat))
+
+	// nor once it was released and taken by someone else
+	assert.Nil(t, lock.Release())
+	other, err := AcquireInstanceLock(lockPath)
+	assert.Nil(t, err)
+	_, err = takeOverLockFile(lockPath)
+	assert.True(t, errors.Is(err, ErrLocked))
+	assert.Nil(t, other.Release())
+}
+
+func TestLock_AcquireInstanceLock_no_pid(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), UPDATE_LOCK_FILE_NAME)
+
+	// a lock file without a PID may still be being written
+	err := os.WriteFile(lockPath, []byte{}, 0644)
+	assert.Nil(t, err)
+
+	_, err = AcquireInstanceLock(lockPath)
+	assert.True(t, errors.Is(err, ErrLocked))
+
+	// but not for ever
+	old := time.Now().Add(-2 * staleLockGrace)
+	assert.Nil(t, os.Chtimes(lockPath, old, old))
+
+	lock, err := AcquireInstanceLock(lockPath)
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Release())
+}
+
+func TestLock_AcquireUpdateLock(t *testing.T) {
+	instDir := t.TempDir()
+
+	lock, err := AcquireUpdateLock(instDir)
+	assert.Nil(t, err)
+	assert.True(t, fileExists(filepath.Join(instDir, UPDATE_LOCK_FILE_NAME)))
+
+	_, err = AcquireUpdateLock(instDir)
+	assert.True(t, errors.Is(err, ErrUpdateInProgress))
+	assert.True(t, errors.Is(err, ErrLocked))
+	assert.Contains(t, err.Error(), "another update is in progress")
+
+	// a different install dir isn't blocked
+	other, err := AcquireUpdateLock(t.TempDir())
+	assert.Nil(t, err)
+	assert.Nil(t, other.Release())
+
+	assert.Nil(t, lock.Release())
+
+	lock, err = AcquireUpdateLock(instDir)
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Release())
+}
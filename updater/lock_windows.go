@@ -0,0 +1,69 @@
+//go:build windows
+// +build windows
+
+package updater
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// exit code reported by GetExitCodeProcess for a running process
+const stillActive = 259
+
+// lockFileOffsetHigh places the byte locked by lockFile far past the PID.
+// Locks on Windows are mandatory, the PID must stay readable.
+const lockFileOffsetHigh = 1
+
+// processExists returns true if a process with `pid` is running
+func processExists(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// we aren't allowed to look at it, but it's there
+		return errors.Is(err, windows.ERROR_ACCESS_DENIED)
+	}
+	defer windows.CloseHandle(h)
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
+
+// acquireNamedMutex creates the named mutex. ErrLocked is returned if the
+// mutex already exists, i.e., another process has it open. Any other
+// failure (e.g., not being allowed to create a Global\ object) isn't fatal,
+// the lock file still guards the install directory.
+func acquireNamedMutex(name string) (release func(), err error) {
+	namePtr, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := windows.CreateMutex(nil, false, namePtr)
+	if errors.Is(err, windows.ERROR_ALREADY_EXISTS) {
+		windows.CloseHandle(h)
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return func() {}, nil
+	}
+
+	return func() { windows.CloseHandle(h) }, nil
+}
+
+// lockFile locks a byte of the lock file `f` (LockFileEx). ErrLocked is
+// returned if the byte is locked through another handle. The lock is
+// released when `f` is closed.
+func lockFile(f *os.File) error {
+	overlapped := windows.Overlapped{OffsetHigh: lockFileOffsetHigh}
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK | windows.LOCKFILE_FAIL_IMMEDIATELY)
+	err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, 1, 0, &overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return ErrLocked
+	}
+	return err
+}
@@ -0,0 +1,252 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel is the severity of a log message
+type LogLevel int
+
+// Log levels
+const (
+	LOG_DEBUG LogLevel = iota
+	LOG_INFO
+	LOG_WARN
+	LOG_ERROR
+)
+
+// Logging defaults
+const (
+	DEFAULT_LOG_MAX_SIZE = 10 * 1024 * 1024 // bytes
+	DEFAULT_LOG_BACKUPS  = 3
+)
+
+var logLevelNames = map[LogLevel]string{
+	LOG_DEBUG: "debug",
+	LOG_INFO:  "info",
+	LOG_WARN:  "warn",
+	LOG_ERROR: "error",
+}
+
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLogLevel returns the LogLevel named by `s` (debug, info, warn or error)
+func ParseLogLevel(s string) (LogLevel, error) {
+	for level, name := range logLevelNames {
+		if strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+	return LOG_INFO, fmt.Errorf("unknown log level: %s", s)
+}
+
+// LogConfig configures a Logger
+type LogConfig struct {
+	Path       string    // log file, appended to (optional)
+	Level      LogLevel  // messages below this level are dropped
+	MaxSize    int64     // rotate the log file when it would grow past this many bytes (0 never rotates)
+	MaxBackups int       // number of rotated log files (.1, .2, ...) to keep
+	JSON       bool      // write JSON lines instead of text
+	Console    io.Writer // also write messages here (optional)
+}
+
+// Logger is a leveled logger that appends to a log file, rotating it when it
+// gets too big. A nil *Logger discards all messages.
+type Logger struct {
+	mu     sync.Mutex
+	config LogConfig
+	file   *os.File
+	size   int64
+	// reopen is set when the log file couldn't be reopened after rotating
+	// it, it is opened again on the next message
+	reopen bool
+}
+
+// NewLogger returns a Logger for `config`. The log file, if any, is opened
+// for appending.
+func NewLogger(config LogConfig) (*Logger, error) {
+	l := &Logger{config: config}
+	if len(config.Path) > 0 {
+		if err := l.open(config.Path); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// NewLoggerFromArgs returns a Logger configured from the command-line
+// arguments. With /debug all messages are also written to STDERR.
+func NewLoggerFromArgs(args Args) (*Logger, error) {
+	level, err := ParseLogLevel(args.Loglevel)
+	if err != nil {
+		level = LOG_INFO
+	}
+
+	config := LogConfig{
+		Path:       args.Logfile,
+		Level:      level,
+		MaxSize:    args.LogMaxSize,
+		MaxBackups: args.LogBackups,
+		JSON:       args.Logformat == FORMAT_JSON,
+	}
+
+	if args.Debug {
+		config.Level = LOG_DEBUG
+		config.Console = os.Stderr
+	}
+
+	return NewLogger(config)
+}
+
+// Debugf logs a debug message
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	l.log(LOG_DEBUG, format, v...)
+}
+
+// Infof logs an informational message
+func (l *Logger) Infof(format string, v ...interface{}) {
+	l.log(LOG_INFO, format, v...)
+}
+
+// Warnf logs a warning
+func (l *Logger) Warnf(format string, v ...interface{}) {
+	l.log(LOG_WARN, format, v...)
+}
+
+// Errorf logs an error
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	l.log(LOG_ERROR, format, v...)
+}
+
+// Close closes the log file
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// logLine is a log message in the JSON format
+type logLine struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+}
+
+func (l *Logger) log(level LogLevel, format string, v ...interface{}) {
+	if l == nil || level < l.config.Level {
+		return
+	}
+
+	now := time.Now().Format(time.RFC3339Nano)
+	msg := fmt.Sprintf(format, v...)
+
+	var line []byte
+	if l.config.JSON {
+		line, _ = json.Marshal(logLine{Time: now, Level: level.String(), Message: msg})
+		line = append(line, '\n')
+	} else {
+		line = []byte(fmt.Sprintf("%s %-5s %s\n", now, strings.ToUpper(level.String()), msg))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.config.Console != nil {
+		l.config.Console.Write(line)
+	}
+
+	if l.file == nil && l.reopen && l.open(l.config.Path) == nil {
+		l.reopen = false
+	}
+	if l.file == nil {
+		return
+	}
+
+	if l.config.MaxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.config.MaxSize {
+		// if rotation fails keep writing to the current file
+		l.rotate()
+		if l.file == nil {
+			return
+		}
+	}
+
+	n, _ := l.file.Write(line)
+	l.size += int64(n)
+}
+
+// open opens the log file `path` for appending
+func (l *Logger) open(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s; %w", path, err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	l.size = fi.Size()
+	return nil
+}
+
+// rotate renames the log file to .1 (shifting older backups up) and starts
+// a new log file. If the new log file can't be opened the rename is undone
+// and the current file is appended to, rotating it is tried again after
+// another MaxSize bytes.
+func (l *Logger) rotate() error {
+	// an open file can't be renamed on Windows
+	l.file.Close()
+	l.file = nil
+
+	path := l.config.Path
+	renamed := false
+	if l.config.MaxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", path, l.config.MaxBackups))
+		for i := l.config.MaxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		}
+		renamed = os.Rename(path, path+".1") == nil
+	} else {
+		os.Remove(path)
+	}
+
+	err := l.open(path)
+	if err == nil {
+		return nil
+	}
+
+	current := path
+	if renamed && os.Rename(path+".1", path) != nil {
+		current = path + ".1"
+	}
+	if l.open(current) == nil {
+		l.size = 0
+	} else {
+		l.reopen = true
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package updater
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger_Append(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "updater.log")
+	assert.Nil(t, os.WriteFile(logPath, []byte("existing line\n"), 0644))
+
+	logger, err := NewLogger(LogConfig{Path: logPath, Level: LOG_INFO})
+	assert.Nil(t, err)
+	logger.Debugf("dropped")
+	logger.Infof("first %d", 1)
+	logger.Errorf("second")
+	assert.Nil(t, logger.Close())
+
+	dat, err := os.ReadFile(logPath)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(dat)), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, "existing line", lines[0])
+	assert.Contains(t, lines[1], "INFO  first 1")
+	assert.Contains(t, lines[2], "ERROR second")
+	assert.NotContains(t, string(dat), "dropped")
+}
+
+func TestLogger_JSON(t *testing.T) {
+	var console bytes.Buffer
+	logger, err := NewLogger(LogConfig{Level: LOG_DEBUG, JSON: true, Console: &console})
+	assert.Nil(t, err)
+	logger.Warnf("disk is %s", "full")
+
+	var line logLine
+	assert.Nil(t, json.Unmarshal(console.Bytes(), &line))
+	assert.Equal(t, "warn", line.Level)
+	assert.Equal(t, "disk is full", line.Message)
+	assert.NotEmpty(t, line.Time)
+}
+
+func TestLogger_Rotate(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "updater.log")
+
+	logger, err := NewLogger(LogConfig{Path: logPath, Level: LOG_INFO, MaxSize: 100, MaxBackups: 2})
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		logger.Infof("message %d padded to make the line longer", i)
+	}
+	assert.Nil(t, logger.Close())
+
+	assert.True(t, fileExists(logPath))
+	assert.True(t, fileExists(logPath+".1"))
+	assert.True(t, fileExists(logPath+".2"))
+	assert.False(t, fileExists(logPath+".3"))
+
+	dat, err := os.ReadFile(logPath)
+	assert.Nil(t, err)
+	assert.Contains(t, string(dat), "message 9")
+
+	dat, err = os.ReadFile(logPath + ".1")
+	assert.Nil(t, err)
+	assert.Contains(t, string(dat), "message 8")
+}
+
+func TestLogger_Nil(t *testing.T) {
+	var logger *Logger
+	logger.Infof("nothing happens")
+	assert.Nil(t, logger.Close())
+}
+
+func TestLogger_ParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("WARN")
+	assert.Nil(t, err)
+	assert.Equal(t, LOG_WARN, level)
+
+	_, err = ParseLogLevel("verbose")
+	assert.NotNil(t, err)
+}
+
+func TestLogger_Rotate_failed(t *testing.T) {
+	logDir := filepath.Join(t.TempDir(), "logs")
+	assert.Nil(t, os.MkdirAll(logDir, 0755))
+	logPath := filepath.Join(logDir, "updater.log")
+
+	logger, err := NewLogger(LogConfig{Path: logPath, Level: LOG_INFO, MaxSize: 100, MaxBackups: 1})
+	assert.Nil(t, err)
+	defer logger.Close()
+	logger.Infof("message 0 padded to make the line longer")
+
+	// the log file can't be rotated or reopened, the message is lost
+	assert.Nil(t, os.RemoveAll(logDir))
+	logger.Infof("message 1 padded to make the line longer")
+	logger.Infof("message 2 padded to make the line longer")
+
+	// logging resumes once the log file can be opened again
+	assert.Nil(t, os.MkdirAll(logDir, 0755))
+	logger.Infof("message 3 padded to make the line longer")
+	logger.Infof("message 4 padded to make the line longer")
+	dat, err := os.ReadFile(logPath + ".1")
+	assert.Nil(t, err)
+	assert.Contains(t, string(dat), "message 3")
+	dat, err = os.ReadFile(logPath)
+	assert.Nil(t, err)
+	assert.Contains(t, string(dat), "message 4")
+}
@@ -1,21 +1,26 @@
 package updater
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 )
 
-// LogErrorMsg will write to a log file if a log file was specified
+// Output formats
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+// LogErrorMsg will append an error to the log file if a log file was specified
 func LogErrorMsg(args Args, msg string) {
-	if len(args.Logfile) > 0 {
-		dat := []byte(msg)
-		ioutil.WriteFile(args.Logfile, dat, 0644)
-	}
+	args.Logger.Errorf("%s", msg)
 }
 
-// LogOutputInfoMsg will write a msg to STDOUT or a log file if one was specified
+// LogOutputInfoMsg will write a msg to STDOUT or a log file if one was specified.
+// Nothing is written in the JSON format, only the result is (see LogOutputInfoResult).
 func LogOutputInfoMsg(args Args, msg string) {
-	if args.Outputinfo {
+	if args.Outputinfo && args.Format != FORMAT_JSON {
 		if len(args.OutputinfoLog) > 0 {
 			dat := []byte(msg)
 			ioutil.WriteFile(args.OutputinfoLog, dat, 0644)
@@ -24,3 +29,48 @@ func LogOutputInfoMsg(args Args, msg string) {
 		}
 	}
 }
+
+// LogOutputInfoResult will write the result as JSON to STDOUT or a log file if
+// one was specified
+func LogOutputInfoResult(args Args, result Result) error {
+	if !args.Outputinfo {
+		return nil
+	}
+
+	dat, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	if len(args.OutputinfoLog) > 0 {
+		return ioutil.WriteFile(args.OutputinfoLog, dat, 0644)
+	}
+	fmt.Println(string(dat))
+	return nil
+}
+
+// WriteResultFile writes the result as JSON to the result file if one was specified
+func WriteResultFile(args Args, result Result) error {
+	if len(args.Resultfile) == 0 {
+		return nil
+	}
+
+	dat, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(args.Resultfile, dat, 0644)
+}
+
+// outputResult writes the outcome of a run. `msg` is the legacy text output
+// (the error, or the version for a check), the JSON format writes `result`
+// instead.
+func outputResult(args Args, result Result, msg string) {
+	if args.Format == FORMAT_JSON {
+		LogOutputInfoResult(args, result)
+	} else if len(msg) > 0 {
+		LogOutputInfoMsg(args, msg)
+	}
+
+	WriteResultFile(args, result)
+}
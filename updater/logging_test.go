@@ -0,0 +1,65 @@
+package updater
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogging_outputResult_text(t *testing.T) {
+	f := SetupTmpLog()
+	f.Close()
+	defer TearDown(f.Name())
+
+	var args Args
+	args.Outputinfo = true
+	args.OutputinfoLog = f.Name()
+	args.Format = FORMAT_TEXT
+
+	outputResult(args, Result{Action: ACTION_CHECK, AvailableVersion: "1.0.1"}, "1.0.1")
+
+	dat, err := os.ReadFile(f.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.1", string(dat))
+}
+
+func TestLogging_outputResult_json(t *testing.T) {
+	f := SetupTmpLog()
+	f.Close()
+	defer TearDown(f.Name())
+
+	resultFile := SetupTmpLog()
+	resultFile.Close()
+	defer TearDown(resultFile.Name())
+
+	var args Args
+	args.Outputinfo = true
+	args.OutputinfoLog = f.Name()
+	args.Format = FORMAT_JSON
+	args.Resultfile = resultFile.Name()
+
+	result := Result{
+		Action:           ACTION_UPDATE,
+		InstalledVersion: "1.0.0",
+		AvailableVersion: "1.0.1",
+		ExitCode:         EXIT_SUCCESS,
+		FilesChanged:     []string{"WidgetX.txt"},
+	}
+
+	// informational messages are not mixed into the JSON output
+	LogOutputInfoMsg(args, "Reusing cached WYU file")
+	outputResult(args, result, "")
+
+	for _, fp := range []string{args.OutputinfoLog, args.Resultfile} {
+		dat, err := os.ReadFile(fp)
+		assert.Nil(t, err)
+
+		var actual Result
+		assert.Nil(t, json.Unmarshal(dat, &actual))
+		assert.Equal(t, result.Action, actual.Action)
+		assert.Equal(t, result.AvailableVersion, actual.AvailableVersion)
+		assert.Equal(t, result.FilesChanged, actual.FilesChanged)
+	}
+}
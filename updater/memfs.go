@@ -0,0 +1,480 @@
+package updater
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FSOp is a filesystem operation faults can be injected into
+type FSOp string
+
+// The operations of a MemFS
+const (
+	FS_OP_OPEN    FSOp = "open"    // Open, ReadFile
+	FS_OP_STAT    FSOp = "stat"    // Stat
+	FS_OP_READDIR FSOp = "readdir" // ReadDir
+	FS_OP_WRITE   FSOp = "write"   // OpenFile for writing, WriteFile and every Write
+	FS_OP_MKDIR   FSOp = "mkdir"   // MkdirAll, MkdirTemp
+	FS_OP_RENAME  FSOp = "rename"  // Rename, called for both paths
+	FS_OP_REMOVE  FSOp = "remove"  // Remove, RemoveAll
+)
+
+// FaultFunc returns the error `op` on `name` fails with, or nil if it
+// doesn't fail
+type FaultFunc func(op FSOp, name string) error
+
+// MemFS is an in-memory FS that can be told to fail, so the install
+// pipeline can be tested against a locked file, a full disk or a rename
+// across volumes without touching the disk. Directories have to exist before
+// files are created in them, like on a real filesystem, but the root (and
+// a volume name) always exists.
+type MemFS struct {
+	mu     sync.Mutex
+	nodes  map[string]*memNode
+	faults []FaultFunc
+}
+
+// memNode is a file or directory of a MemFS
+type memNode struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemFS returns an empty MemFS
+func NewMemFS() *MemFS {
+	return &MemFS{nodes: make(map[string]*memNode)}
+}
+
+// AddFault makes operations fail with the error `f` returns
+func (m *MemFS) AddFault(f FaultFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = append(m.faults, f)
+}
+
+// FailOp makes `op` fail with `err` on the paths matching `pattern`. The
+// pattern (see filepath.Match) is matched against the whole path and the
+// base name, so "*.exe" fails every executable.
+func (m *MemFS) FailOp(op FSOp, pattern string, err error) {
+	m.AddFault(func(o FSOp, name string) error {
+		if o != op {
+			return nil
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return err
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(name)); ok {
+			return err
+		}
+		return nil
+	})
+}
+
+// ClearFaults removes the faults, operations succeed again
+func (m *MemFS) ClearFaults() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = nil
+}
+
+// fault returns the error injected into `op` on `name`
+func (m *MemFS) fault(op FSOp, name string) error {
+	for _, f := range m.faults {
+		if err := f(op, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isRoot returns true if `name` (a cleaned path) is the root of a volume
+func isRoot(name string) bool {
+	return filepath.Dir(name) == name
+}
+
+// lookup returns the node of `name`, the root is a directory
+func (m *MemFS) lookup(name string) (*memNode, bool) {
+	if isRoot(name) {
+		return &memNode{mode: fs.ModeDir | 0755}, true
+	}
+	n, ok := m.nodes[name]
+	return n, ok
+}
+
+// checkParent returns an error unless the parent of `name` is a directory
+func (m *MemFS) checkParent(op FSOp, name string) error {
+	parent, ok := m.lookup(filepath.Dir(name))
+	if !ok {
+		return &fs.PathError{Op: string(op), Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: string(op), Path: name, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+// children returns the paths below `dir`
+func (m *MemFS) children(dir string) []string {
+	prefix := dir
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+	var names []string
+	for name := range m.nodes {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+
+	if err := m.fault(FS_OP_OPEN, name); err != nil {
+		return nil, &fs.PathError{Op: string(FS_OP_OPEN), Path: name, Err: err}
+	}
+	n, ok := m.lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: string(FS_OP_OPEN), Path: name, Err: fs.ErrNotExist}
+	}
+	return &memFile{fsys: m, name: name, node: n, reader: bytes.NewReader(n.data)}, nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+
+	if err := m.fault(FS_OP_STAT, name); err != nil {
+		return nil, &fs.PathError{Op: string(FS_OP_STAT), Path: name, Err: err}
+	}
+	n, ok := m.lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: string(FS_OP_STAT), Path: name, Err: fs.ErrNotExist}
+	}
+	return n.info(name), nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+
+	if err := m.fault(FS_OP_READDIR, name); err != nil {
+		return nil, &fs.PathError{Op: string(FS_OP_READDIR), Path: name, Err: err}
+	}
+	n, ok := m.lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: string(FS_OP_READDIR), Path: name, Err: fs.ErrNotExist}
+	}
+	if !n.mode.IsDir() {
+		return nil, &fs.PathError{Op: string(FS_OP_READDIR), Path: name, Err: syscall.ENOTDIR}
+	}
+
+	var entries []fs.DirEntry
+	for _, child := range m.children(name) {
+		if filepath.Dir(child) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(m.nodes[child].info(child)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	f, err := m.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		f, err := m.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return f.(*memFile), nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+
+	if err := m.fault(FS_OP_WRITE, name); err != nil {
+		return nil, &fs.PathError{Op: string(FS_OP_OPEN), Path: name, Err: err}
+	}
+	if err := m.checkParent(FS_OP_OPEN, name); err != nil {
+		return nil, err
+	}
+
+	n, ok := m.lookup(name)
+	switch {
+	case ok && n.mode.IsDir():
+		return nil, &fs.PathError{Op: string(FS_OP_OPEN), Path: name, Err: syscall.EISDIR}
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: string(FS_OP_OPEN), Path: name, Err: fs.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: string(FS_OP_OPEN), Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		n = &memNode{mode: perm.Perm()}
+		m.nodes[name] = n
+	}
+	if flag&os.O_TRUNC != 0 {
+		n.data = nil
+	}
+	n.modTime = time.Now()
+
+	f := &memFile{fsys: m, name: name, node: n, reader: bytes.NewReader(n.data), writable: true}
+	if flag&os.O_APPEND != 0 {
+		f.offset = int64(len(n.data))
+	}
+	return f, nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (m *MemFS) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAll(filepath.Clean(path), perm)
+}
+
+// mkdirAll creates `path` and any missing parents
+func (m *MemFS) mkdirAll(path string, perm fs.FileMode) error {
+	if err := m.fault(FS_OP_MKDIR, path); err != nil {
+		return &fs.PathError{Op: string(FS_OP_MKDIR), Path: path, Err: err}
+	}
+	if n, ok := m.lookup(path); ok {
+		if !n.mode.IsDir() {
+			return &fs.PathError{Op: string(FS_OP_MKDIR), Path: path, Err: syscall.ENOTDIR}
+		}
+		return nil
+	}
+
+	if err := m.mkdirAll(filepath.Dir(path), perm); err != nil {
+		return err
+	}
+	m.nodes[path] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+func (m *MemFS) MkdirTemp(dir string, pattern string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(dir) == 0 {
+		dir = os.TempDir()
+	}
+	dir = filepath.Clean(dir)
+
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for {
+		name := filepath.Join(dir, fmt.Sprintf("%s%d%s", prefix, rand.Uint32(), suffix))
+		if _, ok := m.lookup(name); ok {
+			continue
+		}
+		if err := m.fault(FS_OP_MKDIR, name); err != nil {
+			return "", &fs.PathError{Op: string(FS_OP_MKDIR), Path: name, Err: err}
+		}
+		if err := m.checkParent(FS_OP_MKDIR, name); err != nil {
+			return "", err
+		}
+		m.nodes[name] = &memNode{mode: fs.ModeDir | 0700, modTime: time.Now()}
+		return name, nil
+	}
+}
+
+func (m *MemFS) Rename(oldpath string, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+
+	linkError := func(err error) error {
+		return &os.LinkError{Op: string(FS_OP_RENAME), Old: oldpath, New: newpath, Err: err}
+	}
+	for _, name := range []string{oldpath, newpath} {
+		if err := m.fault(FS_OP_RENAME, name); err != nil {
+			return linkError(err)
+		}
+	}
+
+	n, ok := m.nodes[oldpath]
+	if !ok {
+		return linkError(fs.ErrNotExist)
+	}
+	if err := m.checkParent(FS_OP_RENAME, newpath); err != nil {
+		return linkError(err.(*fs.PathError).Err)
+	}
+	if target, ok := m.lookup(newpath); ok && target.mode.IsDir() {
+		return linkError(fs.ErrExist)
+	}
+
+	children := m.children(oldpath)
+	delete(m.nodes, oldpath)
+	m.nodes[newpath] = n
+	for _, child := range children {
+		m.nodes[newpath+strings.TrimPrefix(child, oldpath)] = m.nodes[child]
+		delete(m.nodes, child)
+	}
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+
+	if err := m.fault(FS_OP_REMOVE, name); err != nil {
+		return &fs.PathError{Op: string(FS_OP_REMOVE), Path: name, Err: err}
+	}
+	if _, ok := m.nodes[name]; !ok {
+		return &fs.PathError{Op: string(FS_OP_REMOVE), Path: name, Err: fs.ErrNotExist}
+	}
+	if len(m.children(name)) > 0 {
+		return &fs.PathError{Op: string(FS_OP_REMOVE), Path: name, Err: syscall.ENOTEMPTY}
+	}
+	delete(m.nodes, name)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+
+	if err := m.fault(FS_OP_REMOVE, path); err != nil {
+		return &fs.PathError{Op: string(FS_OP_REMOVE), Path: path, Err: err}
+	}
+	for _, child := range m.children(path) {
+		delete(m.nodes, child)
+	}
+	delete(m.nodes, path)
+	return nil
+}
+
+// info returns the FileInfo of the node at `name`
+func (n *memNode) info(name string) fs.FileInfo {
+	return memFileInfo{name: filepath.Base(name), size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+// memFileInfo is the FileInfo of a MemFS file
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi memFileInfo) Sys() any           { return nil }
+
+// memFile is an open MemFS file. Reads see the contents when the file was
+// opened, writes go straight to the file.
+type memFile struct {
+	fsys     *MemFS
+	name     string
+	node     *memNode
+	reader   *bytes.Reader
+	writable bool
+	offset   int64
+	closed   bool
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+	return f.node.info(f.name), nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if f.node.mode.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	return f.reader.Read(p)
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.reader.ReadAt(p, off)
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if !f.writable {
+		return 0, &fs.PathError{Op: string(FS_OP_WRITE), Path: f.name, Err: fs.ErrPermission}
+	}
+	if err := f.fsys.fault(FS_OP_WRITE, f.name); err != nil {
+		return 0, &fs.PathError{Op: string(FS_OP_WRITE), Path: f.name, Err: err}
+	}
+
+	end := f.offset + int64(len(p))
+	if end > int64(len(f.node.data)) {
+		data := make([]byte, end)
+		copy(data, f.node.data)
+		f.node.data = data
+	}
+	copy(f.node.data[f.offset:], p)
+	f.offset = end
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,144 @@
+package updater
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memDir is a directory in a MemFS that works on every OS
+var memDir = filepath.Join(string(filepath.Separator), "inst")
+
+func TestMemFS_Files(t *testing.T) {
+	m := NewMemFS()
+	name := filepath.Join(memDir, "widget.txt")
+
+	// the directory has to exist
+	err := m.WriteFile(name, []byte("1.0.0"), 0644)
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	assert.Nil(t, m.MkdirAll(memDir, 0755))
+	assert.Nil(t, m.WriteFile(name, []byte("1.0.0"), 0644))
+	dat, err := m.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.0", string(dat))
+
+	fi, err := m.Stat(name)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), fi.Size())
+	assert.False(t, fi.IsDir())
+
+	_, err = m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	assert.True(t, errors.Is(err, fs.ErrExist))
+
+	f, err := m.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("-beta"))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+	dat, _ = m.ReadFile(name)
+	assert.Equal(t, "1.0.0-beta", string(dat))
+
+	assert.Nil(t, m.Remove(name))
+	assert.False(t, pathExists(m, name))
+	assert.True(t, errors.Is(m.Remove(name), fs.ErrNotExist))
+}
+
+func TestMemFS_Dirs(t *testing.T) {
+	m := NewMemFS()
+	sub := filepath.Join(memDir, "a", "b")
+	assert.Nil(t, m.MkdirAll(sub, 0755))
+	assert.Nil(t, m.WriteFile(filepath.Join(sub, "2.txt"), nil, 0644))
+	assert.Nil(t, m.WriteFile(filepath.Join(sub, "1.txt"), nil, 0644))
+
+	entries, err := m.ReadDir(sub)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "1.txt", entries[0].Name())
+	assert.Equal(t, "2.txt", entries[1].Name())
+
+	// a directory is renamed with its files
+	moved := filepath.Join(memDir, "c")
+	assert.Nil(t, m.Rename(filepath.Join(memDir, "a"), moved))
+	assert.True(t, pathExists(m, filepath.Join(moved, "b", "1.txt")))
+	assert.False(t, pathExists(m, sub))
+
+	err = m.Remove(moved)
+	assert.True(t, errors.Is(err, syscall.ENOTEMPTY))
+	assert.Nil(t, m.RemoveAll(moved))
+	assert.False(t, pathExists(m, filepath.Join(moved, "b")))
+	assert.Nil(t, m.RemoveAll(moved))
+
+	tmp, err := m.MkdirTemp(memDir, TempDirPrefix())
+	assert.Nil(t, err)
+	assert.Equal(t, memDir, filepath.Dir(tmp))
+	fi, err := m.Stat(tmp)
+	assert.Nil(t, err)
+	assert.True(t, fi.IsDir())
+}
+
+func TestMemFS_FailOp(t *testing.T) {
+	m := NewMemFS()
+	assert.Nil(t, m.MkdirAll(memDir, 0755))
+	name := filepath.Join(memDir, "widget.exe")
+	assert.Nil(t, m.WriteFile(name, []byte("1.0.0"), 0755))
+
+	// a locked file
+	m.FailOp(FS_OP_RENAME, "*.exe", syscall.EACCES)
+	err := m.Rename(name, filepath.Join(memDir, "widget.old"))
+	assert.True(t, errors.Is(err, syscall.EACCES))
+	var linkErr *os.LinkError
+	assert.True(t, errors.As(err, &linkErr))
+	assert.True(t, pathExists(m, name))
+
+	// a full disk fails the write, not the open
+	m.ClearFaults()
+	f, err := m.OpenFile(filepath.Join(memDir, "big.bin"), os.O_WRONLY|os.O_CREATE, 0644)
+	assert.Nil(t, err)
+	m.FailOp(FS_OP_WRITE, "big.bin", syscall.ENOSPC)
+	_, err = f.Write([]byte("data"))
+	assert.True(t, errors.Is(err, syscall.ENOSPC))
+
+	// faults can look at the operation and the path
+	m.AddFault(func(op FSOp, name string) error {
+		if op == FS_OP_STAT {
+			return fs.ErrPermission
+		}
+		return nil
+	})
+	_, err = m.Stat(name)
+	assert.True(t, errors.Is(err, fs.ErrPermission))
+
+	m.ClearFaults()
+	_, err = m.Stat(name)
+	assert.Nil(t, err)
+}
+
+func TestFS_writeFileAtomic(t *testing.T) {
+	m := NewMemFS()
+	assert.Nil(t, m.MkdirAll(memDir, 0755))
+	name := filepath.Join(memDir, "state.json")
+	assert.Nil(t, m.WriteFile(name, []byte("old"), 0644))
+
+	// the old file is left alone when the disk is full
+	m.FailOp(FS_OP_WRITE, ".state.json.*.tmp", syscall.ENOSPC)
+	err := writeFileAtomic(m, name, []byte("new"))
+	assert.True(t, errors.Is(err, syscall.ENOSPC))
+	dat, _ := m.ReadFile(name)
+	assert.Equal(t, "old", string(dat))
+
+	m.ClearFaults()
+	assert.Nil(t, writeFileAtomic(m, name, []byte("new")))
+	dat, _ = m.ReadFile(name)
+	assert.Equal(t, "new", string(dat))
+
+	// no temp files are left behind
+	entries, err := m.ReadDir(memDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+}
@@ -0,0 +1,181 @@
+package updater
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// METRICS_PREFIX is the prefix of every metric name
+const METRICS_PREFIX = "wsupdater_"
+
+// MetricsState is what the metrics are generated from. It is persisted
+// between runs in the state file since a single run only knows about itself.
+type MetricsState struct {
+	LastCheck           time.Time `json:"last_check"`
+	LastSuccess         time.Time `json:"last_success"`
+	InstalledVersion    string    `json:"installed_version,omitempty"`
+	AvailableVersion    string    `json:"available_version,omitempty"`
+	LastExitCode        int       `json:"last_exit_code"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	BytesDownloaded     int64     `json:"bytes_downloaded"`
+	DownloadMs          int64     `json:"download_duration_ms"`
+	BytesDownloadedSum  int64     `json:"bytes_downloaded_total"`
+}
+
+// Update records the result of a run in the state
+func (s *MetricsState) Update(result Result) {
+	now := result.EndTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	// the check made it far enough to know what is available. Rolling back
+	// and applying a staged update don't ask the server.
+	if len(result.AvailableVersion) > 0 && checksServer(result.Action) {
+		s.LastCheck = now
+		s.AvailableVersion = result.AvailableVersion
+	}
+
+	if len(result.InstalledVersion) > 0 {
+		s.InstalledVersion = result.InstalledVersion
+	}
+	if result.Phase == PHASE_COMPLETE && (result.Action == ACTION_UPDATE || result.Action == ACTION_APPLY_STAGED || result.Action == ACTION_ROLLBACK) {
+		s.InstalledVersion = result.AvailableVersion
+	}
+
+	s.LastExitCode = result.ExitCode
+	if len(result.Error) > 0 {
+		s.ConsecutiveFailures++
+	} else {
+		s.ConsecutiveFailures = 0
+		s.LastSuccess = now
+	}
+
+	s.BytesDownloaded = result.BytesDownloaded
+	s.DownloadMs = result.DownloadMs
+	s.BytesDownloadedSum += result.BytesDownloaded
+}
+
+// checksServer returns true if `action` asks the update server for the
+// available version
+func checksServer(action string) bool {
+	switch action {
+	case ACTION_CHECK, ACTION_UPDATE, ACTION_STAGE, ACTION_DRY_RUN:
+		return true
+	}
+	return false
+}
+
+// ReadMetricsState reads the state file. A missing state file is an empty
+// state.
+func ReadMetricsState(path string) (state MetricsState, err error) {
+	dat, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(dat, &state)
+	if err != nil {
+		err = fmt.Errorf("error parsing state file %s; %w", path, err)
+		return MetricsState{}, err
+	}
+	return state, nil
+}
+
+// WriteMetrics updates the state file with the result and writes the
+// metrics to the -metricsfile in the OpenMetrics text format. Nothing is
+// done if no metrics file was specified.
+func WriteMetrics(args Args, result Result) error {
+	if len(args.Metricsfile) == 0 {
+		return nil
+	}
+
+	state, err := ReadMetricsState(args.Statefile)
+	if err != nil {
+		// start over rather than never writing metrics again
+		args.Logger.Warnf("%v", err)
+		state = MetricsState{}
+	}
+	state.Update(result)
+
+	dat, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(OSFS{}, args.Statefile, dat); err != nil {
+		return fmt.Errorf("failed to write state file %s; %w", args.Statefile, err)
+	}
+
+	sentinel := pathExists(args.fs(), filepath.Join(args.instDir(), INSTALL_FAILED_SENTINAL_WYS_FILE_NAME))
+	metrics := FormatMetrics(state, sentinel)
+	if err := writeFileAtomic(OSFS{}, args.Metricsfile, metrics); err != nil {
+		return fmt.Errorf("failed to write metrics file %s; %w", args.Metricsfile, err)
+	}
+	return nil
+}
+
+// FormatMetrics returns the metrics in the OpenMetrics text format
+func FormatMetrics(state MetricsState, sentinel bool) []byte {
+	var b bytes.Buffer
+
+	metric := func(name, typ, help string, value interface{}, labels ...string) {
+		fmt.Fprintf(&b, "# TYPE %s%s %s\n", METRICS_PREFIX, name, typ)
+		fmt.Fprintf(&b, "# HELP %s%s %s\n", METRICS_PREFIX, name, help)
+		if typ == "counter" {
+			name += "_total"
+		}
+		fmt.Fprintf(&b, "%s%s%s %v\n", METRICS_PREFIX, name, formatLabels(labels...), value)
+	}
+
+	metric("last_check_timestamp_seconds", "gauge", "Time of the last successful update check.", unixSeconds(state.LastCheck))
+	metric("last_success_timestamp_seconds", "gauge", "Time of the last run without errors.", unixSeconds(state.LastSuccess))
+	metric("installed_version", "gauge", "The installed version.", 1, "version", state.InstalledVersion)
+	metric("available_version", "gauge", "The latest version on the update server.", 1, "version", state.AvailableVersion)
+	metric("last_exit_code", "gauge", "Exit code of the last run.", state.LastExitCode)
+	metric("consecutive_failures", "gauge", "Number of runs in a row that failed.", state.ConsecutiveFailures)
+	metric("download_bytes", "gauge", "Bytes downloaded by the last run.", state.BytesDownloaded)
+	metric("download_duration_seconds", "gauge", "Time spent downloading by the last run.", float64(state.DownloadMs)/1000)
+	metric("downloaded_bytes", "counter", "Bytes downloaded by all runs.", state.BytesDownloadedSum)
+	metric("failed_install_sentinel", "gauge", "1 if a failed install sentinel is present.", boolToInt(sentinel))
+
+	b.WriteString("# EOF\n")
+	return b.Bytes()
+}
+
+// formatLabels formats name, value pairs as {name="value",...}
+func formatLabels(labels ...string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escaper.Replace(labels[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// unixSeconds returns t as seconds since the epoch, 0 for the zero time
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package updater
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_MetricsState_Update(t *testing.T) {
+	var state MetricsState
+
+	check := Result{Action: ACTION_CHECK, Phase: PHASE_COMPLETE, InstalledVersion: "1.0.0", AvailableVersion: "1.0.1", BytesDownloaded: 100, EndTime: time.Unix(100, 0)}
+	state.Update(check)
+	assert.Equal(t, time.Unix(100, 0), state.LastCheck)
+	assert.Equal(t, time.Unix(100, 0), state.LastSuccess)
+	assert.Equal(t, "1.0.0", state.InstalledVersion)
+	assert.Equal(t, int64(100), state.BytesDownloadedSum)
+
+	failed := Result{Action: ACTION_UPDATE, EndTime: time.Unix(200, 0), ExitCode: EXIT_ERROR}
+	failed.Error = "network is down"
+	state.Update(failed)
+	state.Update(failed)
+	assert.Equal(t, 2, state.ConsecutiveFailures)
+	assert.Equal(t, time.Unix(100, 0), state.LastCheck)
+	assert.Equal(t, EXIT_ERROR, state.LastExitCode)
+
+	updated := Result{Action: ACTION_UPDATE, Phase: PHASE_COMPLETE, InstalledVersion: "1.0.0", AvailableVersion: "1.0.1", BytesDownloaded: 1000, DownloadMs: 1500, EndTime: time.Unix(300, 0)}
+	state.Update(updated)
+	assert.Equal(t, 0, state.ConsecutiveFailures)
+	assert.Equal(t, "1.0.1", state.InstalledVersion)
+	assert.Equal(t, int64(1000), state.BytesDownloaded)
+	assert.Equal(t, int64(1100), state.BytesDownloadedSum)
+	assert.Equal(t, time.Unix(300, 0), state.LastCheck)
+
+	// a rollback doesn't check for updates, the server still has 1.0.1
+	rollback := Result{Action: ACTION_ROLLBACK, Phase: PHASE_COMPLETE, InstalledVersion: "1.0.1", AvailableVersion: "1.0.0", EndTime: time.Unix(400, 0)}
+	state.Update(rollback)
+	assert.Equal(t, "1.0.0", state.InstalledVersion)
+	assert.Equal(t, "1.0.1", state.AvailableVersion)
+	assert.Equal(t, time.Unix(300, 0), state.LastCheck)
+	assert.Equal(t, time.Unix(400, 0), state.LastSuccess)
+}
+
+func TestMetrics_FormatMetrics(t *testing.T) {
+	state := MetricsState{
+		LastCheck:           time.Unix(1700000000, 0),
+		InstalledVersion:    `1.0."0"`,
+		ConsecutiveFailures: 3,
+		BytesDownloaded:     2048,
+		DownloadMs:          1500,
+		BytesDownloadedSum:  4096,
+	}
+
+	metrics := string(FormatMetrics(state, true))
+	assert.Contains(t, metrics, "wsupdater_last_check_timestamp_seconds 1.7e+09\n")
+	assert.Contains(t, metrics, "wsupdater_last_success_timestamp_seconds 0\n")
+	assert.Contains(t, metrics, `wsupdater_installed_version{version="1.0.\"0\""} 1`+"\n")
+	assert.Contains(t, metrics, "wsupdater_consecutive_failures 3\n")
+	assert.Contains(t, metrics, "wsupdater_download_bytes 2048\n")
+	assert.Contains(t, metrics, "wsupdater_download_duration_seconds 1.5\n")
+	assert.Contains(t, metrics, "# TYPE wsupdater_downloaded_bytes counter\n")
+	assert.Contains(t, metrics, "wsupdater_downloaded_bytes_total 4096\n")
+	assert.Contains(t, metrics, "wsupdater_failed_install_sentinel 1\n")
+	assert.True(t, strings.HasSuffix(metrics, "# EOF\n"))
+}
+
+func TestMetrics_WriteMetrics(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var args Args
+	args.Metricsfile = filepath.Join(tmpDir, "updater.prom")
+	args.Statefile = filepath.Join(tmpDir, METRICS_STATE_FILE_NAME)
+
+	result := Result{Action: ACTION_CHECK}
+	result.finish(systemClock{}, EXIT_ERROR, errors.New("no network"))
+	assert.Nil(t, WriteMetrics(args, result))
+	assert.Nil(t, WriteMetrics(args, result))
+
+	// the failures carry over between runs
+	state, err := ReadMetricsState(args.Statefile)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, state.ConsecutiveFailures)
+
+	dat, err := os.ReadFile(args.Metricsfile)
+	assert.Nil(t, err)
+	assert.Contains(t, string(dat), "wsupdater_consecutive_failures 2\n")
+
+	// only the metrics and state files are left behind
+	entries, err := os.ReadDir(tmpDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+}
+
+func TestMetrics_WriteMetrics_disabled(t *testing.T) {
+	var args Args
+	args.Statefile = filepath.Join(t.TempDir(), METRICS_STATE_FILE_NAME)
+
+	assert.Nil(t, WriteMetrics(args, Result{Action: ACTION_CHECK}))
+	assert.False(t, fileExists(args.Statefile))
+}
@@ -1,11 +1,12 @@
 package updater
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
@@ -21,24 +22,39 @@ const (
 
 // DownloadFileToDisk will download the content linked by one of the provided urls and save it locally to localpath. It
 // will try all URLs in order until one succeeds. If all fail it will return an error.
-func DownloadFileToDisk(urls []string, localpath string) error {
+func DownloadFileToDisk(ctx context.Context, client *http.Client, urls []string, localpath string, logger *Logger) error {
+	return downloadFileToDisk(ctx, OSFS{}, client, urls, localpath, logger)
+}
+
+// downloadFileToDisk downloads to `localpath` in `fsys`
+func downloadFileToDisk(ctx context.Context, fsys FS, client *http.Client, urls []string, localpath string, logger *Logger) error {
 	if len(localpath) == 0 {
 		return fmt.Errorf("Error trying to save file: no file path provide")
 	}
 
 	// Create the local output file
-	out, err := os.Create(localpath)
+	f, err := createFile(fsys, localpath)
 	if nil != err {
 		return fmt.Errorf("Error trying to save file \"%s\": %w", localpath, err)
 	}
-	defer out.Close()
+	out := &downloadFile{File: f, fsys: fsys, path: localpath}
 
-	return DownloadFileToWriter(urls, out)
+	err = DownloadFileToWriter(ctx, client, urls, out, logger)
+	if e := out.Close(); err == nil && e != nil {
+		err = fmt.Errorf("Error trying to save file \"%s\": %w", localpath, e)
+	}
+	return err
 }
 
-// DownloadFileToWriter will download the content linked by one of the provided urls and write it to the provided writer. It
-// will try all URLs in order until one succeeds. If all fail it will return an error.
-func DownloadFileToWriter(urls []string, writer io.Writer) error {
+// DownloadFileToWriter will download the content linked by one of the
+// provided urls and write it to the provided writer. It will try all URLs in
+// order until one succeeds. If all fail it will return an error. No more
+// URLs are tried once `ctx` is done. Each URL is fetched by the Fetcher of
+// its scheme (see GetFile). What a URL that fails part way wrote is removed
+// before the next URL is tried, which needs a *bytes.Buffer or a writer that
+// can seek and truncate (e.g., an *os.File); for other writers no more URLs
+// are tried.
+func DownloadFileToWriter(ctx context.Context, client *http.Client, urls []string, writer io.Writer, logger *Logger) error {
 	if len(urls) == 0 {
 		err := fmt.Errorf("No download urls are specified.")
 		return err
@@ -48,33 +64,97 @@ func DownloadFileToWriter(urls []string, writer io.Writer) error {
 	var result error
 	for _, url := range urls {
 		//  GET file, if we fail try next URL, otherwise return success (nil)
-		err := HTTPGetFile(url, writer)
+		logger.Debugf("Downloading %s", redactURL(url))
+		attempt := &countingWriter{w: writer}
+		err := GetFile(ctx, client, url, attempt)
 		if nil == err {
 			return nil
 		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("download cancelled; %w", ctx.Err())
+		}
 
+		logger.Warnf("Download failed; %v", err)
 		result = multierror.Append(result, err)
+
+		// the next URL's content mustn't be appended to the partial content
+		if attempt.n > 0 {
+			if err := rewindWriter(writer, attempt.n); err != nil {
+				return multierror.Append(result, err)
+			}
+		}
 	}
 
 	return result
 }
 
-// HTTPGetFile GETs the contented linked by the URL and writes it to the writer and
-// returns an error if the content is HTML or the HTTP request doesn't respond with 200 (OK).
-func HTTPGetFile(URL string, writer io.Writer) error {
-	httpTransport := &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: time.Second * TimeoutDial,
-		}).Dial,
-		TLSHandshakeTimeout: time.Second * TimeoutTLSHandshake,
+// countingWriter counts the bytes written to `w`
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// rewinder is a writer that can remove the last `n` bytes written to it
+type rewinder interface {
+	Rewind(n int64) error
+}
+
+// rewindWriter removes the last `n` bytes written to `w`
+func rewindWriter(w io.Writer, n int64) error {
+	switch w := w.(type) {
+	case rewinder:
+		return w.Rewind(n)
+	case *bytes.Buffer:
+		w.Truncate(w.Len() - int(n))
+		return nil
+	case interface {
+		io.Seeker
+		Truncate(size int64) error
+	}:
+		offset, err := w.Seek(-n, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		return w.Truncate(offset)
 	}
+	return fmt.Errorf("can't remove the %d bytes written by the failed download, not trying the other urls", n)
+}
 
-	httpClient := &http.Client{
-		Timeout:   time.Second * TimeoutClient,
-		Transport: httpTransport,
+// downloadFile is the file downloadFileToDisk saves to
+type downloadFile struct {
+	File
+	fsys FS
+	path string
+}
+
+// Rewind empties the file, only the failed attempt was written to it
+func (f *downloadFile) Rewind(n int64) error {
+	f.File.Close()
+	out, err := createFile(f.fsys, f.path)
+	if err != nil {
+		return fmt.Errorf("Error trying to save file \"%s\": %w", f.path, err)
+	}
+	f.File = out
+	return nil
+}
+
+// HTTPGetFile GETs the contented linked by the URL and writes it to the writer and
+// returns an error if the content is HTML or the HTTP request doesn't respond with 200 (OK).
+// A client with the updater's timeouts is used if `client` is nil. The request is aborted
+// when `ctx` is done.
+func HTTPGetFile(ctx context.Context, client *http.Client, URL string, writer io.Writer) error {
+	httpClient := client
+	if httpClient == nil {
+		httpClient = newHTTPClient()
 	}
 
-	req, err := http.NewRequest(http.MethodGet, URL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, URL, nil)
 	if nil != err {
 		return err
 	}
@@ -106,3 +186,59 @@ func HTTPGetFile(URL string, writer io.Writer) error {
 	return nil
 
 }
+
+// HTTPPostJSON POSTs the JSON `body` to the URL. An error is returned if the
+// server doesn't respond with a 2xx status, the *HTTPStatusError has the status.
+// A client with the updater's timeouts is used if `client` is nil. The request
+// is aborted when `ctx` is done.
+func HTTPPostJSON(ctx context.Context, client *http.Client, URL string, body []byte) error {
+	httpClient := client
+	if httpClient == nil {
+		httpClient = newHTTPClient()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, URL, bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+
+	req.Header.Set("User-Agent", useragent.GetUserAgentString())
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if nil != err {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &HTTPStatusError{URL: URL, StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// HTTPStatusError is returned when a server responds with an unexpected status
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("Unexpected response from \"%s\": %s", e.URL, http.StatusText(e.StatusCode))
+}
+
+// newHTTPClient returns an HTTP client with the updater's timeouts
+func newHTTPClient() *http.Client {
+	httpTransport := &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout: time.Second * TimeoutDial,
+		}).Dial,
+		TLSHandshakeTimeout: time.Second * TimeoutTLSHandshake,
+	}
+
+	return &http.Client{
+		Timeout:   time.Second * TimeoutClient,
+		Transport: httpTransport,
+	}
+}
@@ -1,11 +1,15 @@
 package updater
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -23,7 +27,7 @@ func TestNet_HTTPGetFile_Timeout(t *testing.T) {
 	}))
 	defer server1.Close()
 
-	err := HTTPGetFile(server1.URL, nil)
+	err := HTTPGetFile(context.Background(), nil, server1.URL, nil)
 	t.Log(err)
 	assert.NotNil(t, err)
 }
@@ -54,7 +58,7 @@ func TestNet_HTTPGetFile_BadWriter(t *testing.T) {
 	}))
 	defer server1.Close()
 
-	err := HTTPGetFile(server1.URL, ErrWriter(errors.New("I can't write!")))
+	err := HTTPGetFile(context.Background(), nil, server1.URL, ErrWriter(errors.New("I can't write!")))
 	t.Log(err)
 	assert.NotNil(t, err)
 }
@@ -79,7 +83,7 @@ func TestNet_DownloadFile_Success(t *testing.T) {
 	defer server2.Close()
 
 	f := SetupTmpLog()
-	err := DownloadFileToDisk([]string{server1.URL, server2.URL}, f.Name())
+	err := DownloadFileToDisk(context.Background(), nil, []string{server1.URL, server2.URL}, f.Name(), nil)
 	assert.Nil(t, err)
 
 	origHash, err := GetSHA256(wysFile)
@@ -90,6 +94,50 @@ func TestNet_DownloadFile_Success(t *testing.T) {
 	assert.Equal(t, origHash, newHash)
 }
 
+func TestNet_DownloadFile_partial(t *testing.T) {
+	// the first URL fails part way through the body
+	server1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+	}))
+	defer server1.Close()
+
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("complete"))
+	}))
+	defer server2.Close()
+	urls := []string{server1.URL, server2.URL}
+
+	// the partial content isn't kept
+	var buf bytes.Buffer
+	buf.WriteString("before:")
+	assert.Nil(t, DownloadFileToWriter(context.Background(), nil, urls, &buf, nil))
+	assert.Equal(t, "before:complete", buf.String())
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "wys"))
+	assert.Nil(t, err)
+	defer f.Close()
+	assert.Nil(t, DownloadFileToWriter(context.Background(), nil, urls, f, nil))
+	assert.Equal(t, "complete", readTestFile(t, f.Name()))
+
+	m := NewMemFS()
+	dir := filepath.Join(string(filepath.Separator), "dl")
+	assert.Nil(t, m.MkdirAll(dir, 0755))
+	assert.Nil(t, downloadFileToDisk(context.Background(), m, nil, urls, filepath.Join(dir, "wys"), nil))
+	assert.Equal(t, "complete", readMemFile(t, m, filepath.Join(dir, "wys")))
+
+	// a writer that can't be rewound isn't written to by the next URL
+	var w struct{ io.Writer }
+	w.Writer = &buf
+	buf.Reset()
+	err = DownloadFileToWriter(context.Background(), nil, urls, w, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not trying the other urls")
+	assert.Equal(t, "partial", buf.String())
+}
+
 func TestNet_DownloadFile_AllError(t *testing.T) {
 	server1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, useragent.GetUserAgentString(), r.Header.Get("User-Agent"))
@@ -104,7 +152,7 @@ func TestNet_DownloadFile_AllError(t *testing.T) {
 	defer server2.Close()
 
 	f := SetupTmpLog()
-	err := DownloadFileToDisk([]string{server1.URL, server2.URL, "http://foo.bar"}, f.Name())
+	err := DownloadFileToDisk(context.Background(), nil, []string{server1.URL, server2.URL, "http://foo.bar"}, f.Name(), nil)
 	assert.NotNil(t, err)
 	_, ok := err.(*multierror.Error)
 	assert.True(t, ok)
@@ -125,20 +173,41 @@ func TestNet_DownloadFile_webpage(t *testing.T) {
 	defer server2.Close()
 
 	f := SetupTmpLog()
-	err := DownloadFileToDisk([]string{server1.URL, server2.URL}, f.Name())
+	err := DownloadFileToDisk(context.Background(), nil, []string{server1.URL, server2.URL}, f.Name(), nil)
 	assert.NotNil(t, err)
 	_, ok := err.(*multierror.Error)
 	assert.True(t, ok)
 	assert.Contains(t, err.Error(), "a web page was returned from the web server")
 }
 
+func TestNet_DownloadFile_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer server1.Close()
+
+	requested := false
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer server2.Close()
+
+	// the next URL isn't tried
+	f := SetupTmpLog()
+	err := DownloadFileToDisk(ctx, nil, []string{server1.URL, server2.URL}, f.Name(), nil)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, requested)
+}
+
 func TestNet_DownloadFile_NoURLs(t *testing.T) {
 	f := SetupTmpLog()
-	err := DownloadFileToDisk([]string{}, f.Name())
+	err := DownloadFileToDisk(context.Background(), nil, []string{}, f.Name(), nil)
 	assert.NotNil(t, err)
 }
 
 func TestNet_DownloadFile_InvalidLocalFile(t *testing.T) {
-	err := DownloadFileToDisk([]string{"http://foo.bar"}, "/Users/foo")
+	err := DownloadFileToDisk(context.Background(), nil, []string{"http://foo.bar"}, "/Users/foo", nil)
 	assert.NotNil(t, err)
 }
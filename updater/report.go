@@ -0,0 +1,201 @@
+package updater
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MAX_QUEUED_REPORTS is the most reports kept while the report endpoint is
+// unreachable, the oldest are dropped first
+const MAX_QUEUED_REPORTS = 50
+
+// Report is the status report POSTed to the report URL after every check and
+// install
+type Report struct {
+	ID          string    `json:"id"` // unique per report, lets the server ignore duplicates
+	GUID        string    `json:"guid,omitempty"`
+	Action      string    `json:"action"`
+	FromVersion string    `json:"from_version,omitempty"`
+	ToVersion   string    `json:"to_version,omitempty"`
+	Phase       string    `json:"phase,omitempty"`
+	ExitCode    int       `json:"exit_code"`
+	ErrorClass  string    `json:"error_class,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	Rollback    string    `json:"rollback,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// NewReport returns the report for a finished run
+func NewReport(guid string, result Result) Report {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return Report{
+		ID:          hex.EncodeToString(id),
+		GUID:        guid,
+		Action:      result.Action,
+		FromVersion: result.InstalledVersion,
+		ToVersion:   result.AvailableVersion,
+		Phase:       result.Phase,
+		ExitCode:    result.ExitCode,
+		ErrorClass:  result.ErrorClass,
+		Error:       result.Error,
+		DurationMs:  result.DurationMs,
+		Rollback:    result.Rollback,
+		Time:        result.EndTime.UTC(),
+	}
+}
+
+// SendReport reports the result to the report URL given with -reporturl or
+// in the WYC file. Nothing is sent if there is no report URL. The report is
+// queued on disk first, then the queue is sent oldest first; reports that
+// can't be delivered are retried on the next run. Sending stops when `ctx`
+// is done, the queued reports are sent on the next run.
+func SendReport(ctx context.Context, args Args, result Result) error {
+	// the WYC file may be missing or broken, that is worth reporting too
+	iuc, err := Info{FS: args.fs()}.ParseWYC(args.Cdata)
+	if err != nil {
+		args.Logger.Warnf("failed to read the report URL from %s; %v", args.Cdata, err)
+	}
+
+	reportURL := args.Reporturl
+	if len(reportURL) == 0 {
+		reportURL = iuc.ReportURL
+	}
+	if len(reportURL) == 0 {
+		return nil
+	}
+
+	report := NewReport(string(iuc.IucGUID.Value), result)
+	if err := queueReport(args.Reportqueue, report); err != nil {
+		args.Logger.Warnf("failed to queue report; %v", err)
+		// send it anyway
+		return postReport(ctx, args.HTTPClient, reportURL, report)
+	}
+
+	return FlushReports(ctx, args, reportURL)
+}
+
+// FlushReports sends the queued reports to `reportURL`, oldest first. It
+// stops at the first report that can't be delivered, the rest stay queued.
+// A report rejected by the server is dropped, it would never be accepted.
+func FlushReports(ctx context.Context, args Args, reportURL string) error {
+	queued, err := queuedReports(args.Reportqueue)
+	if err != nil {
+		return err
+	}
+
+	for _, fp := range queued {
+		dat, err := os.ReadFile(fp)
+		if err != nil {
+			return err
+		}
+
+		var report Report
+		if err := json.Unmarshal(dat, &report); err != nil {
+			args.Logger.Warnf("dropping unreadable report %s; %v", fp, err)
+			os.Remove(fp)
+			continue
+		}
+
+		err = postReport(ctx, args.HTTPClient, reportURL, report)
+		if err != nil && !isPermanentReportError(err) {
+			return fmt.Errorf("failed to send report, %d queued; %w", len(queued), err)
+		}
+		if err != nil {
+			args.Logger.Warnf("dropping report %s; %v", report.ID, err)
+		}
+		os.Remove(fp)
+	}
+
+	return nil
+}
+
+// postReport POSTs the report to the report URL
+func postReport(ctx context.Context, client *http.Client, reportURL string, report Report) error {
+	dat, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return HTTPPostJSON(ctx, client, reportURL, dat)
+}
+
+// isPermanentReportError returns true if the server rejected the report,
+// as opposed to being unavailable
+func isPermanentReportError(err error) bool {
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+
+	switch statusErr.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return statusErr.StatusCode >= 400 && statusErr.StatusCode < 500
+}
+
+// queueReport writes the report to the queue dir, dropping the oldest
+// reports if the queue is full
+func queueReport(queueDir string, report Report) error {
+	if err := os.MkdirAll(queueDir, 0755); err != nil {
+		return err
+	}
+
+	dat, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	// the name sorts by the time the report was queued
+	name := fmt.Sprintf("%020d-%s.json", time.Now().UnixNano(), report.ID)
+	fp := filepath.Join(queueDir, name)
+	if err := os.WriteFile(fp+".tmp", dat, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(fp+".tmp", fp); err != nil {
+		return err
+	}
+
+	queued, err := queuedReports(queueDir)
+	if err != nil {
+		return err
+	}
+	for len(queued) > MAX_QUEUED_REPORTS {
+		os.Remove(queued[0])
+		queued = queued[1:]
+	}
+	return nil
+}
+
+// queuedReports returns the paths of the queued reports, oldest first
+func queuedReports(queueDir string) ([]string, error) {
+	entries, err := os.ReadDir(queueDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var queued []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		queued = append(queued, filepath.Join(queueDir, e.Name()))
+	}
+	sort.Strings(queued)
+	return queued, nil
+}
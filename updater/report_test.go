@@ -0,0 +1,226 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reportServer records the reports POSTed to it, responding with `status`
+type reportServer struct {
+	mu      sync.Mutex
+	status  int
+	reports []Report
+}
+
+func (rs *reportServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.status != http.StatusOK {
+		w.WriteHeader(rs.status)
+		return
+	}
+
+	var report Report
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rs.reports = append(rs.reports, report)
+}
+
+func testReportResult() Result {
+	result := Result{
+		Action:           ACTION_UPDATE,
+		Phase:            PHASE_INSTALL,
+		InstalledVersion: "1.0.0",
+		AvailableVersion: "1.0.1",
+		Rollback:         ROLLBACK_SUCCEEDED,
+		StartTime:        time.Now(),
+	}
+	result.finish(systemClock{}, EXIT_ERROR, withError(ErrInstall, os.ErrPermission))
+	return result
+}
+
+func TestReport_SendReport(t *testing.T) {
+	rs := &reportServer{status: http.StatusOK}
+	ts := httptest.NewServer(rs)
+	defer ts.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.Reporturl = ts.URL
+	args.Reportqueue = filepath.Join(t.TempDir(), REPORT_QUEUE_DIR_NAME)
+
+	assert.Nil(t, SendReport(context.Background(), args, testReportResult()))
+
+	assert.Equal(t, 1, len(rs.reports))
+	report := rs.reports[0]
+	assert.Equal(t, ACTION_UPDATE, report.Action)
+	assert.Equal(t, "1.0.0", report.FromVersion)
+	assert.Equal(t, "1.0.1", report.ToVersion)
+	assert.Equal(t, PHASE_INSTALL, report.Phase)
+	assert.Equal(t, ERROR_CLASS_INSTALL, report.ErrorClass)
+	assert.Equal(t, ROLLBACK_SUCCEEDED, report.Rollback)
+	assert.NotEmpty(t, report.GUID)
+	assert.NotEmpty(t, report.ID)
+
+	queued, err := queuedReports(args.Reportqueue)
+	assert.Nil(t, err)
+	assert.Empty(t, queued)
+}
+
+func TestReport_SendReport_no_url(t *testing.T) {
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.Reportqueue = filepath.Join(t.TempDir(), REPORT_QUEUE_DIR_NAME)
+
+	assert.Nil(t, SendReport(context.Background(), args, testReportResult()))
+
+	_, err := os.Stat(args.Reportqueue)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReport_SendReport_retry(t *testing.T) {
+	rs := &reportServer{status: http.StatusServiceUnavailable}
+	ts := httptest.NewServer(rs)
+	defer ts.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.Reporturl = ts.URL
+	args.Reportqueue = filepath.Join(t.TempDir(), REPORT_QUEUE_DIR_NAME)
+
+	// the endpoint is down, both reports are kept
+	first := testReportResult()
+	first.Action = ACTION_CHECK
+	assert.NotNil(t, SendReport(context.Background(), args, first))
+	assert.NotNil(t, SendReport(context.Background(), args, testReportResult()))
+
+	queued, err := queuedReports(args.Reportqueue)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(queued))
+
+	// the endpoint is back, the queue is sent oldest first
+	rs.mu.Lock()
+	rs.status = http.StatusOK
+	rs.mu.Unlock()
+	assert.Nil(t, FlushReports(context.Background(), args, ts.URL))
+
+	assert.Equal(t, 2, len(rs.reports))
+	assert.Equal(t, ACTION_CHECK, rs.reports[0].Action)
+	assert.Equal(t, ACTION_UPDATE, rs.reports[1].Action)
+
+	queued, err = queuedReports(args.Reportqueue)
+	assert.Nil(t, err)
+	assert.Empty(t, queued)
+}
+
+func TestReport_SendReport_cancelled(t *testing.T) {
+	rs := &reportServer{status: http.StatusOK}
+	ts := httptest.NewServer(rs)
+	defer ts.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.Reporturl = ts.URL
+	args.Reportqueue = filepath.Join(t.TempDir(), REPORT_QUEUE_DIR_NAME)
+
+	// nothing is sent once the run is cancelled, the report stays queued
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := SendReport(ctx, args, testReportResult())
+	assert.True(t, errors.Is(err, context.Canceled), err)
+	assert.Empty(t, rs.reports)
+
+	queued, err := queuedReports(args.Reportqueue)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(queued))
+}
+
+func TestReport_SendReport_rejected(t *testing.T) {
+	rs := &reportServer{status: http.StatusBadRequest}
+	ts := httptest.NewServer(rs)
+	defer ts.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.Reporturl = ts.URL
+	args.Reportqueue = filepath.Join(t.TempDir(), REPORT_QUEUE_DIR_NAME)
+
+	// a rejected report would never be accepted, it isn't retried
+	assert.Nil(t, SendReport(context.Background(), args, testReportResult()))
+
+	queued, err := queuedReports(args.Reportqueue)
+	assert.Nil(t, err)
+	assert.Empty(t, queued)
+}
+
+func TestReport_queueReport_limit(t *testing.T) {
+	queueDir := t.TempDir()
+	for i := 0; i < MAX_QUEUED_REPORTS+5; i++ {
+		assert.Nil(t, queueReport(queueDir, NewReport("", testReportResult())))
+	}
+
+	queued, err := queuedReports(queueDir)
+	assert.Nil(t, err)
+	assert.Equal(t, MAX_QUEUED_REPORTS, len(queued))
+}
+
+func TestReport_ParseWYC_report_url(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// add the report URL to a copy of the test WYC file
+	_, files, err := Unzip(OSFS{}, "./testdata/client.1.0.0.wyc", filepath.Join(tmpDir, "wyc"))
+	assert.Nil(t, err)
+	reportURLFile := filepath.Join(tmpDir, REPORT_URL_FILE_NAME)
+	assert.Nil(t, os.WriteFile(reportURLFile, []byte("https://example.com/report\n"), 0644))
+
+	wycFile := filepath.Join(tmpDir, CLIENT_WYC)
+	assert.Nil(t, CreateWYCArchive(wycFile, append(files, reportURLFile)))
+
+	iuc, err := Info{}.ParseWYC(wycFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/report", iuc.ReportURL)
+	assert.Equal(t, "1.0.0", string(iuc.IucInstalledVersion.Value))
+}
+
+func TestReport_SendReport_memFS(t *testing.T) {
+	rs := &reportServer{status: http.StatusOK}
+	ts := httptest.NewServer(rs)
+	defer ts.Close()
+
+	// a WYC file with the report URL, only in memory
+	tmpDir := t.TempDir()
+	_, files, err := Unzip(OSFS{}, "./testdata/client.1.0.0.wyc", filepath.Join(tmpDir, "wyc"))
+	assert.Nil(t, err)
+	reportURLFile := filepath.Join(tmpDir, REPORT_URL_FILE_NAME)
+	assert.Nil(t, os.WriteFile(reportURLFile, []byte(ts.URL), 0644))
+	assert.Nil(t, CreateWYCArchive(filepath.Join(tmpDir, CLIENT_WYC), append(files, reportURLFile)))
+	dat, err := os.ReadFile(filepath.Join(tmpDir, CLIENT_WYC))
+	assert.Nil(t, err)
+
+	m := NewMemFS()
+	instDir := filepath.Join(string(filepath.Separator), "widget")
+	assert.Nil(t, m.MkdirAll(instDir, 0755))
+	assert.Nil(t, m.WriteFile(filepath.Join(instDir, CLIENT_WYC), dat, 0644))
+
+	var args Args
+	args.FS = m
+	args.Cdata = filepath.Join(instDir, CLIENT_WYC)
+	args.Reportqueue = filepath.Join(tmpDir, REPORT_QUEUE_DIR_NAME)
+
+	assert.Nil(t, SendReport(context.Background(), args, testReportResult()))
+	assert.Equal(t, 1, len(rs.reports))
+	assert.NotEmpty(t, rs.reports[0].GUID)
+}
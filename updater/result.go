@@ -0,0 +1,132 @@
+package updater
+
+import (
+	"time"
+)
+
+// Actions reported in a Result
+const (
+	ACTION_CHECK        = "check"
+	ACTION_UPDATE       = "update"
+	ACTION_STAGE        = "stage"
+	ACTION_APPLY_STAGED = "applystaged"
+	ACTION_ROLLBACK     = "rollback"
+	ACTION_CLEAR_FAILED = "clearfailed"
+	ACTION_DRY_RUN      = "dryrun"
+)
+
+// Phases of an update, the last one reached is reported in a Result
+const (
+	PHASE_CHECK    = "check"    // downloading and parsing the WYS file
+	PHASE_DOWNLOAD = "download" // downloading the WYU file
+	PHASE_VERIFY   = "verify"   // verifying and extracting the WYU file
+	PHASE_BACKUP   = "backup"   // backing up the files to be replaced
+	PHASE_INSTALL  = "install"  // replacing files and restarting services
+	PHASE_HEALTH   = "health"   // verifying the services are healthy after the update
+	PHASE_COMPLETE = "complete"
+)
+
+// Rollback outcomes reported in a Result
+const (
+	ROLLBACK_SUCCEEDED = "succeeded"
+	ROLLBACK_FAILED    = "failed"
+)
+
+// Error classes reported in a Result
+const (
+	ERROR_CLASS_CONFIG          = "config"          // ErrConfig
+	ERROR_CLASS_NETWORK         = "network"         // ErrNetwork
+	ERROR_CLASS_VERIFICATION    = "verification"    // ErrVerification
+	ERROR_CLASS_SIGNATURE       = "signature"       // ErrSignature
+	ERROR_CLASS_CHECKSUM        = "checksum"        // ErrChecksum
+	ERROR_CLASS_FAILED_BEFORE   = "failed_before"   // ErrFailedBefore
+	ERROR_CLASS_INSTALL         = "install"         // ErrInstall
+	ERROR_CLASS_SERVICE_CONTROL = "service_control" // ErrServiceControl
+	ERROR_CLASS_HEALTH_CHECK    = "health_check"    // ErrHealthCheck
+	ERROR_CLASS_HOOK            = "hook"            // ErrHook
+	ERROR_CLASS_ROLLBACK_FAILED = "rollback_failed" // ErrRollbackFailed
+	ERROR_CLASS_CANCELLED       = "cancelled"       // context.Canceled or context.DeadlineExceeded
+	ERROR_CLASS_LOCKED          = "locked"          // ErrUpdateInProgress
+	ERROR_CLASS_UNKNOWN         = "unknown"
+)
+
+// Result is the machine-readable outcome of a run of the updater. It is
+// written as JSON to the /outputinfo target when -format=json is given and
+// to the -resultfile.
+type Result struct {
+	Action           string         `json:"action"`
+	Phase            string         `json:"phase,omitempty"`
+	InstalledVersion string         `json:"installed_version,omitempty"`
+	AvailableVersion string         `json:"available_version,omitempty"`
+	Changes          string         `json:"changes,omitempty"`
+	ExitCode         int            `json:"exit_code"`
+	ErrorClass       string         `json:"error_class,omitempty"`
+	Error            string         `json:"error,omitempty"`
+	StartTime        time.Time      `json:"start_time"`
+	EndTime          time.Time      `json:"end_time"`
+	DurationMs       int64          `json:"duration_ms"`
+	FilesChanged     []string       `json:"files_changed,omitempty"`
+	Rollback         string         `json:"rollback,omitempty"`
+	FailedInstall    *FailedInstall `json:"failed_install,omitempty"`
+	KeptBackups      []string       `json:"kept_backups,omitempty"` // backups that couldn't be restored
+	BytesDownloaded  int64          `json:"bytes_downloaded,omitempty"`
+	DownloadMs       int64          `json:"download_duration_ms,omitempty"`
+	Plan             *InstallPlan   `json:"plan,omitempty"` // what a dry run would install
+}
+
+// setCandidate fills in the versions and changes from a candidate update
+func (r *Result) setCandidate(req CandidateUpdateRequest) {
+	r.InstalledVersion = string(req.ConfigIUC.IucInstalledVersion.Value)
+	r.AvailableVersion = req.ConfigWYS.VersionToUpdate
+	r.Changes = req.ConfigWYS.LatestChanges
+	r.addDownload(int64(req.CandidateWysFileContent.Len()), req.WysDownloadDuration)
+}
+
+// setFailedInstall records the failed install, if there is one, so the
+// reason is reported by a check
+func (r *Result) setFailedInstall(args Args) {
+	record, err := ReadFailedInstall(args.fs(), args.instDir())
+	if err != nil {
+		args.Logger.Warnf("%v", err)
+		return
+	}
+	if record != nil {
+		args.Logger.Infof("Version %s failed to install %d times; %s", record.Version, record.Attempts, record.Reason)
+	}
+	r.FailedInstall = record
+}
+
+// UpdateAvailable returns true if a check found an update
+func (r Result) UpdateAvailable() bool {
+	return r.Action == ACTION_CHECK && r.ExitCode == EXIT_UPDATE_AVALIABLE
+}
+
+// addDownload records `n` bytes downloaded in `d`
+func (r *Result) addDownload(n int64, d time.Duration) {
+	r.BytesDownloaded += n
+	r.DownloadMs += d.Milliseconds()
+}
+
+// checkedVersion returns the version wyUpdate reports for a check, the newer
+// of the installed and available versions
+func (r Result) checkedVersion() string {
+	if CompareVersions(r.InstalledVersion, r.AvailableVersion) == A_GREATER_THAN_B {
+		return r.InstalledVersion
+	}
+	return r.AvailableVersion
+}
+
+// finish records the exit code, error and end time, the end time is told by
+// `clock` like the start time
+func (r *Result) finish(clock Clock, rc int, err error) {
+	r.ExitCode = rc
+	if err != nil {
+		r.Error = err.Error()
+		r.ErrorClass = ErrorClass(err)
+	}
+
+	r.EndTime = clock.Now()
+	if !r.StartTime.IsZero() {
+		r.DurationMs = r.EndTime.Sub(r.StartTime).Milliseconds()
+	}
+}
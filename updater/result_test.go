@@ -0,0 +1,82 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResult_finish(t *testing.T) {
+	result := Result{StartTime: time.Now().Add(-time.Second)}
+	result.finish(systemClock{}, EXIT_ERROR, withError(ErrInstall, errors.New("boom")))
+
+	assert.Equal(t, EXIT_ERROR, result.ExitCode)
+	assert.Equal(t, "boom", result.Error)
+	assert.Equal(t, ERROR_CLASS_INSTALL, result.ErrorClass)
+	assert.True(t, result.DurationMs >= 1000)
+	assert.False(t, result.EndTime.Before(result.StartTime))
+}
+
+func TestResult_checkedVersion(t *testing.T) {
+	result := Result{InstalledVersion: "1.0.0", AvailableVersion: "1.0.1"}
+	assert.Equal(t, "1.0.1", result.checkedVersion())
+
+	result = Result{InstalledVersion: "1.0.2", AvailableVersion: "1.0.1"}
+	assert.Equal(t, "1.0.2", result.checkedVersion())
+}
+
+func TestResult_checkForUpdate(t *testing.T) {
+	wysFile := "./testdata/widgetX.1.0.1.wys"
+
+	// wys server
+	tsWYS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		dat, err := os.ReadFile(wysFile)
+		assert.Nil(t, err)
+		w.Write(dat)
+	}))
+	defer tsWYS.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.WYSTestServer = tsWYS.URL
+
+	var result Result
+	rc, err := checkForUpdate(context.Background(), Info{}, args, &result)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_UPDATE_AVALIABLE, rc)
+	assert.Equal(t, "1.0.0", result.InstalledVersion)
+	assert.Equal(t, "1.0.1", result.AvailableVersion)
+
+	// the legacy handler returns the version as an error
+	rc, err = CheckForUpdateHandler(Info{}, args)
+	assert.Equal(t, EXIT_UPDATE_AVALIABLE, rc)
+	assert.EqualError(t, err, "1.0.1")
+}
+
+func TestResult_checkForUpdate_network_error(t *testing.T) {
+	// wys server
+	tsWYS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer tsWYS.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.WYSTestServer = tsWYS.URL
+
+	var result Result
+	rc, err := checkForUpdate(context.Background(), Info{}, args, &result)
+	assert.Equal(t, EXIT_ERROR, rc)
+	assert.Equal(t, ERROR_CLASS_NETWORK, ErrorClass(err))
+
+	args.Cdata = "./testdata/foo.wyc"
+	_, err = checkForUpdate(context.Background(), Info{}, args, &result)
+	assert.Equal(t, ERROR_CLASS_CONFIG, ErrorClass(err))
+}
@@ -0,0 +1,162 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// maxBackoffShift caps the exponential backoff so the shift can't overflow
+const maxBackoffShift = 10
+
+// Scheduler periodically checks for updates and installs them when one is
+// available. After a failed cycle the time until the next check doubles (up
+// to MaxBackoff).
+type Scheduler struct {
+	Interval   time.Duration
+	Jitter     time.Duration
+	MaxBackoff time.Duration
+
+	// Check and Update are called for each cycle. NewScheduler sets
+	// these to check for and install updates, recording each result.
+	Check  func(ctx context.Context) (int, error)
+	Update func(ctx context.Context) (int, error)
+
+	// Lock is held for the duration of each cycle (optional). NewScheduler
+	// sets this to take the update lock for the install directory.
+	Lock func() (*InstanceLock, error)
+
+	args     Args
+	failures int
+	rand     *rand.Rand
+}
+
+// NewScheduler returns a Scheduler configured from the command-line arguments
+func NewScheduler(info Info, args Args) *Scheduler {
+	return &Scheduler{
+		Interval:   args.Interval,
+		Jitter:     args.Jitter,
+		MaxBackoff: args.MaxBackoff,
+		Check: func(ctx context.Context) (int, error) {
+			return recordedRun(ctx, info, args, ACTION_CHECK, checkForUpdate)
+		},
+		Update: func(ctx context.Context) (int, error) {
+			return recordedRun(ctx, info, args, ACTION_UPDATE, update)
+		},
+		Lock: func() (*InstanceLock, error) {
+			return AcquireUpdateLock(args.instDir())
+		},
+		args: args,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Run runs update cycles until `ctx` is done. The first cycle runs after
+// a random delay (up to Jitter) so a fleet of machines restarting together
+// don't all check at once. A cycle in progress is cancelled, an update
+// being installed is rolled back.
+func (s *Scheduler) Run(ctx context.Context) {
+	delay := s.jitter()
+	for {
+		if err := sleepContext(ctx, delay); err != nil {
+			return
+		}
+
+		err := s.RunOnce(ctx)
+		if err != nil {
+			s.args.Logger.Errorf("%v", err)
+		}
+
+		delay = s.NextDelay()
+		s.args.Logger.Debugf("Next update check in %v", delay)
+	}
+}
+
+// RunOnce checks for an update and installs it if one is available. The
+// number of consecutive failures is used to calculate the next delay. A
+// cycle skipped because another update is in progress isn't a failure,
+// nor is a cycle cancelled by `ctx`.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	if s.Lock != nil {
+		lock, err := s.Lock()
+		if errors.Is(err, ErrLocked) {
+			return fmt.Errorf("skipping update check; %w", err)
+		}
+		if err != nil {
+			s.failures++
+			return err
+		}
+		defer lock.Release()
+	}
+
+	rc, err := s.Check(ctx)
+	if ctx.Err() != nil {
+		return err
+	}
+	switch rc {
+	case EXIT_UPDATE_AVALIABLE:
+		s.args.Logger.Infof("Update available, updating...")
+		rc, err = s.Update(ctx)
+		if ctx.Err() != nil {
+			return err
+		}
+		if rc != EXIT_SUCCESS {
+			s.failures++
+			if err == nil {
+				err = fmt.Errorf("update failed with exit code %d", rc)
+			}
+			return err
+		}
+	case EXIT_NO_UPDATE:
+		// nothing to do
+	default:
+		s.failures++
+		if err == nil {
+			err = fmt.Errorf("update check failed with exit code %d", rc)
+		}
+		return err
+	}
+
+	s.failures = 0
+	return nil
+}
+
+// NextDelay returns the time to wait before the next cycle
+func (s *Scheduler) NextDelay() time.Duration {
+	return s.backoff() + s.jitter()
+}
+
+// backoff returns Interval doubled for each consecutive failure, capped
+// at MaxBackoff. MaxBackoff never shortens the regular Interval.
+func (s *Scheduler) backoff() time.Duration {
+	if s.failures == 0 {
+		return s.Interval
+	}
+
+	shift := s.failures
+	if shift > maxBackoffShift {
+		shift = maxBackoffShift
+	}
+
+	delay := s.Interval << shift
+	if delay > s.MaxBackoff {
+		delay = s.MaxBackoff
+	}
+	if delay < s.Interval {
+		delay = s.Interval
+	}
+	return delay
+}
+
+// jitter returns a random duration in [0, Jitter)
+func (s *Scheduler) jitter() time.Duration {
+	if s.Jitter <= 0 {
+		return 0
+	}
+	if s.rand == nil {
+		s.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return time.Duration(s.rand.Int63n(int64(s.Jitter)))
+}
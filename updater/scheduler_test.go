@@ -0,0 +1,159 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler_NextDelay_backoff(t *testing.T) {
+	s := Scheduler{
+		Interval:   time.Hour,
+		MaxBackoff: 6 * time.Hour,
+	}
+
+	assert.Equal(t, time.Hour, s.NextDelay())
+
+	s.failures = 1
+	assert.Equal(t, 2*time.Hour, s.NextDelay())
+
+	s.failures = 2
+	assert.Equal(t, 4*time.Hour, s.NextDelay())
+
+	// capped at MaxBackoff
+	s.failures = 3
+	assert.Equal(t, 6*time.Hour, s.NextDelay())
+
+	s.failures = 1000
+	assert.Equal(t, 6*time.Hour, s.NextDelay())
+
+	// MaxBackoff never shortens the interval
+	s.MaxBackoff = time.Minute
+	assert.Equal(t, time.Hour, s.NextDelay())
+}
+
+func TestScheduler_NextDelay_jitter(t *testing.T) {
+	s := Scheduler{
+		Interval: time.Hour,
+		Jitter:   time.Minute,
+	}
+
+	for i := 0; i < 100; i++ {
+		d := s.NextDelay()
+		assert.True(t, d >= time.Hour)
+		assert.True(t, d < time.Hour+time.Minute)
+	}
+}
+
+func TestScheduler_RunOnce(t *testing.T) {
+	checkRC := EXIT_NO_UPDATE
+	var checkErr error
+	updateCount := 0
+	updateRC := EXIT_SUCCESS
+
+	s := Scheduler{
+		Check: func(ctx context.Context) (int, error) {
+			return checkRC, checkErr
+		},
+		Update: func(ctx context.Context) (int, error) {
+			updateCount++
+			return updateRC, nil
+		},
+	}
+
+	// no update; the version is returned as an error
+	checkErr = errors.New("1.0.1")
+	assert.Nil(t, s.RunOnce(context.Background()))
+	assert.Equal(t, 0, updateCount)
+	assert.Equal(t, 0, s.failures)
+
+	// check failed
+	checkRC = EXIT_ERROR
+	checkErr = errors.New("network down")
+	assert.EqualError(t, s.RunOnce(context.Background()), "network down")
+	assert.Equal(t, 1, s.failures)
+
+	// update available but the update fails
+	checkRC = EXIT_UPDATE_AVALIABLE
+	updateRC = EXIT_ERROR
+	assert.NotNil(t, s.RunOnce(context.Background()))
+	assert.Equal(t, 1, updateCount)
+	assert.Equal(t, 2, s.failures)
+
+	// successful update resets the failures
+	updateRC = EXIT_SUCCESS
+	assert.Nil(t, s.RunOnce(context.Background()))
+	assert.Equal(t, 2, updateCount)
+	assert.Equal(t, 0, s.failures)
+}
+
+func TestScheduler_Run(t *testing.T) {
+	cycles := make(chan struct{}, 10)
+	s := Scheduler{
+		Interval: time.Millisecond,
+		Check: func(ctx context.Context) (int, error) {
+			cycles <- struct{}{}
+			return EXIT_NO_UPDATE, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	// wait for a couple of cycles
+	<-cycles
+	<-cycles
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler did not stop")
+	}
+}
+
+func TestScheduler_RunOnce_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := Scheduler{
+		Check: func(ctx context.Context) (int, error) {
+			return EXIT_UPDATE_AVALIABLE, nil
+		},
+		Update: func(ctx context.Context) (int, error) {
+			// stopped while installing
+			cancel()
+			return EXIT_ERROR, fmt.Errorf("install cancelled; %w", ctx.Err())
+		},
+	}
+
+	// the cycle isn't a failure
+	err := s.RunOnce(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 0, s.failures)
+}
+
+func TestScheduler_RunOnce_locked(t *testing.T) {
+	checkCount := 0
+	s := Scheduler{
+		Check: func(ctx context.Context) (int, error) {
+			checkCount++
+			return EXIT_NO_UPDATE, nil
+		},
+		Lock: func() (*InstanceLock, error) {
+			return nil, ErrUpdateInProgress
+		},
+	}
+
+	// the cycle is skipped, but it isn't a failure
+	err := s.RunOnce(context.Background())
+	assert.True(t, errors.Is(err, ErrUpdateInProgress))
+	assert.Equal(t, 0, checkCount)
+	assert.Equal(t, 0, s.failures)
+}
@@ -0,0 +1,54 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+// ServiceHandler runs the updater as a long-running service, checking for
+// and installing updates on a schedule. Only one instance may run per
+// install directory. Returns int exit code and error.
+func ServiceHandler(info Info, args Args) (int, error) {
+	lockPath := filepath.Join(args.instDir(), SERVICE_LOCK_FILE_NAME)
+	lock, err := AcquireInstanceLock(lockPath)
+	if err != nil {
+		err = fmt.Errorf("updater service is already running; %w", err)
+		return EXIT_ERROR, err
+	}
+	defer lock.Release()
+
+	scheduler := NewScheduler(info, args)
+	err = runService(args, scheduler)
+	if err != nil {
+		return EXIT_ERROR, err
+	}
+	return EXIT_SUCCESS, nil
+}
+
+// runForeground runs the scheduler until the process is interrupted. An
+// update in progress is rolled back.
+func runForeground(args Args, scheduler *Scheduler) error {
+	args.Logger.Infof("Checking for updates every %v (jitter %v)", args.Interval, args.Jitter)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(done)
+	}()
+
+	<-sigs
+	args.Logger.Infof("Stopping...")
+	cancel()
+	<-done
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package updater
+
+// runService runs the scheduler in the foreground, there is no service
+// manager to register with
+func runService(args Args, scheduler *Scheduler) error {
+	return runForeground(args, scheduler)
+}
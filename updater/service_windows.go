@@ -0,0 +1,64 @@
+//go:build windows
+// +build windows
+
+package updater
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// updaterService implements svc.Handler
+type updaterService struct {
+	scheduler *Scheduler
+}
+
+// Execute is called by the service manager when the service is started
+func (s *updaterService) Execute(_ []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	changes <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		s.scheduler.Run(ctx)
+		close(done)
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: accepted}
+	for {
+		c := <-r
+		switch c.Cmd {
+		case svc.Interrogate:
+			changes <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			// an update in progress is rolled back
+			changes <- svc.Status{State: svc.StopPending}
+			cancel()
+			<-done
+			return false, 0
+		}
+	}
+}
+
+// runService registers with the service manager when started as a Windows
+// service, otherwise the scheduler is run in the foreground
+func runService(args Args, scheduler *Scheduler) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("failed to determine if running as a service; %w", err)
+	}
+
+	if !isService {
+		return runForeground(args, scheduler)
+	}
+
+	err = svc.Run(args.ServiceName, &updaterService{scheduler: scheduler})
+	if err != nil {
+		return fmt.Errorf("service %s failed; %w", args.ServiceName, err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package updater
+
+import "context"
+
+// ServiceController stops and starts the services named in an update.
+// StartService and StopService stop waiting for the service once `ctx` is
+// done.
+type ServiceController interface {
+	DoesServiceExist(name string) (bool, error)
+	IsServiceRunning(name string) (bool, error)
+	StartService(ctx context.Context, name string, logger *Logger) error
+	StopService(ctx context.Context, name string, logger *Logger) error
+}
+
+// SystemServices controls services with the system service manager
+type SystemServices struct{}
+
+func (SystemServices) DoesServiceExist(name string) (bool, error) {
+	return DoesServiceExist(name)
+}
+
+func (SystemServices) IsServiceRunning(name string) (bool, error) {
+	return IsServiceRunning(name)
+}
+
+func (SystemServices) StartService(ctx context.Context, name string, logger *Logger) error {
+	return StartService(ctx, name, logger)
+}
+
+func (SystemServices) StopService(ctx context.Context, name string, logger *Logger) error {
+	return StopService(ctx, name, logger)
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// Services can only be controlled on Windows. Elsewhere no service exists,
+// so InstallUpdate never tries to stop or start one. This allows the
+// updater to be built and tested on other platforms.
+
+var errServiceControlNotSupported = fmt.Errorf("service control is not supported on %s", runtime.GOOS)
+
+// DoesServiceExist always returns false
+func DoesServiceExist(serviceName string) (bool, error) {
+	return false, nil
+}
+
+// StartService is not supported
+func StartService(ctx context.Context, serviceName string, logger *Logger) error {
+	return errServiceControlNotSupported
+}
+
+// StopService is not supported
+func StopService(ctx context.Context, serviceName string, logger *Logger) error {
+	return errServiceControlNotSupported
+}
+
+// IsServiceRunning is not supported
+func IsServiceRunning(serviceName string) (bool, error) {
+	return false, errServiceControlNotSupported
+}
@@ -4,6 +4,7 @@
 package updater
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -62,8 +63,18 @@ func GetServiceState(serviceName string) (state svc.State, e error) {
 	return status.State, e
 }
 
-// StartService starts a service
-func StartService(serviceName string) error {
+// IsServiceRunning returns true if the service is running
+func IsServiceRunning(serviceName string) (bool, error) {
+	state, err := GetServiceState(serviceName)
+	if err != nil {
+		return false, err
+	}
+	return state == svc.Running, nil
+}
+
+// StartService starts a service, waiting until it is running or `ctx` is
+// done
+func StartService(ctx context.Context, serviceName string, logger *Logger) error {
 	state, e := GetServiceState(serviceName)
 
 	if e != nil {
@@ -71,9 +82,12 @@ func StartService(serviceName string) error {
 	}
 
 	if state == svc.Running {
+		logger.Debugf("Service %s is already running", serviceName)
 		return nil
 	}
 
+	logger.Infof("Starting service %s", serviceName)
+
 	// open service manager, requires admin
 	m, err := mgr.Connect()
 	if err != nil {
@@ -99,7 +113,9 @@ func StartService(serviceName string) error {
 	var status svc.Status
 
 	for i := 0; i < waitForStatusUpdate; i++ {
-		time.Sleep(1 * time.Second)
+		if err := sleepContext(ctx, time.Second); err != nil {
+			return fmt.Errorf("stopped waiting for '%s' to start; %w", serviceName, err)
+		}
 		status, err := GetServiceState(serviceName)
 
 		if err == nil && status == svc.Running {
@@ -111,8 +127,8 @@ func StartService(serviceName string) error {
 	return fmt.Errorf("'%s' did not start in time; status: %+v", serviceName, status)
 }
 
-// StopService stops a service
-func StopService(serviceName string) error {
+// StopService stops a service, waiting until it is stopped or `ctx` is done
+func StopService(ctx context.Context, serviceName string, logger *Logger) error {
 	state, e := GetServiceState(serviceName)
 
 	if e != nil {
@@ -120,9 +136,12 @@ func StopService(serviceName string) error {
 	}
 
 	if state == svc.Stopped {
+		logger.Debugf("Service %s is already stopped", serviceName)
 		return nil
 	}
 
+	logger.Infof("Stopping service %s", serviceName)
+
 	// open service manager, requires admin
 	m, err := mgr.Connect()
 	if nil != err {
@@ -149,7 +168,9 @@ func StopService(serviceName string) error {
 	var status svc.Status
 
 	for i := 0; i < retries; i++ {
-		time.Sleep(1 * time.Second)
+		if err := sleepContext(ctx, time.Second); err != nil {
+			return fmt.Errorf("stopped waiting for '%s' to stop; %w", serviceName, err)
+		}
 		status, err := GetServiceState(serviceName)
 
 		if err == nil && status == svc.Stopped {
@@ -1,6 +1,7 @@
 package updater
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -38,10 +39,10 @@ func TestServiceControl(t *testing.T) {
 }
 
 func stopTestService() error {
-	return StopService(TEST_SERVICE_NAME)
+	return StopService(context.Background(), TEST_SERVICE_NAME, nil)
 }
 
 // startTestService ...
 func startTestService() error {
-	return StartService(TEST_SERVICE_NAME)
+	return StartService(context.Background(), TEST_SERVICE_NAME, nil)
 }
@@ -2,10 +2,14 @@ package updater
 
 import (
 	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/pem"
 	"encoding/xml"
+	"fmt"
 	"math/big"
 )
 
@@ -43,6 +47,10 @@ func ParsePublicKey(s string) (Key, error) {
 		return key, err
 	}
 
+	if len(data) == 0 || len(data) > 4 {
+		return key, fmt.Errorf("invalid public key exponent: %d bytes", len(data))
+	}
+
 	// sometimes the exponent is not 4 bytes, so we make it 4 bytes
 	// >>> binary = base64.b64decode('AQAB')
 	// >>> binary
@@ -53,6 +61,7 @@ func ParsePublicKey(s string) (Key, error) {
 	copy(b[4-len(data):], data)
 	i := binary.BigEndian.Uint32(b[:])
 	key.Exponent = int(i)
+	key.PublicKey = rsa.PublicKey{N: key.Modulus, E: key.Exponent}
 
 	return key, nil
 }
@@ -66,3 +75,44 @@ func VerifyHash(pub *rsa.PublicKey, hashed []byte, sig []byte) error {
 	}
 	return nil
 }
+
+// SignHash signs the SHA1 `hashed` with `priv`, the signature is verified by
+// VerifyHash
+func SignHash(priv *rsa.PrivateKey, hashed []byte) ([]byte, error) {
+	return rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA1, hashed)
+}
+
+// SignFile returns the signature of the SHA1 of `path`, as stored in
+// BYTE_WYS_FILE_SHA1 for a WYU file
+func SignFile(priv *rsa.PrivateKey, path string) ([]byte, error) {
+	hashed, err := GenerateSHA1HashFromFilePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return SignHash(priv, hashed)
+}
+
+// ParsePrivateKeyPEM parses a PEM encoded RSA private key (PKCS #1 or
+// PKCS #8)
+func ParsePrivateKeyPEM(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("not an RSA private key")
+		}
+		return priv, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
@@ -5,8 +5,10 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/pem"
 	"fmt"
 	"testing"
 
@@ -42,6 +44,16 @@ func TestSigner_ParsePublicKey(t *testing.T) {
 	_, err = ParsePublicKey(ks)
 	assert.NotNil(t, err)
 
+	// the exponent doesn't fit in an int32
+	b64Exp = base64.StdEncoding.EncodeToString([]byte{1, 0, 0, 0, 1})
+	ks = fmt.Sprintf("<RSAKeyValue><Modulus>%s</Modulus><Exponent>%s</Exponent></RSAKeyValue>", b64Mod, b64Exp)
+	_, err = ParsePublicKey(ks)
+	assert.NotNil(t, err)
+
+	ks = fmt.Sprintf("<RSAKeyValue><Modulus>%s</Modulus><Exponent></Exponent></RSAKeyValue>", b64Mod)
+	_, err = ParsePublicKey(ks)
+	assert.NotNil(t, err)
+
 	_, err = ParsePublicKey("")
 	assert.NotNil(t, err)
 }
@@ -68,3 +80,40 @@ func TestSigner_VerifyHash(t *testing.T) {
 	err = VerifyHash(&privKey2.PublicKey, hashed[:], signature)
 	assert.NotNil(t, err)
 }
+
+func TestSigner_SignFile(t *testing.T) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	wyu := "./testdata/widgetX.1.0.1.wyu"
+	signature, err := SignFile(privKey, wyu)
+	assert.Nil(t, err)
+
+	hashed, err := GenerateSHA1HashFromFilePath(wyu)
+	assert.Nil(t, err)
+	assert.Nil(t, VerifyHash(&privKey.PublicKey, hashed, signature))
+}
+
+func TestSigner_ParsePrivateKeyPEM(t *testing.T) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privKey)})
+	key, err := ParsePrivateKeyPEM(pkcs1)
+	assert.Nil(t, err)
+	assert.True(t, privKey.Equal(key))
+
+	der, err := x509.MarshalPKCS8PrivateKey(privKey)
+	assert.Nil(t, err)
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	key, err = ParsePrivateKeyPEM(pkcs8)
+	assert.Nil(t, err)
+	assert.True(t, privKey.Equal(key))
+
+	_, err = ParsePrivateKeyPEM([]byte("not a key"))
+	assert.NotNil(t, err)
+
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{}})
+	_, err = ParsePrivateKeyPEM(public)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,341 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Files inside the staging directory. The manifest (STAGING_MANIFEST_FILE_NAME)
+// is written last, its presence means staging completed.
+const (
+	stagedWysFileName = "wys"   // the server file the update was staged from
+	stagedWyuFileName = "wyu"   // the verified update archive
+	stagedFilesDir    = "files" // the extracted contents of the wyu
+)
+
+// StagingManifest records an update that has been downloaded, verified and
+// extracted, but not yet installed
+type StagingManifest struct {
+	InstalledVersion string    `json:"installed_version"`
+	VersionToUpdate  string    `json:"version_to_update"`
+	LatestChanges    string    `json:"latest_changes,omitempty"`
+	WYUAdler32       int64     `json:"wyu_adler32"`
+	WYUSize          int64     `json:"wyu_size"`
+	Files            []string  `json:"files"` // relative to the files dir
+	StagedAt         time.Time `json:"staged_at"`
+}
+
+// StageHandler downloads the WYS and WYU files, verifies the update and
+// extracts it to the staging directory so it can later be installed by
+// ApplyStagedHandler. Returns int exit code and error.
+func StageHandler(infoer Infoer, args Args) (int, error) {
+	var result Result
+	return stage(context.Background(), infoer, args, &result)
+}
+
+// stage stages the update, filling in the details of the update in
+// `result`. Returns int exit code and error.
+func stage(ctx context.Context, infoer Infoer, args Args, result *Result) (int, error) {
+	result.Phase = PHASE_CHECK
+	candidateUpdateReq, err := NewCandidateUpdateRequest(ctx, args, infoer)
+	if err != nil {
+		return EXIT_ERROR, err
+	}
+	result.setCandidate(candidateUpdateReq)
+
+	iuc := candidateUpdateReq.ConfigIUC
+	wys := candidateUpdateReq.ConfigWYS
+	installedVersion := string(iuc.IucInstalledVersion.Value)
+
+	// only stage updates we would actually install
+	if CompareVersions(installedVersion, wys.VersionToUpdate) != A_LESS_THAN_B {
+		return EXIT_NO_UPDATE, nil
+	}
+
+	fsys := args.fs()
+	stageDir := args.Stagedir
+	if err := checkStageDir(stageDir, args.instDir()); err != nil {
+		return EXIT_ERROR, withError(ErrConfig, err)
+	}
+
+	// throw away anything previously staged
+	if err := clearStageDir(fsys, stageDir); err != nil {
+		err = fmt.Errorf("failed to remove staging dir: %v; %w", stageDir, err)
+		return EXIT_ERROR, err
+	}
+	if err := fsys.MkdirAll(stageDir, 0755); err != nil {
+		err = fmt.Errorf("failed to create staging dir: %v; %w", stageDir, err)
+		return EXIT_ERROR, err
+	}
+
+	manifest, err := stageUpdate(ctx, args, candidateUpdateReq, result)
+	if err != nil {
+		// don't leave a partially staged update behind
+		DeleteDirectory(fsys, stageDir)
+		return EXIT_ERROR, err
+	}
+
+	err = writeStagingManifest(fsys, stageDir, manifest)
+	if err != nil {
+		DeleteDirectory(fsys, stageDir)
+		return EXIT_ERROR, err
+	}
+
+	result.Phase = PHASE_COMPLETE
+	return EXIT_SUCCESS, nil
+}
+
+// stageUpdate writes the candidate update into the staging directory and
+// returns the manifest describing it
+func stageUpdate(ctx context.Context, args Args, req CandidateUpdateRequest, result *Result) (StagingManifest, error) {
+	var manifest StagingManifest
+	fsys := args.fs()
+	stageDir := args.Stagedir
+	iuc := req.ConfigIUC
+	wys := req.ConfigWYS
+
+	// write the contents of the wys file to disk (contains details about the available update)
+	wysFilePath := filepath.Join(stageDir, stagedWysFileName)
+	err := fsys.WriteFile(wysFilePath, req.CandidateWysFileContent.Bytes(), 0644)
+	if err != nil {
+		err = fmt.Errorf("failed to write WYS file to: %v; %w", wysFilePath, err)
+		return manifest, err
+	}
+
+	// download WYU (this is the archive with the updated files)
+	wyuFilePath := filepath.Join(stageDir, stagedWyuFileName)
+	result.Phase = PHASE_DOWNLOAD
+	start := args.clock().Now()
+	downloaded, err := wys.getWyuFile(ctx, args, wyuFilePath)
+	if err != nil {
+		return manifest, err
+	}
+	if downloaded > 0 {
+		result.addDownload(downloaded, args.clock().Now().Sub(start))
+	}
+
+	result.Phase = PHASE_VERIFY
+	if err := verifyWyuSignature(args, iuc, wys, wyuFilePath); err != nil {
+		return manifest, err
+	}
+
+	// extract the WYU and make sure it contains the update details
+	filesDir := filepath.Join(stageDir, stagedFilesDir)
+	_, files, err := Unzip(fsys, wyuFilePath, filesDir)
+	if nil != err {
+		err = fmt.Errorf("error unzipping %s; %w", wyuFilePath, err)
+		return manifest, withError(ErrVerification, err)
+	}
+
+	if _, _, err := GetUpdateDetails(fsys, files); err != nil {
+		return manifest, withError(ErrVerification, err)
+	}
+
+	if _, err := LoadHooks(fsys, files); err != nil {
+		return manifest, withError(ErrVerification, err)
+	}
+
+	fi, err := fsys.Stat(wyuFilePath)
+	if err != nil {
+		return manifest, err
+	}
+
+	manifest = StagingManifest{
+		InstalledVersion: string(iuc.IucInstalledVersion.Value),
+		VersionToUpdate:  wys.VersionToUpdate,
+		LatestChanges:    wys.LatestChanges,
+		WYUAdler32:       wys.UpdateFileAdler32,
+		WYUSize:          fi.Size(),
+		StagedAt:         args.clock().Now().UTC(),
+	}
+
+	for _, f := range files {
+		rel, err := filepath.Rel(filesDir, f)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Files = append(manifest.Files, rel)
+	}
+
+	return manifest, nil
+}
+
+// ApplyStagedHandler installs an update previously staged by StageHandler.
+// The staged WYU is re-verified against the WYC file but no network access
+// is required. Returns int exit code and error.
+func ApplyStagedHandler(infoer Infoer, args Args) (int, error) {
+	var result Result
+	return applyStaged(context.Background(), infoer, args, &result)
+}
+
+// applyStaged installs the staged update, filling in the details of the
+// update in `result`. Returns int exit code and error.
+func applyStaged(ctx context.Context, infoer Infoer, args Args, result *Result) (rc int, err error) {
+	fsys := args.fs()
+	stageDir := args.Stagedir
+	result.Phase = PHASE_VERIFY
+	manifest, err := ReadStagingManifest(fsys, stageDir)
+	if err != nil {
+		return EXIT_ERROR, withError(ErrConfig, err)
+	}
+	result.InstalledVersion = manifest.InstalledVersion
+	result.AvailableVersion = manifest.VersionToUpdate
+	result.Changes = manifest.LatestChanges
+
+	defer func() { emitOutcome(args, result, rc, err) }()
+
+	if err := checkStageDir(stageDir, args.instDir()); err != nil {
+		return EXIT_ERROR, withError(ErrConfig, err)
+	}
+
+	// like a downloaded update, an update that failed to install isn't
+	// retried until its backoff has passed. The staged update is kept so it
+	// can be applied then.
+	wysFilePath := filepath.Join(stageDir, stagedWysFileName)
+	wysFileContent, err := fsys.ReadFile(wysFilePath)
+	if err != nil {
+		err = fmt.Errorf("error reading staged WYS file; %w", err)
+		return EXIT_ERROR, withError(ErrVerification, err)
+	}
+	if err := checkFailedInstall(args, wysFileContent, manifest.VersionToUpdate); err != nil {
+		return EXIT_ERROR, err
+	}
+
+	emitEvent(args, EVENT_UPDATE_STARTED, "updating from version %s to staged version %s", result.InstalledVersion, result.AvailableVersion)
+
+	// whatever happens from here on, the staged update is used up
+	defer DeleteDirectory(fsys, stageDir)
+
+	// parse the WYC file to get the installed version and public key
+	wycFilePath := args.Cdata
+	iuc, err := infoer.ParseWYC(wycFilePath)
+	if nil != err {
+		err = fmt.Errorf("error reading WYC file: %s; %w", wycFilePath, err)
+		return EXIT_ERROR, withError(ErrConfig, err)
+	}
+
+	installedVersion := string(iuc.IucInstalledVersion.Value)
+	if installedVersion != manifest.InstalledVersion {
+		result.InstalledVersion = installedVersion
+		err = fmt.Errorf("staged update was for version %s, but version %s is installed", manifest.InstalledVersion, installedVersion)
+		return EXIT_ERROR, withError(ErrConfig, err)
+	}
+
+	wys, err := infoer.ParseWYSFromFilePath(wysFilePath, args)
+	if nil != err {
+		err = fmt.Errorf("error parsing staged WYS file; %w", err)
+		return EXIT_ERROR, withError(ErrVerification, err)
+	}
+
+	// the staged files could have been sitting on disk for a while, check
+	// them again before installing
+	wyuFilePath := filepath.Join(stageDir, stagedWyuFileName)
+	if !verifyAdler32Checksum(fsys, wys.UpdateFileAdler32, wyuFilePath) {
+		err = fmt.Errorf(`The staged file "%s" failed the Adler32 validation.`, wyuFilePath)
+		return EXIT_ERROR, withError(ErrChecksum, err)
+	}
+
+	if err := verifyWyuSignature(args, iuc, wys, wyuFilePath); err != nil {
+		return EXIT_ERROR, err
+	}
+
+	filesDir := filepath.Join(stageDir, stagedFilesDir)
+	files := make([]string, 0, len(manifest.Files))
+	for _, f := range manifest.Files {
+		fp := filepath.Join(filesDir, f)
+		if !pathExists(fsys, fp) {
+			err = fmt.Errorf("staged file %s is missing", fp)
+			return EXIT_ERROR, withError(ErrVerification, err)
+		}
+		files = append(files, fp)
+	}
+
+	return applyUpdate(ctx, args, iuc, wys.VersionToUpdate, files, wysFilePath, result)
+}
+
+// checkStageDir returns an error if the staging dir can't be used for the
+// install dir: the install dir itself, a directory it is in (e.g., the root
+// of the volume), which staging would clear, or a directory on another
+// volume. The staged files are moved into the install dir, which fails
+// across volumes.
+func checkStageDir(stageDir string, instDir string) error {
+	stageAbs, err := filepath.Abs(stageDir)
+	if err != nil {
+		return err
+	}
+	instAbs, err := filepath.Abs(instDir)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(filepath.VolumeName(stageAbs), filepath.VolumeName(instAbs)) {
+		return fmt.Errorf("staging dir %s isn't on the volume of the install dir %s", stageDir, instDir)
+	}
+	if filepath.Dir(stageAbs) == stageAbs {
+		return fmt.Errorf("staging dir %s is the root of the volume", stageDir)
+	}
+	if rel, err := filepath.Rel(stageAbs, instAbs); err == nil && filepath.IsLocal(rel) {
+		return fmt.Errorf("staging dir %s contains the install dir %s", stageDir, instDir)
+	}
+	return nil
+}
+
+// clearStageDir throws away the update previously staged in stageDir. Only
+// a staging dir with a manifest is removed, an empty one is used as it is
+// and anything else is refused, so the wrong -stagedir can't delete other
+// files.
+func clearStageDir(fsys FS, stageDir string) error {
+	entries, err := fsys.ReadDir(stageDir)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(entries) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !pathExists(fsys, filepath.Join(stageDir, STAGING_MANIFEST_FILE_NAME)) {
+		err := fmt.Errorf("staging dir %s isn't empty and has no staged update, remove it or use another -stagedir", stageDir)
+		return withError(ErrConfig, err)
+	}
+	return DeleteDirectory(fsys, stageDir)
+}
+
+// ReadStagingManifest reads the manifest of the update staged in stageDir
+func ReadStagingManifest(fsys FS, stageDir string) (manifest StagingManifest, err error) {
+	manifestPath := filepath.Join(stageDir, STAGING_MANIFEST_FILE_NAME)
+	dat, err := fsOrOS(fsys).ReadFile(manifestPath)
+	if err != nil {
+		err = fmt.Errorf("no staged update found in %s; %w", stageDir, err)
+		return manifest, err
+	}
+
+	err = json.Unmarshal(dat, &manifest)
+	if err != nil {
+		err = fmt.Errorf("error parsing staging manifest %s; %w", manifestPath, err)
+		return StagingManifest{}, err
+	}
+
+	return manifest, nil
+}
+
+// writeStagingManifest writes the manifest into stageDir. The manifest is
+// written to a temp file and renamed so a partially written manifest is
+// never mistaken for a completed staging.
+func writeStagingManifest(fsys FS, stageDir string, manifest StagingManifest) error {
+	dat, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	manifestPath := filepath.Join(stageDir, STAGING_MANIFEST_FILE_NAME)
+	tmpPath := manifestPath + ".tmp"
+	if err := fsys.WriteFile(tmpPath, dat, 0644); err != nil {
+		return fmt.Errorf("failed to write staging manifest: %v; %w", tmpPath, err)
+	}
+
+	return fsys.Rename(tmpPath, manifestPath)
+}
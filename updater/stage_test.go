@@ -0,0 +1,277 @@
+package updater
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stagingTestServers returns test servers for the WYS and WYU files
+func stagingTestServers(t *testing.T, wysFile string, wyuFile string) (tsWYS *httptest.Server, tsWYU *httptest.Server) {
+	// wys server
+	tsWYS = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		dat, err := ioutil.ReadFile(wysFile)
+		assert.Nil(t, err)
+		w.Write(dat)
+	}))
+
+	// wyu server
+	tsWYU = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		dat, err := ioutil.ReadFile(wyuFile)
+		assert.Nil(t, err)
+		w.Write(dat)
+	}))
+
+	return tsWYS, tsWYU
+}
+
+func TestStage_StageHandler(t *testing.T) {
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
+
+	tsWYS, tsWYU := stagingTestServers(t, "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	defer tsWYS.Close()
+	defer tsWYU.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.WYSTestServer = tsWYS.URL
+	args.WYUTestServer = tsWYU.URL
+	args.Stagedir = filepath.Join(t.TempDir(), STAGING_DIR_NAME)
+
+	exitCode, err := StageHandler(Info{}, args)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, exitCode)
+
+	manifest, err := ReadStagingManifest(OSFS{}, args.Stagedir)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.0", manifest.InstalledVersion)
+	assert.Equal(t, "1.0.1", manifest.VersionToUpdate)
+	assert.Contains(t, manifest.Files, filepath.Join("base", "WidgetX.txt"))
+	assert.Contains(t, manifest.Files, UPDTDETAILS_UDT)
+
+	for _, f := range manifest.Files {
+		assert.True(t, fileExists(filepath.Join(args.Stagedir, stagedFilesDir, f)))
+	}
+	assert.True(t, fileExists(filepath.Join(args.Stagedir, stagedWysFileName)))
+	assert.True(t, VerifyAdler32Checksum(manifest.WYUAdler32, filepath.Join(args.Stagedir, stagedWyuFileName)))
+}
+
+func TestStage_StageHandler_no_update(t *testing.T) {
+	tsWYS, tsWYU := stagingTestServers(t, "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	defer tsWYS.Close()
+	defer tsWYU.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.1.wyc"
+	args.WYSTestServer = tsWYS.URL
+	args.WYUTestServer = tsWYU.URL
+	args.Stagedir = filepath.Join(t.TempDir(), STAGING_DIR_NAME)
+
+	exitCode, err := StageHandler(Info{}, args)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_NO_UPDATE, exitCode)
+
+	_, err = ReadStagingManifest(OSFS{}, args.Stagedir)
+	assert.NotNil(t, err)
+}
+
+func TestStage_StageHandler_signature_verification_error(t *testing.T) {
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
+
+	tsWYS, tsWYU := stagingTestServers(t, "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	defer tsWYS.Close()
+	defer tsWYU.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.WYSTestServer = tsWYS.URL
+	args.WYUTestServer = tsWYU.URL
+	args.Stagedir = filepath.Join(t.TempDir(), STAGING_DIR_NAME)
+
+	finfo := FakeUpdateInfo{}
+	finfo.ModifyWYS = true
+	finfo.ConfigWYS.FileSha1 = []byte("invalid")
+	finfo.ConfigWYS.UpdateFileAdler32 = WYU_FILE_ADLER32
+
+	exitCode, err := StageHandler(finfo, args)
+	assert.Equal(t, EXIT_ERROR, exitCode)
+	assert.NotNil(t, err)
+
+	// nothing should be left behind
+	_, err = os.Stat(args.Stagedir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStage_ApplyStagedHandler_nothing_staged(t *testing.T) {
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.Stagedir = filepath.Join(t.TempDir(), STAGING_DIR_NAME)
+
+	exitCode, err := ApplyStagedHandler(Info{}, args)
+	assert.Equal(t, EXIT_ERROR, exitCode)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no staged update found")
+}
+
+func TestStage_ApplyStagedHandler_version_mismatch(t *testing.T) {
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
+
+	tsWYS, tsWYU := stagingTestServers(t, "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	defer tsWYS.Close()
+	defer tsWYU.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.WYSTestServer = tsWYS.URL
+	args.WYUTestServer = tsWYU.URL
+	args.Stagedir = filepath.Join(t.TempDir(), STAGING_DIR_NAME)
+
+	exitCode, err := StageHandler(Info{}, args)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, exitCode)
+
+	// a different version is installed by the time we apply the update
+	args.Cdata = "./testdata/client.1.0.1.wyc"
+	exitCode, err = ApplyStagedHandler(Info{}, args)
+	assert.Equal(t, EXIT_ERROR, exitCode)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "staged update was for version 1.0.0")
+
+	// the stale update is thrown away
+	_, err = ReadStagingManifest(OSFS{}, args.Stagedir)
+	assert.NotNil(t, err)
+}
+
+func TestStage_ApplyStagedHandler_tampered_wyu(t *testing.T) {
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
+
+	tsWYS, tsWYU := stagingTestServers(t, "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	defer tsWYS.Close()
+	defer tsWYU.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.WYSTestServer = tsWYS.URL
+	args.WYUTestServer = tsWYU.URL
+	args.Stagedir = filepath.Join(t.TempDir(), STAGING_DIR_NAME)
+
+	exitCode, err := StageHandler(Info{}, args)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, exitCode)
+
+	err = ioutil.WriteFile(filepath.Join(args.Stagedir, stagedWyuFileName), []byte("not a wyu"), 0644)
+	assert.Nil(t, err)
+
+	exitCode, err = ApplyStagedHandler(Info{}, args)
+	assert.Equal(t, EXIT_ERROR, exitCode)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed the Adler32 validation")
+}
+
+func TestStage_ApplyStagedHandler_failed_before(t *testing.T) {
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
+
+	tsWYS, tsWYU := stagingTestServers(t, "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	defer tsWYS.Close()
+	defer tsWYU.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.WYSTestServer = tsWYS.URL
+	args.WYUTestServer = tsWYU.URL
+	args.InstallDir = t.TempDir()
+	args.Stagedir = filepath.Join(t.TempDir(), STAGING_DIR_NAME)
+	args.Retrybudget = DEFAULT_RETRY_BUDGET
+	args.Retrybackoff = DEFAULT_RETRY_BACKOFF
+
+	exitCode, err := StageHandler(Info{}, args)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, exitCode)
+
+	// the staged update failed to install a minute ago
+	dat, err := ioutil.ReadFile(filepath.Join(args.Stagedir, stagedWysFileName))
+	assert.Nil(t, err)
+	wysFilePath := filepath.Join(t.TempDir(), "wys")
+	assert.Nil(t, ioutil.WriteFile(wysFilePath, dat, 0644))
+	_, err = recordFailedInstall(OSFS{}, args.InstallDir, wysFilePath, "1.0.1", errors.New("file locked"), time.Now().Add(-time.Minute))
+	assert.Nil(t, err)
+
+	exitCode, err = ApplyStagedHandler(Info{}, args)
+	assert.Equal(t, EXIT_ERROR, exitCode)
+	assert.Equal(t, ERROR_CLASS_FAILED_BEFORE, ErrorClass(err))
+	assert.Contains(t, err.Error(), "not retrying until")
+
+	// the staged update is kept for when the backoff has passed
+	manifest, err := ReadStagingManifest(OSFS{}, args.Stagedir)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.1", manifest.VersionToUpdate)
+}
+
+func TestStage_checkStageDir(t *testing.T) {
+	instDir := t.TempDir()
+	assert.Nil(t, checkStageDir(filepath.Join(instDir, STAGING_DIR_NAME), instDir))
+	assert.Nil(t, checkStageDir(STAGING_DIR_NAME, "."))
+	assert.Nil(t, checkStageDir(filepath.Join(filepath.Dir(instDir), STAGING_DIR_NAME), instDir))
+
+	// staging would clear the install dir
+	for _, stageDir := range []string{instDir, filepath.Dir(instDir), filepath.VolumeName(instDir) + string(filepath.Separator)} {
+		err := checkStageDir(stageDir, instDir)
+		assert.NotNil(t, err, stageDir)
+	}
+
+	if runtime.GOOS == "windows" {
+		volume := filepath.VolumeName(instDir)
+		other := "Z:"
+		if strings.EqualFold(volume, other) {
+			other = "Y:"
+		}
+		err := checkStageDir(other+`\`+STAGING_DIR_NAME, instDir)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "isn't on the volume of the install dir")
+	}
+}
+
+func TestStage_StageHandler_foreign_stagedir(t *testing.T) {
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
+
+	tsWYS, tsWYU := stagingTestServers(t, "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	defer tsWYS.Close()
+	defer tsWYU.Close()
+
+	var args Args
+	args.Cdata = "./testdata/client.1.0.0.wyc"
+	args.WYSTestServer = tsWYS.URL
+	args.WYUTestServer = tsWYU.URL
+	args.InstallDir = t.TempDir()
+	args.Stagedir = t.TempDir()
+
+	// a directory that isn't a staging dir isn't cleared
+	other := filepath.Join(args.Stagedir, "notes.txt")
+	assert.Nil(t, ioutil.WriteFile(other, []byte("notes"), 0644))
+	exitCode, err := StageHandler(Info{}, args)
+	assert.Equal(t, EXIT_ERROR, exitCode)
+	assert.Equal(t, ERROR_CLASS_CONFIG, ErrorClass(err))
+	assert.Contains(t, err.Error(), "has no staged update")
+	assert.True(t, fileExists(other))
+
+	// an empty one is used, and a staging dir is cleared
+	assert.Nil(t, os.Remove(other))
+	for i := 0; i < 2; i++ {
+		exitCode, err = StageHandler(Info{}, args)
+		assert.Nil(t, err)
+		assert.Equal(t, EXIT_SUCCESS, exitCode)
+	}
+	_, err = ReadStagingManifest(OSFS{}, args.Stagedir)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,42 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStage_ApplyStagedHandler(t *testing.T) {
+	os.Remove(lastWyuDownloadPath(GetExeDir()))
+
+	tsWYS, tsWYU := stagingTestServers(t, "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	defer tsWYS.Close()
+	defer tsWYU.Close()
+
+	// the WYC file is updated with the new version, don't change testdata
+	var args Args
+	args.Cdata = filepath.Join(t.TempDir(), CLIENT_WYC)
+	_, err := CopyFile(OSFS{}, "./testdata/client.1.0.0.wyc", args.Cdata)
+	assert.Nil(t, err)
+	args.WYSTestServer = tsWYS.URL
+	args.WYUTestServer = tsWYU.URL
+	args.Stagedir = filepath.Join(t.TempDir(), STAGING_DIR_NAME)
+
+	exitCode, err := StageHandler(Info{}, args)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, exitCode)
+
+	// no network access is needed to apply the update
+	tsWYS.Close()
+	tsWYU.Close()
+
+	exitCode, err = ApplyStagedHandler(Info{}, args)
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, exitCode)
+
+	// the staged update is used up
+	_, err = os.Stat(args.Stagedir)
+	assert.True(t, os.IsNotExist(err))
+}
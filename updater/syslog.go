@@ -0,0 +1,167 @@
+package updater
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslog facility (daemon), the timeout for connecting and writing and the
+// maximum length of the APP-NAME header field
+const (
+	syslogFacility   = 3
+	syslogTimeout    = 10 * time.Second
+	syslogAppNameMax = 48
+)
+
+// syslogSeverity maps log levels to RFC 5424 severities
+var syslogSeverity = map[LogLevel]int{
+	LOG_DEBUG: 7,
+	LOG_INFO:  6,
+	LOG_WARN:  4,
+	LOG_ERROR: 3,
+}
+
+// SyslogSink sends events to a syslog collector in the RFC 5424 format.
+// Over TCP messages are framed with octet counting (RFC 6587), a broken
+// connection is re-established on the next event.
+type SyslogSink struct {
+	mu       sync.Mutex
+	network  string
+	address  string
+	hostname string
+	appName  string
+	conn     net.Conn
+}
+
+// NewSyslogSink returns a SyslogSink for `rawURL`, e.g., udp://127.0.0.1:514
+// or tcp://localhost:601. If the collector can't be reached it is connected
+// to when an event is emitted.
+func NewSyslogSink(rawURL string) (*SyslogSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog URL %s; %w", rawURL, err)
+	}
+
+	if u.Scheme != "udp" && u.Scheme != "tcp" {
+		return nil, fmt.Errorf("unsupported syslog protocol: %s", u.Scheme)
+	}
+	if len(u.Port()) == 0 {
+		return nil, fmt.Errorf("syslog URL %s has no port", rawURL)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || len(hostname) == 0 {
+		hostname = "-"
+	}
+
+	s := &SyslogSink{
+		network:  u.Scheme,
+		address:  u.Host,
+		hostname: hostname,
+		appName:  syslogAppName(strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))),
+	}
+	return s, nil
+}
+
+// Emit sends the event to the collector
+func (s *SyslogSink) Emit(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg := s.format(event)
+	if s.network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	// first event, or the connection couldn't be re-established
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	err := s.write(msg)
+	if err != nil && s.network == "tcp" {
+		// the collector may have dropped the connection, try once more
+		s.conn.Close()
+		s.conn = nil
+		if e := s.connect(); e != nil {
+			return fmt.Errorf("%w; %v", err, e)
+		}
+		err = s.write(msg)
+	}
+	return err
+}
+
+// Close closes the connection to the collector
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *SyslogSink) connect() error {
+	conn, err := net.DialTimeout(s.network, s.address, syslogTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog collector %s://%s; %w", s.network, s.address, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *SyslogSink) write(msg string) error {
+	if s.conn == nil {
+		return fmt.Errorf("not connected to syslog collector %s://%s", s.network, s.address)
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	_, err := s.conn.Write([]byte(msg))
+	return err
+}
+
+// format returns the event as an RFC 5424 message:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (s *SyslogSink) format(event Event) string {
+	severity, ok := syslogSeverity[event.Level]
+	if !ok {
+		severity = syslogSeverity[LOG_INFO]
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		syslogFacility*8+severity,
+		event.Time.UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		s.appName,
+		os.Getpid(),
+		event.Type,
+		event.Message)
+}
+
+// syslogAppName returns `name` as an RFC 5424 APP-NAME: printable US-ASCII
+// without spaces and at most 48 characters, "-" if nothing is left
+func syslogAppName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	if len(b) > syslogAppNameMax {
+		b = b[:syslogAppNameMax]
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
@@ -0,0 +1,157 @@
+package updater
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyslog_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	sink, err := NewSyslogSink("udp://" + conn.LocalAddr().String())
+	assert.Nil(t, err)
+	defer sink.Close()
+
+	assert.Nil(t, sink.Emit(NewEvent(EVENT_SIGNATURE_FAILED, "version %s is not signed", "1.0.1")))
+
+	buf := make([]byte, 2048)
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err)
+
+	// facility daemon (3), severity error (3)
+	msg := string(buf[:n])
+	assert.True(t, strings.HasPrefix(msg, "<27>1 "), msg)
+	assert.Contains(t, msg, " signature_failed - version 1.0.1 is not signed")
+}
+
+func TestSyslog_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// octet counting: "LEN SP MSG"
+		r := bufio.NewReader(conn)
+		length, _ := r.ReadString(' ')
+		n, _ := strconv.Atoi(strings.TrimSpace(length))
+		msg := make([]byte, n)
+		_, err = io.ReadFull(r, msg)
+		if err == nil {
+			received <- string(msg)
+		}
+	}()
+
+	sink, err := NewSyslogSink("tcp://" + ln.Addr().String())
+	assert.Nil(t, err)
+	defer sink.Close()
+
+	assert.Nil(t, sink.Emit(NewEvent(EVENT_UPDATE_STARTED, "updating")))
+
+	msg := <-received
+	// facility daemon (3), severity informational (6)
+	assert.True(t, strings.HasPrefix(msg, "<30>1 "), msg)
+	assert.True(t, strings.HasSuffix(msg, " update_started - updating"), msg)
+}
+
+func TestSyslog_InvalidURL(t *testing.T) {
+	_, err := NewSyslogSink("http://localhost:514")
+	assert.NotNil(t, err)
+
+	_, err = NewSyslogSink("udp://localhost")
+	assert.NotNil(t, err)
+}
+
+func TestSyslog_TCP_collectorGone(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	sink, err := NewSyslogSink("tcp://" + ln.Addr().String())
+	assert.Nil(t, err)
+	defer sink.Close()
+	assert.Nil(t, sink.Emit(NewEvent(EVENT_UPDATE_STARTED, "updating")))
+
+	// the collector goes away, reconnecting fails
+	ln.Close()
+	(<-accepted).Close()
+	for i := 0; i < 3; i++ {
+		err = sink.Emit(NewEvent(EVENT_UPDATE_STARTED, "updating"))
+	}
+	assert.NotNil(t, err)
+}
+
+func TestSyslog_TCP_collectorDown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	// the sink is created, events fail until the collector is back
+	sink, err := NewSyslogSink("tcp://" + addr)
+	assert.Nil(t, err)
+	defer sink.Close()
+	assert.NotNil(t, sink.Emit(NewEvent(EVENT_UPDATE_STARTED, "updating")))
+	assert.NotNil(t, sink.Emit(NewEvent(EVENT_UPDATE_STARTED, "updating")))
+
+	events, err := NewEventSinkFromArgs(Args{Syslog: "tcp://" + addr})
+	assert.Nil(t, err)
+	assert.NotNil(t, events)
+	events.Close()
+}
+
+func TestSyslog_TCP_connectsOnFirstEvent(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+
+	sink, err := NewSyslogSink("tcp://" + ln.Addr().String())
+	assert.Nil(t, err)
+	defer sink.Close()
+
+	// nothing is dialed before an event is emitted
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = ln.Accept()
+	assert.NotNil(t, err)
+
+	ln.(*net.TCPListener).SetDeadline(time.Time{})
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	assert.Nil(t, sink.Emit(NewEvent(EVENT_UPDATE_STARTED, "updating")))
+	(<-accepted).Close()
+}
+
+func TestSyslog_appName(t *testing.T) {
+	assert.Equal(t, "wyupdate", syslogAppName("wyupdate"))
+	assert.Equal(t, "my_updater_", syslogAppName("my updater\n"))
+	assert.Equal(t, "caf__", syslogAppName("café"))
+	assert.Equal(t, "-", syslogAppName(""))
+	assert.Equal(t, strings.Repeat("a", 48), syslogAppName(strings.Repeat("a", 60)))
+}
@@ -57,6 +57,14 @@ func intToValue(i uint32) []byte {
 	return a
 }
 
+// longToValue returns the byte slice representation of an int64 (long)
+// that can be used in a TLV Value field
+func longToValue(l int64) []byte {
+	a := make([]byte, 8)
+	binary.LittleEndian.PutUint64(a, uint64(l))
+	return a
+}
+
 // boolToValue returns the byte slice representationo of a
 // boolean. That byte slice can be stored in the Value field of a TLV
 // record
@@ -44,6 +44,14 @@ type ConfigUDT struct {
 	ServiceToStartAfterUpdate []TLV
 	NumberOfFileInfos         TLV
 	NumberOfRegistryChanges   TLV
+	Files                     []UDTFile
+}
+
+// UDTFile is the file information of a file in the update
+type UDTFile struct {
+	RelativePath           string // in the archive, e.g., base\service.exe
+	DeltaPatchRelativePath string
+	NewFileAdler32         int64
 }
 
 // ReadUDTTLV reads a single TLV and returns it
@@ -83,14 +91,25 @@ func ReadUDTTLV(r io.Reader) (*TLV, error) {
 
 // ParseUDT parses a updtdetails.udt file
 func ParseUDT(path string) (ConfigUDT, error) {
-	var udt ConfigUDT
+	return parseUDTFile(OSFS{}, path)
+}
 
-	f, err := os.Open(path)
+// parseUDTFile parses the update details file `path` in `fsys`
+func parseUDTFile(fsys FS, path string) (ConfigUDT, error) {
+	f, err := fsOrOS(fsys).Open(path)
 	if nil != err {
-		return udt, err
+		return ConfigUDT{}, err
 	}
 	defer f.Close()
 
+	return readUDT(f)
+}
+
+// readUDT reads the update details from `f`
+func readUDT(f io.Reader) (ConfigUDT, error) {
+	var udt ConfigUDT
+	var file *UDTFile
+
 	// read HEADER
 	header := make([]byte, 7)
 	f.Read(header)
@@ -119,27 +138,52 @@ func ParseUDT(path string) (ConfigUDT, error) {
 		case INT_UDT_NUMBER_OF_FILE_INFOS:
 			udt.NumberOfFileInfos = *tlv
 		case UDT_BEGINNING_OF_FILE_INFORMATION_IDENTIFIER:
-			continue
-		case UDT_RELATIVE_FILE_PATH_DSTRING:
-			continue
-		case UDT_DELTA_PATCH_RELATIVE_PATH_DSTRING:
-			continue
-		case UDT_NEW_FILES_ADLER32_CHECKSUM_LONG:
-			continue
+			file = &UDTFile{}
+		case UDT_RELATIVE_FILE_PATH_DSTRING, UDT_DELTA_PATCH_RELATIVE_PATH_DSTRING, UDT_NEW_FILES_ADLER32_CHECKSUM_LONG:
+			if file == nil {
+				return udt, fmt.Errorf("udt tag %x outside of a file information block", tlv.Tag)
+			}
+			switch tlv.Tag {
+			case UDT_RELATIVE_FILE_PATH_DSTRING:
+				file.RelativePath = udtDstringValue(tlv)
+			case UDT_DELTA_PATCH_RELATIVE_PATH_DSTRING:
+				file.DeltaPatchRelativePath = udtDstringValue(tlv)
+			default:
+				if len(tlv.Value) != 8 {
+					return udt, fmt.Errorf("invalid adler32 checksum in udt file information")
+				}
+				file.NewFileAdler32 = ValueToLong(tlv)
+			}
 		case UDT_END_OF_FILE_INFO_IDENTIFIER:
-			continue
+			if file != nil {
+				udt.Files = append(udt.Files, *file)
+			}
+			file = nil
 		default:
 			err := fmt.Errorf("udt tag %x not implemented", tlv.Tag)
 			return udt, err
 		}
 	}
 
-	return udt, err
+	return udt, nil
+}
+
+// udtDstringValue returns the string in a d. string TLV read by
+// ReadUDTTLV, which reads the data length as the length so the value starts
+// with the string length
+func udtDstringValue(tlv *TLV) string {
+	if len(tlv.Value) < 4 {
+		return ""
+	}
+	n := binary.LittleEndian.Uint32(tlv.Value)
+	if int64(n) > int64(len(tlv.Value)-4) {
+		n = uint32(len(tlv.Value) - 4)
+	}
+	return string(tlv.Value[4 : 4+n])
 }
 
 // WriteUDT writes a UDT file
 // Not all wyUpdate UDT options are implemented
-// This is currently only used in testing
 func WriteUDT(udt ConfigUDT, path string) error {
 	f, err := os.Create(path)
 	if nil != err {
@@ -147,11 +191,16 @@ func WriteUDT(udt ConfigUDT, path string) error {
 	}
 	defer f.Close()
 
+	return writeUDT(f, udt)
+}
+
+// writeUDT writes the update details to `f`
+func writeUDT(f io.Writer, udt ConfigUDT) error {
 	// write HEADER
 	f.Write([]byte(UPDTDETAILS_HEADER))
 
 	// INT_UDT_NUMBER_OF_REGISTRY_CHANGES
-	err = writeTlv(f, udt.NumberOfRegistryChanges)
+	err := writeTlv(f, udt.NumberOfRegistryChanges)
 	if nil != err {
 		return err
 	}
@@ -162,6 +211,14 @@ func WriteUDT(udt ConfigUDT, path string) error {
 		return err
 	}
 
+	// the file information follows the number of file infos
+	for _, file := range udt.Files {
+		err := writeUDTFile(f, file)
+		if nil != err {
+			return err
+		}
+	}
+
 	// STRING_UDT_SERVICE_TO_STOP_BEFORE_UPDATE
 	for _, s := range udt.ServiceToStopBeforeUpdate {
 		err := writeTlv(f, s)
@@ -185,3 +242,28 @@ func WriteUDT(udt ConfigUDT, path string) error {
 
 	return nil
 }
+
+// writeUDTFile writes the file information block of `file`
+func writeUDTFile(f io.Writer, file UDTFile) error {
+	err := binary.Write(f, binary.BigEndian, byte(UDT_BEGINNING_OF_FILE_INFORMATION_IDENTIFIER))
+	if nil != err {
+		return err
+	}
+
+	err = tlvWriteDstring(f, UDT_RELATIVE_FILE_PATH_DSTRING, file.RelativePath)
+	if nil != err {
+		return err
+	}
+
+	err = tlvWriteDstring(f, UDT_DELTA_PATCH_RELATIVE_PATH_DSTRING, file.DeltaPatchRelativePath)
+	if nil != err {
+		return err
+	}
+
+	err = writeTlv(f, TLV{Tag: UDT_NEW_FILES_ADLER32_CHECKSUM_LONG, Length: 8, Value: longToValue(file.NewFileAdler32)})
+	if nil != err {
+		return err
+	}
+
+	return binary.Write(f, binary.BigEndian, byte(UDT_END_OF_FILE_INFO_IDENTIFIER))
+}
@@ -49,3 +49,22 @@ func TestUDT_ParseUDT_error(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "not implemented")
 }
+
+func TestUDT_Files(t *testing.T) {
+	udt := ConfigUDT{
+		NumberOfRegistryChanges: TLV{Tag: INT_UDT_NUMBER_OF_REGISTRY_CHANGES, Length: 4, Value: intToValue(0)},
+		NumberOfFileInfos:       TLV{Tag: INT_UDT_NUMBER_OF_FILE_INFOS, Length: 4, Value: intToValue(2)},
+		Files: []UDTFile{
+			{RelativePath: `base\widget.exe`, NewFileAdler32: 0xdeadbeef},
+			{RelativePath: `base\widget.ini`, DeltaPatchRelativePath: `patches\widget.ini`, NewFileAdler32: 1},
+		},
+		ServiceToStopBeforeUpdate: []TLV{udtServiceTLV(STRING_UDT_SERVICE_TO_STOP_BEFORE_UPDATE, "widget")},
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, writeUDT(&buf, udt))
+	parsed, err := readUDT(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, udt.Files, parsed.Files)
+	assert.Equal(t, "widget", string(parsed.ServiceToStopBeforeUpdate[0].Value))
+}
@@ -2,15 +2,15 @@ package updater
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 )
@@ -65,17 +65,21 @@ func CompareVersions(a string, b string) int {
 
 // GetUpdateDetails finds the updtdetails.udt in a list of files extracted
 // from a wyu archive. It returns a `ConfigUDT` and a list of the files to
-// update.
-func GetUpdateDetails(extractedFiles []string) (udt ConfigUDT, updates []string, err error) {
+// update (the hook files are left out, see LoadHooks).
+func GetUpdateDetails(fsys FS, extractedFiles []string) (udt ConfigUDT, updates []string, err error) {
 	udtFound := false
+	root, _ := wyuRoot(extractedFiles)
 
 	for _, f := range extractedFiles {
 		if filepath.Base(f) == UPDTDETAILS_UDT {
-			udt, err = ParseUDT(f)
+			udt, err = parseUDTFile(fsys, f)
 			if err != nil {
 				return ConfigUDT{}, updates, err
 			}
 			udtFound = true
+		} else if isHookFile(root, f) {
+			// the hooks aren't installed
+			continue
 		} else {
 			updates = append(updates, f)
 		}
@@ -89,19 +93,19 @@ func GetUpdateDetails(extractedFiles []string) (udt ConfigUDT, updates []string,
 	return udt, updates, nil
 }
 
-// BackupFiles copies all the files to be updated in `srcDir` to a `backupDir`
-// `backupDir` is returned
-func BackupFiles(updates []string, srcDir string) (backupDir string, err error) {
-	backupDir, err = CreateTempDir()
+// BackupFiles moves all the files to be updated in `srcDir` to a `backupDir`
+// created in `srcDir`. `backupDir` is returned
+func BackupFiles(fsys FS, updates []string, srcDir string) (backupDir string, err error) {
+	backupDir, err = createTempDir(fsys, srcDir)
 	if err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("failed to create the backup directory; %w", err)
 	}
 
 	// backup the files we are about to update
 	for _, f := range updates {
 		orig := path.Join(srcDir, filepath.Base(f))
 		back := path.Join(backupDir, filepath.Base(f))
-		err = MoveFileIgnoreMissing(orig, back)
+		err = MoveFileIgnoreMissing(fsys, orig, back)
 		if nil != err {
 			return backupDir, err
 		}
@@ -110,13 +114,13 @@ func BackupFiles(updates []string, srcDir string) (backupDir string, err error)
 	return backupDir, nil
 }
 
-func DeleteDirectory(dir string) error {
-	return os.RemoveAll(dir)
+func DeleteDirectory(fsys FS, dir string) error {
+	return fsOrOS(fsys).RemoveAll(dir)
 }
 
 // RollbackFiles copies all the files from `backupDir` to `dstDir`
-func RollbackFiles(backupDir string, dstDir string) (err error) {
-	files, err := ioutil.ReadDir(backupDir)
+func RollbackFiles(fsys FS, backupDir string, dstDir string) (err error) {
+	files, err := fsOrOS(fsys).ReadDir(backupDir)
 	if err != nil {
 		return err
 	}
@@ -125,7 +129,7 @@ func RollbackFiles(backupDir string, dstDir string) (err error) {
 	for _, f := range files {
 		orig := path.Join(backupDir, path.Base(f.Name()))
 		dstFile := path.Join(dstDir, path.Base(f.Name()))
-		err = MoveFileIgnoreMissing(orig, dstFile)
+		err = MoveFileIgnoreMissing(fsys, orig, dstFile)
 		if nil != err {
 			errs = multierror.Append(errs, err)
 		}
@@ -134,11 +138,21 @@ func RollbackFiles(backupDir string, dstDir string) (err error) {
 	return errs.ErrorOrNil()
 }
 
-// InstallUpdate start/stops service and moves the new files into the `installDir`
-func InstallUpdate(udt ConfigUDT, srcFiles []string, installDir string) error {
+// InstallUpdate start/stops service and moves the new files into the `installDir`.
+// It stops at the next file or service once `ctx` is done, the caller rolls back
+// what was installed.
+func InstallUpdate(ctx context.Context, fsys FS, udt ConfigUDT, srcFiles []string, installDir string, services ServiceController, logger *Logger) error {
+	if services == nil {
+		services = SystemServices{}
+	}
+
 	// move the files into the "base directory"
 	for _, f := range srcFiles {
-		err := MoveFileIgnoreMissing(f, path.Join(installDir, filepath.Base(f)))
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("install cancelled; %w", err)
+		}
+		logger.Debugf("Installing %s", filepath.Base(f))
+		err := MoveFileIgnoreMissing(fsys, f, path.Join(installDir, filepath.Base(f)))
 		if err != nil {
 			return err
 		}
@@ -146,34 +160,40 @@ func InstallUpdate(udt ConfigUDT, srcFiles []string, installDir string) error {
 
 	// stop services
 	for _, s := range udt.ServiceToStopBeforeUpdate {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("install cancelled; %w", err)
+		}
 		service := ValueToString(&s)
-		service_exists, err := DoesServiceExist(service)
+		service_exists, err := services.DoesServiceExist(service)
 		if nil != err {
-			return fmt.Errorf("failed to lookup service %s; %v", service, err)
+			return withError(ErrServiceControl, fmt.Errorf("failed to lookup service %s; %v", service, err))
 		}
 
 		if service_exists {
-			e := StopService(service)
+			e := services.StopService(ctx, service, logger)
 			if nil != e {
-				return fmt.Errorf("failed to stop %s; %v", service, e)
+				return withError(ErrServiceControl, fmt.Errorf("failed to stop %s; %w", service, e))
 			}
 		}
 	}
 
 	// start services
 	for _, s := range udt.ServiceToStartAfterUpdate {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("install cancelled; %w", err)
+		}
 		service := ValueToString(&s)
-		service_exists, err := DoesServiceExist(service)
+		service_exists, err := services.DoesServiceExist(service)
 		if err != nil {
 			e := fmt.Errorf("failed to lookup service %s; %v", service, err)
-			return e
+			return withError(ErrServiceControl, e)
 		}
 
 		// don't try to start the service if it doesn't exist
 		if service_exists {
-			e := StartService(service)
+			e := services.StartService(ctx, service, logger)
 			if nil != e {
-				return fmt.Errorf("failed to start %s; %v", service, e)
+				return withError(ErrServiceControl, fmt.Errorf("failed to start %s; %w", service, e))
 			}
 		}
 	}
@@ -183,26 +203,27 @@ func InstallUpdate(udt ConfigUDT, srcFiles []string, installDir string) error {
 // TODO: Move all these generic "file" functions to file.go
 
 // MoveFile moves a `file` to `dst`
-func MoveFile(file string, dst string) error {
+func MoveFile(fsys FS, file string, dst string) error {
 	// Rename() returns *LinkError if it errs
-	return os.Rename(file, dst)
+	return fsOrOS(fsys).Rename(file, dst)
 }
 
 // MoveFileIgnoreMissing will not return an error if `src` does not exist
-func MoveFileIgnoreMissing(src string, dst string) error {
-	if !fileExists(src) {
+func MoveFileIgnoreMissing(fsys FS, src string, dst string) error {
+	if !pathExists(fsys, src) {
 		return nil
 	}
-	return os.Rename(src, dst)
+	return fsOrOS(fsys).Rename(src, dst)
 }
 
 // CopyFile copies `src` to `dst`
-func CopyFile(src, dst string) (int64, error) {
-	if !fileExists(src) {
+func CopyFile(fsys FS, src, dst string) (int64, error) {
+	fsys = fsOrOS(fsys)
+	if !pathExists(fsys, src) {
 		return 0, nil
 	}
 
-	sourceFileStat, err := os.Stat(src)
+	sourceFileStat, err := fsys.Stat(src)
 	if err != nil {
 		return 0, err
 	}
@@ -211,13 +232,13 @@ func CopyFile(src, dst string) (int64, error) {
 		return 0, fmt.Errorf("%s is not a regular file", src)
 	}
 
-	source, err := os.Open(src)
+	source, err := fsys.Open(src)
 	if err != nil {
 		return 0, err
 	}
 	defer source.Close()
 
-	destination, err := os.Create(dst)
+	destination, err := createFile(fsys, dst)
 	if err != nil {
 		return 0, err
 	}
@@ -230,15 +251,15 @@ func CopyFile(src, dst string) (int64, error) {
 // candidateWysFileMatchesFailedInstallWysFile considers whether the WYS file read from the candidateWysFileReader, which
 // corresponds to an update that is a candidate for further processing, matches the locally saved copy of the last WYS file
 // we tried to process and install.  It will return false if we should further process the candidate WYS file, and true otherwise.
-func candidateWysFileMatchesFailedInstallWysFile(candidateWysFileReader io.Reader) bool {
+func candidateWysFileMatchesFailedInstallWysFile(fsys FS, instDir string, candidateWysFileReader io.Reader) bool {
 	// we expect this failed sentinel file to exist iff a prior update/installation failed
 	// it should be a copy of the WYS file that triggered this aforementioned update
-	installFailedSentinelFilePath := filepath.Join(GetExeDir(), INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)
-	if !fileExists(installFailedSentinelFilePath) {
+	installFailedSentinelFilePath := filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)
+	if !pathExists(fsys, installFailedSentinelFilePath) {
 		return false
 	}
 
-	sentinelWysFileHash, err := GenerateSHA1HashFromFilePath(installFailedSentinelFilePath)
+	sentinelWysFileHash, err := generateSHA1HashFromFile(fsys, installFailedSentinelFilePath)
 	if err != nil {
 		return false
 	}
@@ -256,38 +277,41 @@ type CandidateUpdateRequest struct {
 	ConfigIUC               ConfigIUC
 	CandidateWysFileContent bytes.Buffer
 	ConfigWYS               ConfigWYS
+	WysDownloadDuration     time.Duration
 }
 
 // NewCandidateUpdateRequest returns a populated req if all the prerequisites to generate one are present.
-// req will always be zero value when err is not nil.
-func NewCandidateUpdateRequest(args Args, wyFileParser Infoer) (req CandidateUpdateRequest, err error) {
+// req will always be zero value when err is not nil. The download of the WYS file is
+// aborted when `ctx` is done.
+func NewCandidateUpdateRequest(ctx context.Context, args Args, wyFileParser Infoer) (req CandidateUpdateRequest, err error) {
 	// parse the WYC file to get the update site, installed version, etc.
 	wycFilePath := args.Cdata
 	iuc, err := wyFileParser.ParseWYC(wycFilePath)
 	if nil != err {
 		err = fmt.Errorf("error reading WYC file: %s; %w", wycFilePath, err)
-		return req, err
+		return req, withError(ErrConfig, err)
 	}
 
 	urls := iuc.GetWYSURLs(args)
 
 	var candidateWysFileContents bytes.Buffer
-	if err := DownloadFileToWriter(urls, &candidateWysFileContents); err != nil {
-		return req, err
+	start := args.clock().Now()
+	if err := DownloadFileToWriter(ctx, args.HTTPClient, urls, &candidateWysFileContents, args.Logger); err != nil {
+		return req, withError(ErrNetwork, err)
 	}
+	downloadDuration := args.clock().Now().Sub(start)
 
 	candidateWysFileReader := bytes.NewReader(candidateWysFileContents.Bytes())
 	wys, err := wyFileParser.ParseWYSFromReader(candidateWysFileReader, int64(candidateWysFileContents.Len()))
 	if nil != err {
 		err = fmt.Errorf("error parsing downloaded candidate WYS file; %w", err)
-		return req, err
+		return req, withError(ErrVerification, err)
 	}
 
 	// At this point, we have the wys file from the server in memory.
 	// It is a new file and from a trusted source, so we'll determine if this candidate
 	// is valid and requires further processing of the update. If so, we'll return a populated context.
-	if candidateWysFileMatchesFailedInstallWysFile(candidateWysFileReader) {
-		err = fmt.Errorf("error updating to version '%v' failed before, aborting updating", wys.VersionToUpdate)
+	if err := checkFailedInstall(args, candidateWysFileContents.Bytes(), wys.VersionToUpdate); err != nil {
 		return req, err
 	}
 
@@ -295,5 +319,6 @@ func NewCandidateUpdateRequest(args Args, wyFileParser Infoer) (req CandidateUpd
 		ConfigIUC:               iuc,
 		ConfigWYS:               wys,
 		CandidateWysFileContent: candidateWysFileContents,
+		WysDownloadDuration:     downloadDuration,
 	}, nil
 }
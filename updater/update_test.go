@@ -2,11 +2,15 @@ package updater
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -36,11 +40,120 @@ func TestUpdate_CompareVersions(t *testing.T) {
 	}
 }
 
+func TestUpdate_InstallUpdate_cancelled(t *testing.T) {
+	srcDir := t.TempDir()
+	instDir := t.TempDir()
+	src := filepath.Join(srcDir, "widget.txt")
+	assert.Nil(t, os.WriteFile(src, []byte("1.0.1"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := InstallUpdate(ctx, OSFS{}, ConfigUDT{}, []string{src}, instDir, nil, nil)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	// nothing was installed
+	assert.True(t, fileExists(src))
+	assert.False(t, fileExists(filepath.Join(instDir, "widget.txt")))
+}
+
+// memInstall returns a MemFS with version 1.0.0 of widget.txt and
+// widget.exe installed in memDir and version 1.0.1 extracted to a temp dir
+func memInstall(t *testing.T) (m *MemFS, updates []string) {
+	m = NewMemFS()
+	assert.Nil(t, m.MkdirAll(memDir, 0755))
+	srcDir, err := createTempDir(m, memDir)
+	assert.Nil(t, err)
+	for _, name := range []string{"widget.txt", "widget.exe"} {
+		assert.Nil(t, m.WriteFile(filepath.Join(memDir, name), []byte("1.0.0"), 0644))
+		updates = append(updates, filepath.Join(srcDir, name))
+		assert.Nil(t, m.WriteFile(updates[len(updates)-1], []byte("1.0.1"), 0644))
+	}
+	return m, updates
+}
+
+// readMemFile returns the contents of `name` in `m`
+func readMemFile(t *testing.T, m *MemFS, name string) string {
+	dat, err := m.ReadFile(name)
+	assert.Nil(t, err)
+	return string(dat)
+}
+
+func TestUpdate_InstallUpdate_memFS(t *testing.T) {
+	m, updates := memInstall(t)
+
+	backupDir, err := BackupFiles(m, updates, memDir)
+	assert.Nil(t, err)
+	assert.False(t, pathExists(m, filepath.Join(memDir, "widget.txt")))
+
+	assert.Nil(t, InstallUpdate(context.Background(), m, ConfigUDT{}, updates, memDir, nil, nil))
+	assert.Equal(t, "1.0.1", readMemFile(t, m, filepath.Join(memDir, "widget.txt")))
+	assert.Equal(t, "1.0.1", readMemFile(t, m, filepath.Join(memDir, "widget.exe")))
+
+	assert.Nil(t, RollbackFiles(m, backupDir, memDir))
+	assert.Equal(t, "1.0.0", readMemFile(t, m, filepath.Join(memDir, "widget.txt")))
+	assert.Equal(t, "1.0.0", readMemFile(t, m, filepath.Join(memDir, "widget.exe")))
+}
+
+func TestUpdate_BackupFiles_failed(t *testing.T) {
+	// the backup dir can't be created
+	m, updates := memInstall(t)
+	m.FailOp(FS_OP_MKDIR, TempDirPrefix()+"*", syscall.ENOSPC)
+	_, err := BackupFiles(m, updates, memDir)
+	assert.True(t, errors.Is(err, syscall.ENOSPC))
+
+	// the running executable is locked
+	m, updates = memInstall(t)
+	m.FailOp(FS_OP_RENAME, filepath.Join(memDir, "widget.exe"), syscall.EACCES)
+	_, err = BackupFiles(m, updates, memDir)
+	assert.True(t, errors.Is(err, syscall.EACCES))
+	assert.Equal(t, "1.0.0", readMemFile(t, m, filepath.Join(memDir, "widget.exe")))
+}
+
+func TestUpdate_InstallUpdate_failed(t *testing.T) {
+	// the update was extracted to another volume
+	m, updates := memInstall(t)
+	backupDir, err := BackupFiles(m, updates, memDir)
+	assert.Nil(t, err)
+	m.FailOp(FS_OP_RENAME, filepath.Join(memDir, "widget.exe"), syscall.EXDEV)
+
+	err = InstallUpdate(context.Background(), m, ConfigUDT{}, updates, memDir, nil, nil)
+	assert.True(t, errors.Is(err, syscall.EXDEV))
+	var linkErr *os.LinkError
+	assert.True(t, errors.As(err, &linkErr))
+
+	// the files installed before the failure are rolled back
+	m.ClearFaults()
+	assert.Nil(t, RollbackFiles(m, backupDir, memDir))
+	assert.Equal(t, "1.0.0", readMemFile(t, m, filepath.Join(memDir, "widget.txt")))
+	assert.Equal(t, "1.0.0", readMemFile(t, m, filepath.Join(memDir, "widget.exe")))
+}
+
+func TestUpdate_RollbackFiles_failed(t *testing.T) {
+	m, updates := memInstall(t)
+	backupDir, err := BackupFiles(m, updates, memDir)
+	assert.Nil(t, err)
+	assert.Nil(t, InstallUpdate(context.Background(), m, ConfigUDT{}, updates, memDir, nil, nil))
+
+	// a file that can't be restored doesn't stop the others
+	m.FailOp(FS_OP_RENAME, filepath.Join(backupDir, "widget.exe"), syscall.EACCES)
+	err = RollbackFiles(m, backupDir, memDir)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), syscall.EACCES.Error())
+	assert.Equal(t, "1.0.0", readMemFile(t, m, filepath.Join(memDir, "widget.txt")))
+	assert.Equal(t, "1.0.1", readMemFile(t, m, filepath.Join(memDir, "widget.exe")))
+
+	// the backup can't be read
+	m.ClearFaults()
+	m.FailOp(FS_OP_READDIR, backupDir, fs.ErrPermission)
+	err = RollbackFiles(m, backupDir, memDir)
+	assert.True(t, errors.Is(err, fs.ErrPermission))
+}
+
 func Test_GenerateCandidateUpdateRequest_FailsToParseWycFile(t *testing.T) {
 	args := Args{Cdata: "not a real path"}
 	wyFileParser := FakeUpdateInfo{}
 
-	req, err := NewCandidateUpdateRequest(args, wyFileParser)
+	req, err := NewCandidateUpdateRequest(context.Background(), args, wyFileParser)
 	assert.Zero(t, req)
 	assert.NotNil(t, err)
 }
@@ -60,7 +173,7 @@ func Test_GenerateCandidateUpdateRequest_FailsToDownloadWysFile(t *testing.T) {
 	}
 	wyFileParser := FakeUpdateInfo{}
 
-	req, err := NewCandidateUpdateRequest(args, wyFileParser)
+	req, err := NewCandidateUpdateRequest(context.Background(), args, wyFileParser)
 	assert.Zero(t, req)
 	assert.NotNil(t, err)
 }
@@ -82,7 +195,7 @@ func Test_GenerateCandidateUpdateRequest_FailsToParseWysFile(t *testing.T) {
 	}
 	wyFileParser := FakeUpdateInfo{}
 
-	req, err := NewCandidateUpdateRequest(args, wyFileParser)
+	req, err := NewCandidateUpdateRequest(context.Background(), args, wyFileParser)
 	assert.Zero(t, req)
 	assert.NotNil(t, err)
 }
@@ -115,7 +228,7 @@ func Test_GenerateCandidateUpdateRequest_CandidateWysFileMatchesInstallFailedSen
 	}
 	wyFileParser := FakeUpdateInfo{}
 
-	req, err := NewCandidateUpdateRequest(args, wyFileParser)
+	req, err := NewCandidateUpdateRequest(context.Background(), args, wyFileParser)
 	assert.Zero(t, req)
 	assert.NotNil(t, err)
 }
@@ -152,7 +265,7 @@ func Test_GenerateCandidateUpdateRequest_CandidateWysFileDoesNotMatchInstallFail
 	}
 	wyFileParser := FakeUpdateInfo{}
 
-	req, err := NewCandidateUpdateRequest(args, wyFileParser)
+	req, err := NewCandidateUpdateRequest(context.Background(), args, wyFileParser)
 	assert.NotEmpty(t, req.CandidateWysFileContent)
 	assert.NotZero(t, req.ConfigIUC)
 	assert.NotZero(t, req.ConfigWYS)
@@ -181,7 +294,7 @@ func Test_GenerateCandidateUpdateRequest_InstallFailedSentinelDoesNotExist(t *te
 
 	assert.False(t, fileExists(filepath.Join(GetExeDir(), INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)))
 
-	req, err := NewCandidateUpdateRequest(args, wyFileParser)
+	req, err := NewCandidateUpdateRequest(context.Background(), args, wyFileParser)
 	assert.NotEmpty(t, req.CandidateWysFileContent)
 	assert.NotZero(t, req.ConfigIUC)
 	assert.NotZero(t, req.ConfigWYS)
@@ -1,6 +1,7 @@
 package updater
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -15,12 +16,12 @@ func TestUpdate(t *testing.T) {
 	defer os.RemoveAll(tempInstall)
 
 	src := "./testdata/widgetX.1.0.1.wyu"
-	_, files, err := Unzip(src, tempExtract)
+	_, files, err := Unzip(OSFS{}, src, tempExtract)
 	assert.Nil(t, err)
 
-	udt, updateFiles, err := GetUpdateDetails(files)
+	udt, updateFiles, err := GetUpdateDetails(OSFS{}, files)
 	assert.Nil(t, err)
 
-	err = InstallUpdate(udt, updateFiles, tempInstall)
+	err = InstallUpdate(context.Background(), OSFS{}, udt, updateFiles, tempInstall, nil, nil)
 	assert.Nil(t, err)
 }
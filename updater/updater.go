@@ -0,0 +1,219 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Clock tells the time, it can be replaced to test time dependent behavior
+// such as the retry backoff. Sleep returns early with the context's error
+// if `ctx` is done.
+type Clock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// systemClock is the real clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	return sleepContext(ctx, d)
+}
+
+// sleepContext waits for `d`, or until `ctx` is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Updater checks for and installs updates. It is the library interface to
+// the updater, Handler is a command-line wrapper around it. Only one
+// Updater (in any process) works on an install directory at a time.
+type Updater struct {
+	args   Args
+	infoer Infoer
+}
+
+// Option configures an Updater
+type Option func(*Updater)
+
+// WithArgs configures the updater with command-line arguments (see
+// ParseArgs). Options after it override the arguments.
+func WithArgs(args Args) Option {
+	return func(u *Updater) {
+		u.args = args
+	}
+}
+
+// WithInstallDir sets the directory updates are installed in. The WYC file,
+// staging directory, report queue and state file default to this directory.
+// Defaults to the directory of the executable.
+func WithInstallDir(dir string) Option {
+	return func(u *Updater) {
+		u.args.InstallDir = dir
+	}
+}
+
+// WithCdata sets the path of the WYC file
+func WithCdata(path string) Option {
+	return func(u *Updater) {
+		u.args.Cdata = path
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for downloads and reports
+func WithHTTPClient(client *http.Client) Option {
+	return func(u *Updater) {
+		u.args.HTTPClient = client
+	}
+}
+
+// WithLogger sets the logger
+func WithLogger(logger *Logger) Option {
+	return func(u *Updater) {
+		u.args.Logger = logger
+	}
+}
+
+// WithEvents sets the sink update events are sent to
+func WithEvents(events EventSink) Option {
+	return func(u *Updater) {
+		u.args.Events = events
+	}
+}
+
+// WithServiceController sets what stops and starts the services of an
+// update
+func WithServiceController(services ServiceController) Option {
+	return func(u *Updater) {
+		u.args.Services = services
+	}
+}
+
+// WithClock sets the clock
+func WithClock(clock Clock) Option {
+	return func(u *Updater) {
+		u.args.Clock = clock
+	}
+}
+
+// WithFS sets the filesystem updates are downloaded, staged, backed up and
+// installed on, the WYC file is read from it too. Hooks are run from the
+// operating system's filesystem, and the lock, logs, reports and metrics
+// stay there.
+func WithFS(fsys FS) Option {
+	return func(u *Updater) {
+		u.args.FS = fsys
+	}
+}
+
+// NewUpdater returns an Updater configured by `opts`. Anything not
+// configured has the same default as the command-line argument.
+func NewUpdater(opts ...Option) *Updater {
+	u := &Updater{
+		args: defaultArgs(),
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	u.args.setDefaultPaths()
+	u.infoer = Info{FS: u.args.FS}
+	return u
+}
+
+// Check checks for an update. The result's exit code is EXIT_UPDATE_AVALIABLE
+// if there is one.
+func (u *Updater) Check(ctx context.Context) (Result, error) {
+	return u.run(ctx, ACTION_CHECK, func(result *Result) (int, error) {
+		return checkForUpdate(ctx, u.infoer, u.args, result)
+	})
+}
+
+// Update downloads, verifies and installs the update, rolling back if the
+// install fails or `ctx` is done before it completes
+func (u *Updater) Update(ctx context.Context) (Result, error) {
+	return u.run(ctx, ACTION_UPDATE, func(result *Result) (int, error) {
+		return update(ctx, u.infoer, u.args, result)
+	})
+}
+
+// DryRun downloads and verifies the update and returns what installing it
+// would do in the result's Plan, without installing it
+func (u *Updater) DryRun(ctx context.Context) (Result, error) {
+	return u.run(ctx, ACTION_DRY_RUN, func(result *Result) (int, error) {
+		return dryRun(ctx, u.infoer, u.args, result)
+	})
+}
+
+// Stage downloads and verifies the update so it can be installed later by
+// ApplyStaged
+func (u *Updater) Stage(ctx context.Context) (Result, error) {
+	return u.run(ctx, ACTION_STAGE, func(result *Result) (int, error) {
+		return stage(ctx, u.infoer, u.args, result)
+	})
+}
+
+// ApplyStaged installs the update staged by Stage
+func (u *Updater) ApplyStaged(ctx context.Context) (Result, error) {
+	return u.run(ctx, ACTION_APPLY_STAGED, func(result *Result) (int, error) {
+		return applyStaged(ctx, u.infoer, u.args, result)
+	})
+}
+
+// Rollback restores the backup of `version`, or the newest backup if
+// `version` is empty. Once started the rollback isn't cancelled.
+func (u *Updater) Rollback(ctx context.Context, version string) (Result, error) {
+	args := u.args
+	args.RollbackVersion = version
+	return u.run(ctx, ACTION_ROLLBACK, func(result *Result) (int, error) {
+		return rollback(args, args.instDir(), result)
+	})
+}
+
+// ClearFailed removes the failed install sentinel so the update that failed
+// is tried again
+func (u *Updater) ClearFailed(ctx context.Context) (Result, error) {
+	return u.run(ctx, ACTION_CLEAR_FAILED, func(result *Result) (int, error) {
+		return clearFailed(u.args, u.args.instDir(), result)
+	})
+}
+
+// run runs one of the actions holding the update lock, finishes and
+// records the result
+func (u *Updater) run(ctx context.Context, action string, fn func(*Result) (int, error)) (Result, error) {
+	result := Result{Action: action, StartTime: u.args.clock().Now()}
+
+	if err := ctx.Err(); err != nil {
+		result.finish(u.args.clock(), exitCode(u.args, EXIT_ERROR, err), err)
+		return result, err
+	}
+
+	// only one updater may work on the install dir at a time
+	lock, err := AcquireUpdateLock(u.args.instDir())
+	if err != nil {
+		rc := EXIT_ERROR
+		if errors.Is(err, ErrUpdateInProgress) {
+			rc = EXIT_UPDATE_IN_PROGRESS
+		}
+		result.finish(u.args.clock(), exitCode(u.args, rc, err), err)
+		return result, err
+	}
+	defer lock.Release()
+
+	rc, err := fn(&result)
+	result.finish(u.args.clock(), exitCode(u.args, rc, err), err)
+	recordResult(ctx, u.args, result)
+	return result, err
+}
@@ -0,0 +1,407 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a Clock that only moves when it's told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+// fakeServices is a ServiceController with services that always exist and
+// records the services stopped and started. onStop is called before a
+// service is stopped.
+type fakeServices struct {
+	stopped []string
+	started []string
+	onStop  func()
+}
+
+func (s *fakeServices) DoesServiceExist(name string) (bool, error) {
+	return true, nil
+}
+
+func (s *fakeServices) IsServiceRunning(name string) (bool, error) {
+	return true, nil
+}
+
+func (s *fakeServices) StartService(ctx context.Context, name string, logger *Logger) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.started = append(s.started, name)
+	return nil
+}
+
+func (s *fakeServices) StopService(ctx context.Context, name string, logger *Logger) error {
+	if s.onStop != nil {
+		s.onStop()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.stopped = append(s.stopped, name)
+	return nil
+}
+
+// countingTransport counts the requests sent through it
+type countingTransport struct {
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// updaterTestInstall creates an install dir with version 1.0.0 of the
+// widget installed and a server with the WYS file for version 1.0.1
+func updaterTestInstall(t *testing.T) (instDir string, wysServer *httptest.Server) {
+	instDir = t.TempDir()
+	dat, err := os.ReadFile("./testdata/client.1.0.0.wyc")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(instDir, CLIENT_WYC), dat, 0644))
+
+	wysServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./testdata/widgetX.1.0.1.wys")
+	}))
+	t.Cleanup(wysServer.Close)
+	return instDir, wysServer
+}
+
+func TestUpdater_NewUpdater(t *testing.T) {
+	u := NewUpdater()
+	assert.Equal(t, filepath.Join(GetExeDir(), CLIENT_WYC), u.args.Cdata)
+	assert.Equal(t, DEFAULT_RETRY_BUDGET, u.args.Retrybudget)
+
+	instDir := t.TempDir()
+	u = NewUpdater(WithInstallDir(instDir))
+	assert.Equal(t, instDir, u.args.instDir())
+	assert.Equal(t, filepath.Join(instDir, CLIENT_WYC), u.args.Cdata)
+	assert.Equal(t, filepath.Join(instDir, STAGING_DIR_NAME), u.args.Stagedir)
+	assert.Equal(t, filepath.Join(instDir, REPORT_QUEUE_DIR_NAME), u.args.Reportqueue)
+	assert.Equal(t, filepath.Join(instDir, METRICS_STATE_FILE_NAME), u.args.Statefile)
+
+	// paths that are given aren't replaced
+	u = NewUpdater(WithInstallDir(instDir), WithCdata("other.wyc"))
+	assert.Equal(t, "other.wyc", u.args.Cdata)
+
+	// options override the arguments
+	u = NewUpdater(WithArgs(Args{Cdata: "args.wyc", Retrybudget: 5}), WithInstallDir(instDir))
+	assert.Equal(t, "args.wyc", u.args.Cdata)
+	assert.Equal(t, 5, u.args.Retrybudget)
+	assert.Equal(t, filepath.Join(instDir, STAGING_DIR_NAME), u.args.Stagedir)
+}
+
+func TestUpdater_Check(t *testing.T) {
+	instDir, wysServer := updaterTestInstall(t)
+
+	transport := &countingTransport{}
+	u := NewUpdater(
+		WithArgs(Args{WYSTestServer: wysServer.URL}),
+		WithInstallDir(instDir),
+		WithHTTPClient(&http.Client{Transport: transport}),
+	)
+
+	result, err := u.Check(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_UPDATE_AVALIABLE, result.ExitCode)
+	assert.Equal(t, ACTION_CHECK, result.Action)
+	assert.Equal(t, "1.0.0", result.InstalledVersion)
+	assert.Equal(t, "1.0.1", result.AvailableVersion)
+	assert.True(t, result.UpdateAvailable())
+	assert.Equal(t, 1, transport.requests)
+}
+
+func TestUpdater_Check_cancelled(t *testing.T) {
+	instDir, wysServer := updaterTestInstall(t)
+	u := NewUpdater(WithArgs(Args{WYSTestServer: wysServer.URL}), WithInstallDir(instDir))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := u.Check(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, EXIT_CANCELLED, result.ExitCode)
+	assert.Equal(t, ERROR_CLASS_CANCELLED, result.ErrorClass)
+}
+
+func TestUpdater_Update_cancelled(t *testing.T) {
+	instDir, wysServer := updaterTestInstall(t)
+	installed := filepath.Join(instDir, "WidgetX.txt")
+	assert.Nil(t, os.WriteFile(installed, []byte("1.0.0"), 0644))
+
+	wyuServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./testdata/widgetX.1.0.1.wyu")
+	}))
+	defer wyuServer.Close()
+
+	// the update is cancelled while the services are stopped, after the
+	// files were replaced
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	services := &fakeServices{onStop: cancel}
+	u := NewUpdater(
+		WithArgs(Args{WYSTestServer: wysServer.URL, WYUTestServer: wyuServer.URL}),
+		WithInstallDir(instDir),
+		WithServiceController(services),
+	)
+
+	result, err := u.Update(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, EXIT_CANCELLED, result.ExitCode)
+	assert.Equal(t, ROLLBACK_SUCCEEDED, result.Rollback)
+
+	// the old file is back, the services are started again and the update
+	// isn't marked as failed
+	assert.Equal(t, "1.0.0", readTestFile(t, installed))
+	assert.Equal(t, []string{"Spooler"}, services.started)
+	assert.Nil(t, result.FailedInstall)
+	assert.False(t, fileExists(filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)))
+}
+
+// updaterTestMemInstall creates an install dir in a MemFS with version
+// 1.0.0 of the widget installed and servers with the WYS and WYU files for
+// version 1.0.1. The install dir exists on disk too, for the lock.
+func updaterTestMemInstall(t *testing.T) (m *MemFS, instDir string, wysServer *httptest.Server, wyuServer *httptest.Server) {
+	instDir, wysServer = updaterTestInstall(t)
+	m = NewMemFS()
+	assert.Nil(t, m.MkdirAll(instDir, 0755))
+	dat, err := os.ReadFile("./testdata/client.1.0.0.wyc")
+	assert.Nil(t, err)
+	assert.Nil(t, m.WriteFile(filepath.Join(instDir, CLIENT_WYC), dat, 0644))
+	assert.Nil(t, m.WriteFile(filepath.Join(instDir, "WidgetX.txt"), []byte("1.0.0"), 0644))
+
+	wyuServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./testdata/widgetX.1.0.1.wyu")
+	}))
+	t.Cleanup(wyuServer.Close)
+	return m, instDir, wysServer, wyuServer
+}
+
+func TestUpdater_Update_memFS(t *testing.T) {
+	m, instDir, wysServer, wyuServer := updaterTestMemInstall(t)
+	u := NewUpdater(
+		WithArgs(Args{WYSTestServer: wysServer.URL, WYUTestServer: wyuServer.URL}),
+		WithInstallDir(instDir),
+		WithServiceController(&fakeServices{}),
+		WithFS(m),
+	)
+
+	result, err := u.Update(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, result.ExitCode)
+	assert.Equal(t, "1.0.1", readMemFile(t, m, filepath.Join(instDir, "WidgetX.txt")))
+	iuc, err := (Info{FS: m}).ParseWYC(filepath.Join(instDir, CLIENT_WYC))
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.1", string(iuc.IucInstalledVersion.Value))
+
+	// nothing was installed on disk
+	assert.False(t, fileExists(filepath.Join(instDir, "WidgetX.txt")))
+}
+
+func TestUpdater_Update_memFS_failed(t *testing.T) {
+	m, instDir, wysServer, wyuServer := updaterTestMemInstall(t)
+	u := NewUpdater(
+		WithArgs(Args{WYSTestServer: wysServer.URL, WYUTestServer: wyuServer.URL}),
+		WithInstallDir(instDir),
+		WithServiceController(&fakeServices{}),
+		WithFS(m),
+	)
+
+	// the new file can't be moved into place
+	m.FailOp(FS_OP_RENAME, filepath.Join(instDir, TempDirPrefix()+"*", "base", "WidgetX.txt"), syscall.EXDEV)
+	result, err := u.Update(context.Background())
+	assert.True(t, errors.Is(err, ErrInstall))
+	assert.True(t, errors.Is(err, syscall.EXDEV))
+	assert.Equal(t, EXIT_INSTALL, result.ExitCode)
+	assert.Equal(t, ROLLBACK_SUCCEEDED, result.Rollback)
+
+	// the old file is back and the failure is recorded
+	assert.Equal(t, "1.0.0", readMemFile(t, m, filepath.Join(instDir, "WidgetX.txt")))
+	assert.Equal(t, 1, result.FailedInstall.Attempts)
+	record, err := ReadFailedInstall(m, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.1", record.Version)
+}
+
+func TestUpdater_Update_memFS_restoreFailed(t *testing.T) {
+	m, instDir, wysServer, wyuServer := updaterTestMemInstall(t)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	u := NewUpdater(
+		WithArgs(Args{WYSTestServer: wysServer.URL, WYUTestServer: wyuServer.URL}),
+		WithInstallDir(instDir),
+		WithServiceController(&fakeServices{}),
+		WithFS(m),
+		WithClock(clock),
+	)
+
+	// the new file can't be moved into place and the old one can't be put
+	// back
+	backupDir := filepath.Join(instDir, BACKUPS_DIR_NAME, "1.0.0")
+	installFailed := false
+	m.AddFault(func(op FSOp, name string) error {
+		if op != FS_OP_RENAME {
+			return nil
+		}
+		if ok, _ := filepath.Match(filepath.Join(instDir, TempDirPrefix()+"*", "base", "WidgetX.txt"), name); ok {
+			installFailed = true
+			return syscall.EXDEV
+		}
+		if installFailed && name == filepath.Join(backupDir, backupFilesDir, "WidgetX.txt") {
+			return syscall.EACCES
+		}
+		return nil
+	})
+	result, err := u.Update(context.Background())
+	assert.True(t, errors.Is(err, ErrRollbackFailed))
+	assert.Contains(t, err.Error(), backupDir)
+	assert.Equal(t, ROLLBACK_FAILED, result.Rollback)
+	assert.Equal(t, []string{backupDir}, result.KeptBackups)
+
+	// the backup of the file that wasn't restored is kept
+	assert.Equal(t, "1.0.0", readMemFile(t, m, filepath.Join(backupDir, backupFilesDir, "WidgetX.txt")))
+	backups, err := ListBackups(m, instDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(backups))
+	assert.Equal(t, clock.now, backups[0].CreatedAt)
+}
+
+func TestUpdater_Stage_clock(t *testing.T) {
+	m, instDir, wysServer, wyuServer := updaterTestMemInstall(t)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	stageDir := filepath.Join(instDir, STAGING_DIR_NAME)
+	u := NewUpdater(
+		WithArgs(Args{WYSTestServer: wysServer.URL, WYUTestServer: wyuServer.URL, Stagedir: stageDir}),
+		WithInstallDir(instDir),
+		WithFS(m),
+		WithClock(clock),
+	)
+
+	// the result and the staged update are stamped by the updater's clock
+	result, err := u.Stage(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, clock.now, result.StartTime)
+	assert.Equal(t, clock.now, result.EndTime)
+	assert.Equal(t, int64(0), result.DurationMs)
+	manifest, err := ReadStagingManifest(m, stageDir)
+	assert.Nil(t, err)
+	assert.Equal(t, clock.now, manifest.StagedAt)
+}
+
+func TestUpdater_Check_locked(t *testing.T) {
+	instDir, wysServer := updaterTestInstall(t)
+	lock, err := AcquireUpdateLock(instDir)
+	assert.Nil(t, err)
+	defer lock.Release()
+
+	u := NewUpdater(WithArgs(Args{WYSTestServer: wysServer.URL}), WithInstallDir(instDir))
+	result, err := u.Check(context.Background())
+	assert.True(t, errors.Is(err, ErrUpdateInProgress))
+	assert.Equal(t, EXIT_UPDATE_IN_PROGRESS, result.ExitCode)
+
+	// wyUpdate never exits with 3
+	u = NewUpdater(WithArgs(Args{WYSTestServer: wysServer.URL, Legacyexitcodes: true}), WithInstallDir(instDir))
+	result, err = u.Check(context.Background())
+	assert.True(t, errors.Is(err, ErrUpdateInProgress))
+	assert.Equal(t, EXIT_ERROR, result.ExitCode)
+}
+
+func TestUpdater_Check_failedBefore(t *testing.T) {
+	instDir, wysServer := updaterTestInstall(t)
+
+	// the update failed half an hour ago
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	wys, err := os.ReadFile("./testdata/widgetX.1.0.1.wys")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME), wys, 0644))
+	record := FailedInstall{
+		Version:     "1.0.1",
+		Reason:      "file locked",
+		LastFailure: clock.now.Add(-30 * time.Minute),
+		Attempts:    1,
+	}
+	dat, err := json.Marshal(record)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(instDir, INSTALL_FAILED_SENTINAL_INFO_FILE_NAME), dat, 0644))
+
+	u := NewUpdater(
+		WithArgs(Args{WYSTestServer: wysServer.URL, Retrybudget: 2, Retrybackoff: time.Hour}),
+		WithInstallDir(instDir),
+		WithClock(clock),
+	)
+
+	result, err := u.Check(context.Background())
+	assert.True(t, errors.Is(err, ErrFailedBefore))
+	assert.Equal(t, EXIT_FAILED_BEFORE, result.ExitCode)
+	assert.Equal(t, clock.now, result.StartTime)
+	assert.Equal(t, clock.now, result.EndTime)
+	assert.Equal(t, int64(0), result.DurationMs)
+	assert.Equal(t, 1, result.FailedInstall.Attempts)
+
+	// the backoff has passed
+	clock.Sleep(context.Background(), time.Hour)
+	result, err = u.Check(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_UPDATE_AVALIABLE, result.ExitCode)
+
+	// clearing the failure removes the sentinel
+	result, err = u.ClearFailed(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, result.ExitCode)
+	assert.Equal(t, "file locked", result.FailedInstall.Reason)
+	assert.False(t, fileExists(filepath.Join(instDir, INSTALL_FAILED_SENTINAL_WYS_FILE_NAME)))
+}
+
+func TestUpdater_Rollback(t *testing.T) {
+	instDir := t.TempDir()
+	wycFile := filepath.Join(instDir, CLIENT_WYC)
+	assert.Nil(t, os.WriteFile(wycFile, []byte("1.0.0"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(instDir, "widget.txt"), []byte("1.0.0"), 0644))
+
+	srcDir := t.TempDir()
+	updates := []string{filepath.Join(srcDir, "widget.txt")}
+	assert.Nil(t, os.WriteFile(updates[0], []byte("1.0.1"), 0644))
+	udt := ConfigUDT{
+		ServiceToStopBeforeUpdate: []TLV{serviceTLV("widget")},
+		ServiceToStartAfterUpdate: []TLV{serviceTLV("widget")},
+	}
+	_, err := CreateBackup(OSFS{}, instDir, wycFile, "1.0.0", "1.0.1", updates, udt, time.Now())
+	assert.Nil(t, err)
+	assert.Nil(t, InstallUpdate(context.Background(), OSFS{}, ConfigUDT{}, updates, instDir, nil, nil))
+
+	services := &fakeServices{}
+	u := NewUpdater(WithInstallDir(instDir), WithServiceController(services))
+	result, err := u.Rollback(context.Background(), "1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, EXIT_SUCCESS, result.ExitCode)
+	assert.Equal(t, ACTION_ROLLBACK, result.Action)
+	assert.Equal(t, "1.0.0", readTestFile(t, filepath.Join(instDir, "widget.txt")))
+	assert.Equal(t, []string{"widget"}, services.stopped)
+	assert.Equal(t, []string{"widget"}, services.started)
+
+	// nothing left to roll back to
+	result, err = u.Rollback(context.Background(), "")
+	assert.True(t, errors.Is(err, ErrConfig))
+	assert.Equal(t, EXIT_CONFIG, result.ExitCode)
+}
@@ -0,0 +1,168 @@
+package updater
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Checks run by VerifyPackage, in order
+const (
+	VERIFY_CHECK_WYC       = "wyc"       // the WYC file parses
+	VERIFY_CHECK_WYS       = "wys"       // the WYS file parses
+	VERIFY_CHECK_SIZE      = "size"      // the WYU file has the size in the WYS file
+	VERIFY_CHECK_ADLER32   = "adler32"   // the WYU file has the Adler32 in the WYS file
+	VERIFY_CHECK_SIGNATURE = "signature" // the WYU file is signed by the WYC file's key
+	VERIFY_CHECK_ZIP       = "zip"       // the WYU file extracts without escaping its directory
+	VERIFY_CHECK_UDT       = "udt"       // the WYU file has a valid updtdetails.udt
+	VERIFY_CHECK_HOOKS     = "hooks"     // the WYU file's hooks manifest, if any, is valid
+	VERIFY_CHECK_VERSION   = "version"   // the update is newer than the installed version
+)
+
+// Outcomes of a VerifyCheck
+const (
+	VERIFY_PASSED  = "pass"
+	VERIFY_FAILED  = "fail"
+	VERIFY_SKIPPED = "skip" // an earlier check failed, or the check doesn't apply
+)
+
+// VerifyCheck is the outcome of one of the checks of VerifyPackage
+type VerifyCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// VerifyReport is the outcome of VerifyPackage
+type VerifyReport struct {
+	Passed           bool          `json:"passed"`
+	InstalledVersion string        `json:"installed_version,omitempty"`
+	AvailableVersion string        `json:"available_version,omitempty"`
+	Checks           []VerifyCheck `json:"checks"`
+}
+
+// VerifyPackage runs the checks the updater makes before installing the
+// update in `wysPath` and `wyuPath` on a machine with the WYC file
+// `wycPath`, without installing anything. The WYU file is extracted in
+// memory. Checks that depend on a failed check are skipped.
+func VerifyPackage(wycPath string, wysPath string, wyuPath string) VerifyReport {
+	var report VerifyReport
+	check := func(name string, err error, detail string) bool {
+		c := VerifyCheck{Name: name, Status: VERIFY_PASSED, Detail: detail}
+		if err != nil {
+			c.Status = VERIFY_FAILED
+			c.Detail = err.Error()
+		}
+		report.Checks = append(report.Checks, c)
+		return err == nil
+	}
+	skip := func(detail string, names ...string) {
+		for _, name := range names {
+			report.Checks = append(report.Checks, VerifyCheck{Name: name, Status: VERIFY_SKIPPED, Detail: detail})
+		}
+	}
+	iuc, err := Info{}.ParseWYC(wycPath)
+	wycOK := check(VERIFY_CHECK_WYC, err, fmt.Sprintf("installed version %s", iuc.IucInstalledVersion.Value))
+	if wycOK {
+		report.InstalledVersion = string(iuc.IucInstalledVersion.Value)
+	}
+
+	wys, err := Info{}.ParseWYSFromFilePath(wysPath, Args{})
+	if !check(VERIFY_CHECK_WYS, err, fmt.Sprintf("version %s", wys.VersionToUpdate)) {
+		skip("the WYS file is invalid", VERIFY_CHECK_SIZE, VERIFY_CHECK_ADLER32, VERIFY_CHECK_SIGNATURE)
+	} else {
+		report.AvailableVersion = wys.VersionToUpdate
+		verifyWyuFile(iuc, wycOK, wys, wyuPath, check, skip)
+	}
+
+	// the WYU file is extracted to memory, nothing is written to disk
+	m := NewMemFS()
+	dir := filepath.Join(string(filepath.Separator), "verify")
+	var files []string
+	dat, err := OSFS{}.ReadFile(wyuPath)
+	if err == nil {
+		err = m.MkdirAll(dir, 0755)
+	}
+	if err == nil {
+		err = m.WriteFile(filepath.Join(dir, "wyu"), dat, 0644)
+	}
+	if err == nil {
+		_, files, err = Unzip(m, filepath.Join(dir, "wyu"), filepath.Join(dir, "extracted"))
+	}
+	if !check(VERIFY_CHECK_ZIP, err, fmt.Sprintf("%d files", len(files))) {
+		skip("the WYU file can't be extracted", VERIFY_CHECK_UDT, VERIFY_CHECK_HOOKS)
+	} else {
+		udt, updates, err := GetUpdateDetails(m, files)
+		check(VERIFY_CHECK_UDT, err, udtDetail(udt, updates))
+		hooks, err := LoadHooks(m, files)
+		check(VERIFY_CHECK_HOOKS, err, fmt.Sprintf("%d pre-install, %d post-install, %d post-rollback", len(hooks.PreInstall), len(hooks.PostInstall), len(hooks.PostRollback)))
+	}
+
+	switch {
+	case report.InstalledVersion == "" || report.AvailableVersion == "":
+		skip("the versions aren't known", VERIFY_CHECK_VERSION)
+	case CompareVersions(report.InstalledVersion, report.AvailableVersion) != A_LESS_THAN_B:
+		check(VERIFY_CHECK_VERSION, fmt.Errorf("version %s isn't newer than the installed version %s", report.AvailableVersion, report.InstalledVersion), "")
+	default:
+		check(VERIFY_CHECK_VERSION, nil, fmt.Sprintf("%s to %s", report.InstalledVersion, report.AvailableVersion))
+	}
+
+	report.Passed = true
+	for _, c := range report.Checks {
+		if c.Status == VERIFY_FAILED {
+			report.Passed = false
+		}
+	}
+	return report
+}
+
+// verifyWyuFile checks the WYU file against the WYS file, and its signature
+// against the WYC file's key if the WYC file is valid
+func verifyWyuFile(iuc ConfigIUC, wycOK bool, wys ConfigWYS, wyuPath string, check func(string, error, string) bool, skip func(string, ...string)) {
+	fi, err := OSFS{}.Stat(wyuPath)
+	if err != nil {
+		check(VERIFY_CHECK_SIZE, err, "")
+		skip("the WYU file can't be read", VERIFY_CHECK_ADLER32, VERIFY_CHECK_SIGNATURE)
+		return
+	}
+
+	switch {
+	case wys.UpdateFileSize == 0:
+		skip("the WYS file has no size", VERIFY_CHECK_SIZE)
+	case fi.Size() != wys.UpdateFileSize:
+		check(VERIFY_CHECK_SIZE, fmt.Errorf("the WYU file is %d bytes, the WYS file expects %d", fi.Size(), wys.UpdateFileSize), "")
+	default:
+		check(VERIFY_CHECK_SIZE, nil, fmt.Sprintf("%d bytes", fi.Size()))
+	}
+
+	sum, err := GetAdler32(wyuPath)
+	if err == nil && int64(sum) != wys.UpdateFileAdler32 {
+		err = fmt.Errorf("the WYU file's Adler32 is %d, the WYS file expects %d", sum, wys.UpdateFileAdler32)
+	}
+	check(VERIFY_CHECK_ADLER32, err, fmt.Sprint(sum))
+
+	switch {
+	case !wycOK:
+		skip("the WYC file is invalid", VERIFY_CHECK_SIGNATURE)
+	case iuc.IucPublicKey.Value == nil:
+		skip("the WYC file has no public key, the updater doesn't check signatures", VERIFY_CHECK_SIGNATURE)
+	default:
+		check(VERIFY_CHECK_SIGNATURE, checkWyuSignature(OSFS{}, iuc, wys, wyuPath), "signed by the WYC file's key")
+	}
+}
+
+// udtDetail describes the update details of a WYU file
+func udtDetail(udt ConfigUDT, updates []string) string {
+	var names []string
+	for _, f := range updates {
+		names = append(names, filepath.Base(f))
+	}
+	detail := fmt.Sprintf("%d files (%s)", len(updates), strings.Join(names, ", "))
+	if services := tlvStrings(udt.ServiceToStopBeforeUpdate); len(services) > 0 {
+		detail += fmt.Sprintf(", stops %s", strings.Join(services, ", "))
+	}
+	if services := tlvStrings(udt.ServiceToStartAfterUpdate); len(services) > 0 {
+		detail += fmt.Sprintf(", starts %s", strings.Join(services, ", "))
+	}
+	return detail
+}
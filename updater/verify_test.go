@@ -0,0 +1,103 @@
+package updater
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// verifyStatuses returns the status of each check in `report`
+func verifyStatuses(report VerifyReport) map[string]string {
+	statuses := make(map[string]string)
+	for _, c := range report.Checks {
+		statuses[c.Name] = c.Status
+	}
+	return statuses
+}
+
+func TestVerify_VerifyPackage(t *testing.T) {
+	report := VerifyPackage("./testdata/client.1.0.0.wyc", "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	assert.True(t, report.Passed)
+	assert.Equal(t, "1.0.0", report.InstalledVersion)
+	assert.Equal(t, "1.0.1", report.AvailableVersion)
+	assert.Equal(t, 9, len(report.Checks))
+	for _, c := range report.Checks {
+		assert.Equal(t, VERIFY_PASSED, c.Status, c.Name)
+	}
+
+	// already installed
+	report = VerifyPackage("./testdata/client.1.0.1.wyc", "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	assert.False(t, report.Passed)
+	assert.Equal(t, VERIFY_FAILED, verifyStatuses(report)[VERIFY_CHECK_VERSION])
+}
+
+func TestVerify_VerifyPackage_tampered(t *testing.T) {
+	dat, err := os.ReadFile("./testdata/widgetX.1.0.1.wyu")
+	assert.Nil(t, err)
+	dat[len(dat)/2] ^= 0xff
+	wyu := filepath.Join(t.TempDir(), "widget.wyu")
+	assert.Nil(t, os.WriteFile(wyu, dat, 0644))
+
+	report := VerifyPackage("./testdata/client.1.0.0.wyc", "./testdata/widgetX.1.0.1.wys", wyu)
+	assert.False(t, report.Passed)
+	statuses := verifyStatuses(report)
+	assert.Equal(t, VERIFY_PASSED, statuses[VERIFY_CHECK_SIZE])
+	assert.Equal(t, VERIFY_FAILED, statuses[VERIFY_CHECK_ADLER32])
+	assert.Equal(t, VERIFY_FAILED, statuses[VERIFY_CHECK_SIGNATURE])
+}
+
+func TestVerify_VerifyPackage_wrongKey(t *testing.T) {
+	priv, err := GenerateKey(DEFAULT_KEY_BITS)
+	assert.Nil(t, err)
+	wyc := filepath.Join(t.TempDir(), CLIENT_WYC)
+	_, err = EditWYC("./testdata/client.1.0.0.wyc", wyc, func(config *ConfigIUC) error {
+		return config.SetField(WYC_FIELD_PUBLIC_KEY, PublicKeyXML(&priv.PublicKey))
+	})
+	assert.Nil(t, err)
+
+	report := VerifyPackage(wyc, "./testdata/widgetX.1.0.1.wys", "./testdata/widgetX.1.0.1.wyu")
+	assert.False(t, report.Passed)
+	statuses := verifyStatuses(report)
+	assert.Equal(t, VERIFY_PASSED, statuses[VERIFY_CHECK_ADLER32])
+	assert.Equal(t, VERIFY_FAILED, statuses[VERIFY_CHECK_SIGNATURE])
+}
+
+func TestVerify_VerifyPackage_zipSlip(t *testing.T) {
+	dir := t.TempDir()
+	wyu := filepath.Join(dir, "evil.wyu")
+	f, err := os.Create(wyu)
+	assert.Nil(t, err)
+	zipw := zip.NewWriter(f)
+	w, err := zipw.Create("../../evil.exe")
+	assert.Nil(t, err)
+	w.Write([]byte("evil"))
+	assert.Nil(t, zipw.Close())
+	assert.Nil(t, f.Close())
+
+	wys, err := NewWYS("1.0.1", wyu, []string{"http://127.0.0.1/evil.wyu"})
+	assert.Nil(t, err)
+	wysPath := filepath.Join(dir, "evil.wys")
+	assert.Nil(t, WriteWYSFile(wysPath, wys))
+
+	report := VerifyPackage("./testdata/client.1.0.0.wyc", wysPath, wyu)
+	assert.False(t, report.Passed)
+	statuses := verifyStatuses(report)
+	assert.Equal(t, VERIFY_PASSED, statuses[VERIFY_CHECK_ADLER32])
+	assert.Equal(t, VERIFY_FAILED, statuses[VERIFY_CHECK_SIGNATURE])
+	assert.Equal(t, VERIFY_FAILED, statuses[VERIFY_CHECK_ZIP])
+	assert.Equal(t, VERIFY_SKIPPED, statuses[VERIFY_CHECK_UDT])
+}
+
+func TestVerify_VerifyPackage_missing(t *testing.T) {
+	report := VerifyPackage("./testdata/missing.wyc", "./testdata/missing.wys", "./testdata/missing.wyu")
+	assert.False(t, report.Passed)
+	statuses := verifyStatuses(report)
+	assert.Equal(t, VERIFY_FAILED, statuses[VERIFY_CHECK_WYC])
+	assert.Equal(t, VERIFY_FAILED, statuses[VERIFY_CHECK_WYS])
+	assert.Equal(t, VERIFY_SKIPPED, statuses[VERIFY_CHECK_SIGNATURE])
+	assert.Equal(t, VERIFY_FAILED, statuses[VERIFY_CHECK_ZIP])
+	assert.Equal(t, VERIFY_SKIPPED, statuses[VERIFY_CHECK_VERSION])
+}
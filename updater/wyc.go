@@ -2,6 +2,7 @@ package updater
 
 import (
 	"archive/zip"
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -76,6 +77,10 @@ type ConfigIUC struct {
 	IucCloseWyupate         TLV
 	IucCustomTitleBar       TLV
 	IucPublicKey            TLV
+
+	// ReportURL isn't part of iuclient.iuc, it is read from the
+	// REPORT_URL_FILE_NAME file in the WYC archive (if there is one)
+	ReportURL string
 }
 
 type wycConfig struct {
@@ -223,14 +228,18 @@ func readIuc(iucReader io.Reader) (ConfigIUC, error) {
 
 // ParseWYC parses a compress WYC file, returning the details as a ConfigIUC struct
 func (wycInfo Info) ParseWYC(compressedWYC string) (ConfigIUC, error) {
-	var config ConfigIUC
-
-	zipr, err := zip.OpenReader(compressedWYC)
+	zipr, closer, err := openZip(fsOrOS(wycInfo.FS), compressedWYC)
 	if err != nil {
-		return config, err
+		return ConfigIUC{}, err
 	}
-	defer zipr.Close()
+	defer closer.Close()
 
+	return readWYC(zipr)
+}
+
+// readWYC reads the details from the WYC archive `zipr`
+func readWYC(zipr *zip.Reader) (ConfigIUC, error) {
+	var config ConfigIUC
 	for _, f := range zipr.File {
 		// "iuclient.iuc" is the name of the uncompressed wyc file
 		if f.FileHeader.Name == IUCLIENT_IUC {
@@ -239,10 +248,25 @@ func (wycInfo Info) ParseWYC(compressedWYC string) (ConfigIUC, error) {
 				return config, err
 			}
 			defer fh.Close()
+			reportURL := config.ReportURL
 			config, err = readIuc(fh)
 			if err != nil {
 				return config, err
 			}
+			config.ReportURL = reportURL
+		}
+
+		if f.FileHeader.Name == REPORT_URL_FILE_NAME {
+			fh, err := f.Open()
+			if err != nil {
+				return config, err
+			}
+			dat, err := io.ReadAll(fh)
+			fh.Close()
+			if err != nil {
+				return config, err
+			}
+			config.ReportURL = strings.TrimSpace(string(dat))
 		}
 	}
 	return config, nil
@@ -256,6 +280,11 @@ func writeIuc(config ConfigIUC, path string) error {
 	}
 	defer f.Close()
 
+	return writeIucTo(f, config)
+}
+
+// writeIucTo writes the IUC file for `config` to `f`
+func writeIucTo(f io.Writer, config ConfigIUC) error {
 	// write HEADER
 	f.Write([]byte(IUC_HEADER))
 
@@ -314,7 +343,7 @@ func writeIuc(config ConfigIUC, path string) error {
 	// BOOL_IUC_CLOSE_WYUPDATE:
 	writeTlv(f, config.IucCloseWyupate)
 
-	err = binary.Write(f, binary.BigEndian, byte(END_IUC))
+	err := binary.Write(f, binary.BigEndian, byte(END_IUC))
 	if nil != err {
 		return err
 	}
@@ -322,6 +351,65 @@ func writeIuc(config ConfigIUC, path string) error {
 	return nil
 }
 
+// setInstalledVersion sets the installed version of `config`
+func (config *ConfigIUC) setInstalledVersion(version string) {
+	config.IucInstalledVersion.Value = []byte(version)
+	config.IucInstalledVersion.DataLength = uint32(len(config.IucInstalledVersion.Value) + 4)
+	config.IucInstalledVersion.Length = uint32(len(config.IucInstalledVersion.Value))
+}
+
+// wycWithNewVersionNumber returns a copy of the WYC archive `orig` with a
+// new iuclient.iuc recording `version` as the installed version
+func wycWithNewVersionNumber(config ConfigIUC, orig []byte, version string) ([]byte, error) {
+	config.setInstalledVersion(version)
+	return wycWithConfig(config, orig)
+}
+
+// wycWithConfig returns a copy of the WYC archive `orig` with iuclient.iuc
+// replaced by `config`. The other files (s.png, t.png, ...) are kept.
+func wycWithConfig(config ConfigIUC, orig []byte) ([]byte, error) {
+	zipr, err := zip.NewReader(bytes.NewReader(orig), int64(len(orig)))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zipw := zip.NewWriter(&buf)
+	for _, f := range zipr.File {
+		header := f.FileHeader
+		header.Method = zip.Deflate
+		w, err := zipw.CreateHeader(&header)
+		if err != nil {
+			return nil, err
+		}
+
+		if f.Name == IUCLIENT_IUC {
+			err = writeIucTo(w, config)
+		} else {
+			err = copyZipFile(w, f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := zipw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// copyZipFile copies the contents of `f` to `w`
+func copyZipFile(w io.Writer, f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(w, rc)
+	return err
+}
+
 // UpdateWYCWithNewVersionNumber updates a WYC file with a new version number
 func UpdateWYCWithNewVersionNumber(config ConfigIUC, origWYCFile string, version string) (newWYCFile string, err error) {
 	// Unzip the archive. We'll create a new iuclient.iuc, but we need the
@@ -333,14 +421,12 @@ func UpdateWYCWithNewVersionNumber(config ConfigIUC, origWYCFile string, version
 		return "", err
 	}
 
-	_, files, err := Unzip(origWYCFile, tmpDir)
+	_, files, err := Unzip(OSFS{}, origWYCFile, tmpDir)
 	if nil != err {
 		return "", err
 	}
 
-	config.IucInstalledVersion.Value = []byte(version)
-	config.IucInstalledVersion.DataLength = uint32(len(config.IucInstalledVersion.Value) + 4)
-	config.IucInstalledVersion.Length = uint32(len(config.IucInstalledVersion.Value))
+	config.setInstalledVersion(version)
 
 	for _, f := range files {
 		if filepath.Base(f) == IUCLIENT_IUC {
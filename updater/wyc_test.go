@@ -109,7 +109,7 @@ func TestWYC_WriteIUC(t *testing.T) {
 	assert.Nil(t, err)
 
 	found := false
-	_, files, err := Unzip(origClientWYC, tmpDir)
+	_, files, err := Unzip(OSFS{}, origClientWYC, tmpDir)
 	for _, f := range files {
 		// fmt.Println(f)
 		if filepath.Base(f) == IUCLIENT_IUC {
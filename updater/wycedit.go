@@ -0,0 +1,175 @@
+package updater
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// names of the WYC fields that can be read and changed with GetField and
+// SetField
+const (
+	WYC_FIELD_COMPANY      = "company"
+	WYC_FIELD_PRODUCT      = "product"
+	WYC_FIELD_GUID         = "guid"
+	WYC_FIELD_VERSION      = "version"
+	WYC_FIELD_SERVER_SITES = "serversites"
+	WYC_FIELD_PUBLIC_KEY   = "publickey"
+)
+
+// WYCFields are the names of the WYC fields in the order they are listed
+var WYCFields = []string{
+	WYC_FIELD_COMPANY,
+	WYC_FIELD_PRODUCT,
+	WYC_FIELD_GUID,
+	WYC_FIELD_VERSION,
+	WYC_FIELD_SERVER_SITES,
+	WYC_FIELD_PUBLIC_KEY,
+}
+
+// GetField returns the values of the field `name`. Only the server sites
+// can have more than one value.
+func (config ConfigIUC) GetField(name string) ([]string, error) {
+	switch name {
+	case WYC_FIELD_COMPANY:
+		return []string{ValueToString(&config.IucCompanyName)}, nil
+	case WYC_FIELD_PRODUCT:
+		return []string{ValueToString(&config.IucProductName)}, nil
+	case WYC_FIELD_GUID:
+		return []string{ValueToString(&config.IucGUID)}, nil
+	case WYC_FIELD_VERSION:
+		return []string{ValueToString(&config.IucInstalledVersion)}, nil
+	case WYC_FIELD_SERVER_SITES:
+		sites := make([]string, 0, len(config.IucServerFileSite))
+		for _, site := range config.IucServerFileSite {
+			sites = append(sites, ValueToString(&site))
+		}
+		return sites, nil
+	case WYC_FIELD_PUBLIC_KEY:
+		return []string{ValueToString(&config.IucPublicKey)}, nil
+	}
+	return nil, fmt.Errorf("unknown WYC field %q; expected one of %s", name, strings.Join(WYCFields, ", "))
+}
+
+// SetField sets the field `name` to `values`. The server sites take one or
+// more values, the other fields exactly one. The public key has to be
+// <RSAKeyValue> XML.
+func (config *ConfigIUC) SetField(name string, values ...string) error {
+	if _, err := config.GetField(name); err != nil {
+		return err
+	}
+	for _, v := range values {
+		if v == "" {
+			return fmt.Errorf("%s can't be empty", name)
+		}
+	}
+
+	if name == WYC_FIELD_SERVER_SITES {
+		if len(values) == 0 {
+			return fmt.Errorf("%s needs at least one value", name)
+		}
+		config.setWysUrls(values...)
+		return nil
+	}
+	if len(values) != 1 {
+		return fmt.Errorf("%s takes one value, got %d", name, len(values))
+	}
+
+	v := values[0]
+	switch name {
+	case WYC_FIELD_COMPANY:
+		config.IucCompanyName = iucDstringTLV(DSTRING_IUC_COMPANY_NAME, v)
+	case WYC_FIELD_PRODUCT:
+		config.IucProductName = iucDstringTLV(DSTRING_IUC_PRODUCT_NAME, v)
+	case WYC_FIELD_GUID:
+		config.IucGUID = iucStringTLV(STRING_IUC_GUID, v)
+	case WYC_FIELD_VERSION:
+		config.IucInstalledVersion = iucDstringTLV(DSTRING_IUC_INSTALLED_VERSION, v)
+	case WYC_FIELD_PUBLIC_KEY:
+		// the updater can't verify updates with a key it can't parse
+		if _, err := ParsePublicKey(v); err != nil {
+			return fmt.Errorf("invalid public key; %w", err)
+		}
+		config.IucPublicKey = iucStringTLV(STRING_IUC_PUBLIC_KEY, v)
+	}
+	return nil
+}
+
+// EditWYC applies `edit` to the details in the WYC file `src` and writes
+// the result to `dst`, which may be `src`. The other files in the archive
+// are kept. The new archive is parsed again before it is written, so a
+// WYC file the updater can't read is never written.
+func EditWYC(src string, dst string, edit func(*ConfigIUC) error) (ConfigIUC, error) {
+	orig, err := os.ReadFile(src)
+	if err != nil {
+		return ConfigIUC{}, err
+	}
+	zipr, err := zip.NewReader(bytes.NewReader(orig), int64(len(orig)))
+	if err != nil {
+		return ConfigIUC{}, err
+	}
+	if !zipHasFile(zipr, IUCLIENT_IUC) {
+		return ConfigIUC{}, fmt.Errorf("no %s in %s", IUCLIENT_IUC, src)
+	}
+	config, err := readWYC(zipr)
+	if err != nil {
+		return config, err
+	}
+
+	if err := edit(&config); err != nil {
+		return config, err
+	}
+
+	dat, err := wycWithConfig(config, orig)
+	if err != nil {
+		return config, err
+	}
+	if err := verifyWYC(config, dat); err != nil {
+		return config, fmt.Errorf("edited WYC file is invalid; %w", err)
+	}
+	return config, writeFileAtomic(OSFS{}, dst, dat)
+}
+
+// verifyWYC parses the WYC archive `dat` and checks it has the fields of
+// `config`
+func verifyWYC(config ConfigIUC, dat []byte) error {
+	zipr, err := zip.NewReader(bytes.NewReader(dat), int64(len(dat)))
+	if err != nil {
+		return err
+	}
+	parsed, err := readWYC(zipr)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range WYCFields {
+		want, _ := config.GetField(name)
+		got, _ := parsed.GetField(name)
+		if strings.Join(want, "\n") != strings.Join(got, "\n") {
+			return fmt.Errorf("%s is %q, expected %q", name, got, want)
+		}
+	}
+	return nil
+}
+
+// zipHasFile returns true if the archive has a file called `name`
+func zipHasFile(zipr *zip.Reader, name string) bool {
+	for _, f := range zipr.File {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// iucDstringTLV returns `s` as a d. string in a ConfigIUC
+func iucDstringTLV(tag uint8, s string) TLV {
+	return TLV{Tag: tag, Type: TLV_DSTRING, DataLength: uint32(len(s)) + 4, Length: uint32(len(s)), Value: []byte(s)}
+}
+
+// iucStringTLV returns `s` as a string in a ConfigIUC
+func iucStringTLV(tag uint8, s string) TLV {
+	return TLV{Tag: tag, Type: TLV_STRING, Length: uint32(len(s)), Value: []byte(s)}
+}
@@ -0,0 +1,107 @@
+package updater
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWYCEdit_GetField(t *testing.T) {
+	wyc, err := Info{}.ParseWYC("./testdata/client.1.0.0.wyc")
+	assert.Nil(t, err)
+
+	v, err := wyc.GetField(WYC_FIELD_PRODUCT)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"WidgetX"}, v)
+
+	v, err = wyc.GetField(WYC_FIELD_SERVER_SITES)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://127.0.0.1/updates/wyserver.wys?key=%urlargs%"}, v)
+
+	_, err = wyc.GetField("colour")
+	assert.NotNil(t, err)
+}
+
+func TestWYCEdit_SetField(t *testing.T) {
+	wyc, err := Info{}.ParseWYC("./testdata/client.1.0.0.wyc")
+	assert.Nil(t, err)
+
+	assert.Nil(t, wyc.SetField(WYC_FIELD_SERVER_SITES, "https://a.example.com/widget.wys", "https://b.example.com/widget.wys"))
+	v, _ := wyc.GetField(WYC_FIELD_SERVER_SITES)
+	assert.Equal(t, 2, len(v))
+
+	// only the server sites take more than one value
+	assert.NotNil(t, wyc.SetField(WYC_FIELD_COMPANY, "Acme", "Widgets Inc."))
+	assert.NotNil(t, wyc.SetField(WYC_FIELD_COMPANY))
+	assert.NotNil(t, wyc.SetField(WYC_FIELD_SERVER_SITES))
+	assert.NotNil(t, wyc.SetField(WYC_FIELD_VERSION, ""))
+	assert.NotNil(t, wyc.SetField("colour", "red"))
+
+	// the public key has to be usable
+	assert.NotNil(t, wyc.SetField(WYC_FIELD_PUBLIC_KEY, "not a key"))
+	priv, err := GenerateKey(DEFAULT_KEY_BITS)
+	assert.Nil(t, err)
+	assert.Nil(t, wyc.SetField(WYC_FIELD_PUBLIC_KEY, PublicKeyXML(&priv.PublicKey)))
+}
+
+func TestWYCEdit_EditWYC(t *testing.T) {
+	orig := "./testdata/client.1.0.0.wyc"
+	dst := filepath.Join(t.TempDir(), CLIENT_WYC)
+	priv, err := GenerateKey(DEFAULT_KEY_BITS)
+	assert.Nil(t, err)
+
+	_, err = EditWYC(orig, dst, func(config *ConfigIUC) error {
+		for name, values := range map[string][]string{
+			WYC_FIELD_COMPANY:      {"Acme"},
+			WYC_FIELD_PRODUCT:      {"Gadget"},
+			WYC_FIELD_GUID:         {"a8ba2d8c-7a53-4d8c-b6e6-3ec8e7a0e0a1"},
+			WYC_FIELD_VERSION:      {"2.0.0"},
+			WYC_FIELD_SERVER_SITES: {"https://mirror.example.com/gadget.wys?key=%urlargs%"},
+			WYC_FIELD_PUBLIC_KEY:   {PublicKeyXML(&priv.PublicKey)},
+		} {
+			if err := config.SetField(name, values...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+
+	wyc, err := Info{}.ParseWYC(dst)
+	assert.Nil(t, err)
+	assert.Equal(t, "Acme", string(wyc.IucCompanyName.Value))
+	assert.Equal(t, "Gadget", string(wyc.IucProductName.Value))
+	assert.Equal(t, "a8ba2d8c-7a53-4d8c-b6e6-3ec8e7a0e0a1", string(wyc.IucGUID.Value))
+	assert.Equal(t, "2.0.0", string(wyc.IucInstalledVersion.Value))
+	assert.Equal(t, []string{"https://mirror.example.com/gadget.wys?key=abc"}, wyc.GetWYSURLs(Args{Urlargs: "abc"}))
+	key, err := ParsePublicKey(string(wyc.IucPublicKey.Value))
+	assert.Nil(t, err)
+	assert.True(t, priv.PublicKey.Equal(&key.PublicKey))
+
+	// the images are kept
+	zipr, err := zip.OpenReader(dst)
+	assert.Nil(t, err)
+	defer zipr.Close()
+	assert.True(t, zipHasFile(&zipr.Reader, "s.png"))
+	assert.True(t, zipHasFile(&zipr.Reader, "t.png"))
+}
+
+func TestWYCEdit_EditWYC_error(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), CLIENT_WYC)
+
+	// nothing is written when the edit fails
+	_, err := EditWYC("./testdata/client.1.0.0.wyc", dst, func(config *ConfigIUC) error {
+		return config.SetField(WYC_FIELD_PUBLIC_KEY, "not a key")
+	})
+	assert.NotNil(t, err)
+	assert.False(t, pathExists(OSFS{}, dst))
+
+	// not a WYC file
+	_, err = EditWYC("./testdata/test.zip", dst, func(config *ConfigIUC) error { return nil })
+	assert.NotNil(t, err)
+	_, err = os.Stat(dst)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -7,6 +7,8 @@ package updater
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -72,6 +74,22 @@ type ConfigWYS struct {
 	UpdateFileSize     int64
 }
 
+// isWYSDstring returns true if the value of the WYS `tag` is a d. string
+func isWYSDstring(tag uint8) bool {
+	switch tag {
+	case DSTRING_WYS_CURRENT_LAST_VERSION,
+		DSTRING_WYS_LATEST_CHANGES,
+		DSTRING_WYS_MIN_CLIENT_VERSION,
+		DSTRING_WYS_SERVER_FILE_SITE,
+		DSTRING_WYS_UPDATE_ERROR_LINK,
+		DSTRING_WYS_UPDATE_ERROR_TEXT,
+		DSTRING_WYS_UPDATE_FILE_SITE,
+		DSTRING_WYS_VERSION_TO_UPDATE:
+		return true
+	}
+	return false
+}
+
 func ReadWYSTLV(r io.Reader) *TLV {
 	var record TLV
 
@@ -89,20 +107,11 @@ func ReadWYSTLV(r io.Reader) *TLV {
 	record.TagString = WYSTags[record.Tag]
 
 	// handle d. strings with the data length
-	switch record.Tag {
-	case DSTRING_WYS_CURRENT_LAST_VERSION,
-		DSTRING_WYS_LATEST_CHANGES,
-		DSTRING_WYS_MIN_CLIENT_VERSION,
-		DSTRING_WYS_SERVER_FILE_SITE,
-		DSTRING_WYS_UPDATE_ERROR_LINK,
-		DSTRING_WYS_UPDATE_ERROR_TEXT,
-		DSTRING_WYS_UPDATE_FILE_SITE,
-		DSTRING_WYS_VERSION_TO_UPDATE:
+	if isWYSDstring(record.Tag) {
 		err = binary.Read(r, binary.LittleEndian, &record.DataLength)
 		if err != nil {
 			return nil
 		}
-	default:
 	}
 
 	err = binary.Read(r, binary.LittleEndian, &record.Length)
@@ -138,13 +147,13 @@ func (wysInfo Info) ParseWYSFromReader(reader io.ReaderAt, size int64) (wys Conf
 // ParseWYSFromReader returns the parsed contents, wys, as read from the compressedWYSFilePath.
 // wys will always be zero value when err is not nil.
 func (wysInfo Info) ParseWYSFromFilePath(compressedWYSFilePath string, _ Args) (wys ConfigWYS, err error) {
-	zipr, err := zip.OpenReader(compressedWYSFilePath)
+	zipr, closer, err := openZip(fsOrOS(wysInfo.FS), compressedWYSFilePath)
 	if err != nil {
 		return wys, err
 	}
-	defer zipr.Close()
+	defer closer.Close()
 
-	return wysInfo.parseWYSFromZipReader(&zipr.Reader)
+	return wysInfo.parseWYSFromZipReader(zipr)
 }
 
 // parseWYSFromZipReader returns the parsed contents, wys, as read from zipr.
@@ -153,7 +162,7 @@ func (wysInfo Info) parseWYSFromZipReader(zipr *zip.Reader) (wys ConfigWYS, err
 	for _, f := range zipr.File {
 		// there is only one file in the archive
 		// "0" is the name of the uncompressed wys file
-		if f.FileHeader.Name == "0" {
+		if f.FileHeader.Name == wysEntryName {
 			fh, err := f.Open()
 			if err != nil {
 				return wys, err
@@ -219,6 +228,108 @@ func (wysInfo Info) parseWYSFromZipReader(zipr *zip.Reader) (wys ConfigWYS, err
 	return wys, err
 }
 
+// wysEntryName is the name of the uncompressed WYS file in the archive
+const wysEntryName = "0"
+
+// NewWYS returns the details of the update to `version` in `wyuFile`,
+// downloaded from `updateFileSites`. The WYU file's size and checksum are
+// filled in. FileSha1, the signature of the WYU file, is left to the caller.
+func NewWYS(version string, wyuFile string, updateFileSites []string) (ConfigWYS, error) {
+	fi, err := os.Stat(wyuFile)
+	if err != nil {
+		return ConfigWYS{}, err
+	}
+	adler, err := GetAdler32(wyuFile)
+	if err != nil {
+		return ConfigWYS{}, err
+	}
+
+	return ConfigWYS{
+		CurrentLastVersion: version,
+		VersionToUpdate:    version,
+		UpdateFileSite:     updateFileSites,
+		UpdateFileSize:     fi.Size(),
+		UpdateFileAdler32:  int64(adler),
+	}, nil
+}
+
+// WriteWYS writes `wys` to `w` as a compressed WYS file, the server file
+// zipped as "0". It is read back by ParseWYSFromReader. Like wyBuild, the
+// update details follow INT_WYS_DUMMY_VAR_LEN with their length, so
+// DummyVarLen is ignored.
+func WriteWYS(w io.Writer, wys ConfigWYS) error {
+	var update bytes.Buffer
+	writeWYSTLV(&update, DSTRING_WYS_VERSION_TO_UPDATE, []byte(wys.VersionToUpdate))
+	for _, site := range wys.UpdateFileSite {
+		writeWYSTLV(&update, DSTRING_WYS_UPDATE_FILE_SITE, []byte(site))
+	}
+	if len(wys.RTF) > 0 {
+		writeWYSTLV(&update, BYTE_WYS_RTF, wys.RTF)
+	}
+	// the changes are written even if there are none, like wyBuild
+	writeWYSTLV(&update, DSTRING_WYS_LATEST_CHANGES, []byte(wys.LatestChanges))
+	writeWYSTLV(&update, LONG_WYS_UPDATE_FILE_SIZE, longToValue(wys.UpdateFileSize))
+	writeWYSTLV(&update, LONG_WYS_UPDATE_FILE_ADLER32_CHECKSUM, longToValue(wys.UpdateFileAdler32))
+	if len(wys.FileSha1) > 0 {
+		writeWYSTLV(&update, BYTE_WYS_FILE_SHA1, wys.FileSha1)
+	}
+	if wys.WYSFolder != 0 {
+		writeWYSTLV(&update, INT_WYS_FOLDER, intToValue(uint32(wys.WYSFolder)))
+	}
+	if len(wys.UpdateErrorText) > 0 {
+		writeWYSTLV(&update, DSTRING_WYS_UPDATE_ERROR_TEXT, []byte(wys.UpdateErrorText))
+	}
+	if len(wys.UpdateErrorLink) > 0 {
+		writeWYSTLV(&update, DSTRING_WYS_UPDATE_ERROR_LINK, []byte(wys.UpdateErrorLink))
+	}
+
+	var dat bytes.Buffer
+	dat.WriteString(WYS_HEADER)
+	writeWYSTLV(&dat, DSTRING_WYS_CURRENT_LAST_VERSION, []byte(wys.CurrentLastVersion))
+	if len(wys.ServerFileSite) > 0 {
+		writeWYSTLV(&dat, DSTRING_WYS_SERVER_FILE_SITE, []byte(wys.ServerFileSite))
+	}
+	if len(wys.MinClientVersion) > 0 {
+		writeWYSTLV(&dat, DSTRING_WYS_MIN_CLIENT_VERSION, []byte(wys.MinClientVersion))
+	}
+	// the dummy var has no value, its length is the length of the update
+	// details
+	dat.WriteByte(INT_WYS_DUMMY_VAR_LEN)
+	binary.Write(&dat, binary.LittleEndian, uint32(update.Len()))
+	update.WriteTo(&dat)
+	dat.WriteByte(END_WYS)
+
+	zipw := zip.NewWriter(w)
+	f, err := zipw.CreateHeader(&zip.FileHeader{Name: wysEntryName, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(dat.Bytes()); err != nil {
+		return err
+	}
+	return zipw.Close()
+}
+
+// WriteWYSFile writes `wys` to the compressed WYS file `path`
+func WriteWYSFile(path string, wys ConfigWYS) error {
+	var buf bytes.Buffer
+	if err := WriteWYS(&buf, wys); err != nil {
+		return err
+	}
+	return writeFileAtomic(OSFS{}, path, buf.Bytes())
+}
+
+// writeWYSTLV writes a WYS TLV record. Unlike writeTlv, records with an
+// empty value are written.
+func writeWYSTLV(buf *bytes.Buffer, tag uint8, value []byte) {
+	buf.WriteByte(tag)
+	if isWYSDstring(tag) {
+		binary.Write(buf, binary.LittleEndian, uint32(len(value)+4))
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+	buf.Write(value)
+}
+
 // GetWYUURLs returns the UpdateFileSite(s) included in the WYS file associated with config and populates
 // urls with the site URLs.
 // args are used to inject any CLI provided URL arguments and allow for overriding of the site URL.
@@ -238,32 +349,29 @@ func (wys ConfigWYS) GetWYUURLs(args Args) (urls []string) {
 	return urls
 }
 
-var lastWyuFilePath string
-
-// lastWyuDownload returns the pathname for the wyu cache. This file
-// will contain the most recently downloaded wyu file
-func (wys ConfigWYS) lastWyuDownload() string {
-	// small efficiency hack that allows us to easily test
-	if lastWyuFilePath != "" {
-		return lastWyuFilePath
-	}
-	const lastWyuFileName = "last_wyu_download"
-
-	instDir := GetExeDir()
-	lastWyuFilePath = filepath.Join(instDir, lastWyuFileName)
+// lastWyuFileName is the name of the wyu cache in the install directory
+const lastWyuFileName = "last_wyu_download"
 
-	return lastWyuFilePath
+// lastWyuDownloadPath returns the pathname for the wyu cache in `instDir`. This
+// file will contain the most recently downloaded wyu file
+func lastWyuDownloadPath(instDir string) string {
+	return filepath.Join(instDir, lastWyuFileName)
 }
 
 // copyFile is a utility function to copy one file to another
 func copyFile(src, dst string) error {
-	source, err := os.Open(src)
+	return copyFileFS(OSFS{}, src, dst)
+}
+
+// copyFileFS copies `src` to `dst` in `fsys`
+func copyFileFS(fsys FS, src, dst string) error {
+	source, err := fsys.Open(src)
 	if err != nil {
 		return err
 	}
 	defer source.Close()
 
-	destination, err := os.Create(dst)
+	destination, err := createFile(fsys, dst)
 	if err != nil {
 		return err
 	}
@@ -275,24 +383,32 @@ func copyFile(src, dst string) error {
 // getWyuFile returns the wyu file identified in the ConfigWYS into
 // the fp location. It checks to see if we have a previously
 // downloaded wyu file and verifies that it matches the adler32
-// checksum present in the ConfigWYS struct
-func (wys ConfigWYS) getWyuFile(args Args, fp string) error {
-	lastWyuDownload := wys.lastWyuDownload()
+// checksum present in the ConfigWYS struct. Returns the number of bytes
+// downloaded, 0 if the cached file was used.
+func (wys ConfigWYS) getWyuFile(ctx context.Context, args Args, fp string) (int64, error) {
+	return wys.fetchWyuFile(ctx, args, fp, true)
+}
 
-	_, err := os.Stat(lastWyuDownload)
+// fetchWyuFile does the work for getWyuFile. A downloaded file is only
+// cached if `cache` is true.
+func (wys ConfigWYS) fetchWyuFile(ctx context.Context, args Args, fp string, cache bool) (int64, error) {
+	fsys := args.fs()
+	lastWyuDownload := lastWyuDownloadPath(args.instDir())
+
+	_, err := fsys.Stat(lastWyuDownload)
 
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		// if there was a stat error and it is anything but an
 		// ErrNotExist then return that error
-		return err
+		return 0, err
 	}
 
 	// err == nil means the file exists. If the UpdateFileAdler32
 	// matches then just copy the cached file
-	if err == nil && VerifyAdler32Checksum(wys.UpdateFileAdler32, lastWyuDownload) {
-		if err := copyFile(lastWyuDownload, fp); err == nil {
-			LogOutputInfoMsg(args, "Reusing cached WYU file")
-			return nil
+	if err == nil && verifyAdler32Checksum(fsys, wys.UpdateFileAdler32, lastWyuDownload) {
+		if err := copyFileFS(fsys, lastWyuDownload, fp); err == nil {
+			args.Logger.Infof("Reusing cached WYU file %s", lastWyuDownload)
+			return 0, nil
 		}
 		// if the copy file fails fall through to downloading
 		// the file
@@ -303,22 +419,31 @@ func (wys ConfigWYS) getWyuFile(args Args, fp string) error {
 	// the wyu file and copy it to the lastWyuDownload (cached
 	// location)
 	urls := wys.GetWYUURLs(args)
-	err = DownloadFileToDisk(urls, fp)
+	if err := downloadFileToDisk(ctx, fsys, args.HTTPClient, urls, fp, args.Logger); err != nil {
+		return 0, withError(ErrNetwork, err)
+	}
 
 	// check to make sure the downloaded file matches the adler32
 	// checksum
-	if err == nil {
-		if VerifyAdler32Checksum(wys.UpdateFileAdler32, fp) {
-			// if this copy fails log the error message
-			// but still return success (no error).
-			if err := copyFile(fp, lastWyuDownload); err != nil {
-				LogOutputInfoMsg(args, fmt.Sprintf("Error caching WYU file: %v", err))
-			}
-		} else {
-			err = fmt.Errorf(`The downloaded file "%s" failed the Adler32 validation.`, fp)
-		}
+	if !verifyAdler32Checksum(fsys, wys.UpdateFileAdler32, fp) {
+		err = fmt.Errorf(`The downloaded file "%s" failed the Adler32 validation.`, fp)
+		return 0, withError(ErrChecksum, err)
+	}
 
+	var downloaded int64
+	if fi, err := fsys.Stat(fp); err == nil {
+		downloaded = fi.Size()
 	}
 
-	return err
+	if !cache {
+		return downloaded, nil
+	}
+
+	// if this copy fails log the error message
+	// but still return success (no error).
+	if err := copyFileFS(fsys, fp, lastWyuDownload); err != nil {
+		args.Logger.Warnf("Error caching WYU file: %v", err)
+	}
+
+	return downloaded, nil
 }
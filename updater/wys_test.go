@@ -1,7 +1,10 @@
 package updater
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -51,8 +54,8 @@ func TestWYS_getWyuFile(t *testing.T) {
 	baseDir, _ := ioutil.TempDir("", "test-getWyuFile")
 	defer os.RemoveAll(baseDir)
 
-	// name the cached wyu location and the download location
-	lastWyuFilePath = filepath.Join(baseDir, "last-download-wyu")
+	// the cached wyu is kept in the install dir
+	args.InstallDir = baseDir
 	downloadLoc := filepath.Join(baseDir, "wyu-download")
 
 	// diddle the wys struct URLs to point to our test server
@@ -65,7 +68,7 @@ func TestWYS_getWyuFile(t *testing.T) {
 
 	// get the wyu file. We expect that download count to
 	// increment
-	err = wys.getWyuFile(args, downloadLoc)
+	_, err = wys.getWyuFile(context.Background(), args, downloadLoc)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, downloadCount)
 
@@ -74,7 +77,7 @@ func TestWYS_getWyuFile(t *testing.T) {
 
 	// get the wyu file again. We expect to use the locally cached
 	// version and *not* increment the download count
-	err = wys.getWyuFile(args, downloadLoc)
+	_, err = wys.getWyuFile(context.Background(), args, downloadLoc)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, downloadCount)
 
@@ -82,3 +85,64 @@ func TestWYS_getWyuFile(t *testing.T) {
 	_, err = os.Stat(downloadLoc)
 	assert.NoError(t, err)
 }
+
+func TestWYS_WriteWYS(t *testing.T) {
+	info := Info{}
+	orig, err := info.ParseWYSFromFilePath("./testdata/widgetX.1.0.1.wys", Args{})
+	assert.Nil(t, err)
+
+	// every field round-trips, the update details of the original are
+	// collapsed into one
+	orig.RTF = []byte{1}
+	orig.ServerFileSite = "http://127.0.0.1/updates/widgetx.wys"
+	orig.UpdateErrorText = "no update"
+	orig.UpdateErrorLink = "http://127.0.0.1/help"
+	var buf bytes.Buffer
+	assert.Nil(t, WriteWYS(&buf, orig))
+	wys, err := info.ParseWYSFromReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, orig, wys)
+
+	// and round-trips again byte for byte
+	var again bytes.Buffer
+	assert.Nil(t, WriteWYS(&again, wys))
+	assert.Equal(t, buf.Bytes(), again.Bytes())
+}
+
+func TestWYS_WriteWYS_dummyVarLen(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, WriteWYS(&buf, ConfigWYS{CurrentLastVersion: "1.0.1", VersionToUpdate: "1.0.1"}))
+	zipr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	f, err := zipr.Open(wysEntryName)
+	assert.Nil(t, err)
+	dat, err := io.ReadAll(f)
+	assert.Nil(t, err)
+
+	// the dummy var length covers the update details, up to END_WYS
+	r := bytes.NewReader(dat[len(WYS_HEADER):])
+	assert.Equal(t, uint8(DSTRING_WYS_CURRENT_LAST_VERSION), ReadWYSTLV(r).Tag)
+	dummy := ReadWYSTLV(r)
+	assert.Equal(t, uint8(INT_WYS_DUMMY_VAR_LEN), dummy.Tag)
+	assert.Equal(t, int(dummy.Length)+1, r.Len())
+	assert.Equal(t, byte(END_WYS), dat[len(dat)-1])
+}
+
+func TestWYS_NewWYS(t *testing.T) {
+	const wyuFile = "./testdata/widgetX.1.0.1.wyu"
+	sites := []string{"http://127.0.0.1/updates/widgetx.1.0.1.wyu"}
+	wys, err := NewWYS("1.0.1", wyuFile, sites)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0.1", wys.VersionToUpdate)
+	assert.Equal(t, sites, wys.UpdateFileSite)
+	assert.True(t, VerifyAdler32Checksum(wys.UpdateFileAdler32, wyuFile))
+
+	fp := filepath.Join(t.TempDir(), "widgetx.wys")
+	assert.Nil(t, WriteWYSFile(fp, wys))
+	parsed, err := Info{}.ParseWYSFromFilePath(fp, Args{})
+	assert.Nil(t, err)
+	assert.Equal(t, wys, parsed)
+
+	_, err = NewWYS("1.0.1", "missing.wyu", sites)
+	assert.NotNil(t, err)
+}
@@ -1,8 +1,168 @@
 package updater
 
+import (
+	"archive/zip"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
 // functions to decompress .wyu file
 // .wyu files contain
 // - updtdetails.upt (update details)
 // - base/service.exe (updated/new file)
 // - base/config.ini (updated/new file)
 // - base/uninstall.exe (updated/new file)
+
+// wyuBaseDir is the directory in a WYU archive with the files to install
+const wyuBaseDir = "base"
+
+// WYUBuilder builds a WYU archive from a directory tree, like wyBuild
+type WYUBuilder struct {
+	// Dir is the directory with the files to install. The files are added
+	// to base/ in the archive. The updater installs every file into the
+	// install directory itself, so the names have to be unique.
+	Dir string
+
+	// ServicesToStop are stopped before the files are installed
+	ServicesToStop []string
+
+	// ServicesToStart are started after the files are installed
+	ServicesToStart []string
+}
+
+// Build writes the WYU archive to `w` and returns its update details, with
+// a file information block for each file
+func (b WYUBuilder) Build(w io.Writer) (udt ConfigUDT, err error) {
+	files, err := b.files()
+	if err != nil {
+		return udt, err
+	}
+	if len(files) == 0 {
+		return udt, fmt.Errorf("no files to update in %s", b.Dir)
+	}
+
+	zipw := zip.NewWriter(w)
+	for _, rel := range files {
+		file, err := addFileToWYU(zipw, filepath.Join(b.Dir, rel), path.Join(wyuBaseDir, filepath.ToSlash(rel)))
+		if err != nil {
+			return udt, err
+		}
+		udt.Files = append(udt.Files, file)
+	}
+
+	udt.NumberOfRegistryChanges = TLV{Tag: INT_UDT_NUMBER_OF_REGISTRY_CHANGES, Length: 4, Value: intToValue(0)}
+	udt.NumberOfFileInfos = TLV{Tag: INT_UDT_NUMBER_OF_FILE_INFOS, Length: 4, Value: intToValue(uint32(len(udt.Files)))}
+	for _, s := range b.ServicesToStop {
+		udt.ServiceToStopBeforeUpdate = append(udt.ServiceToStopBeforeUpdate, udtServiceTLV(STRING_UDT_SERVICE_TO_STOP_BEFORE_UPDATE, s))
+	}
+	for _, s := range b.ServicesToStart {
+		udt.ServiceToStartAfterUpdate = append(udt.ServiceToStartAfterUpdate, udtServiceTLV(STRING_UDT_SERVICE_TO_START_AFTER_UPDATE, s))
+	}
+
+	udtw, err := zipw.CreateHeader(&zip.FileHeader{Name: UPDTDETAILS_UDT, Method: zip.Deflate})
+	if err != nil {
+		return udt, err
+	}
+	if err := writeUDT(udtw, udt); err != nil {
+		return udt, err
+	}
+
+	return udt, zipw.Close()
+}
+
+// BuildFile writes the WYU archive to `path`. See Build.
+func (b WYUBuilder) BuildFile(path string) (ConfigUDT, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return ConfigUDT{}, err
+	}
+
+	udt, err := b.Build(f)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return udt, err
+}
+
+// files returns the paths of the files in Dir relative to Dir, in the order
+// they are added to the archive
+func (b WYUBuilder) files() ([]string, error) {
+	var files []string
+	names := make(map[string]string)
+	err := filepath.WalkDir(b.Dir, func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", fp)
+		}
+
+		rel, err := filepath.Rel(b.Dir, fp)
+		if err != nil {
+			return err
+		}
+		name := strings.ToLower(d.Name())
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("%s and %s would be installed to the same file", other, rel)
+		}
+		names[name] = rel
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// addFileToWYU adds the file `fp` to the archive as `name` and returns its
+// file information
+func addFileToWYU(zipw *zip.Writer, fp string, name string) (UDTFile, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return UDTFile{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return UDTFile{}, err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return UDTFile{}, err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	w, err := zipw.CreateHeader(header)
+	if err != nil {
+		return UDTFile{}, err
+	}
+	sum := adler32.New()
+	if _, err := io.Copy(io.MultiWriter(w, sum), f); err != nil {
+		return UDTFile{}, err
+	}
+
+	return UDTFile{
+		// wyUpdate uses Windows paths
+		RelativePath:   strings.ReplaceAll(name, "/", `\`),
+		NewFileAdler32: int64(sum.Sum32()),
+	}, nil
+}
+
+// udtServiceTLV returns the TLV of a service to stop or start
+func udtServiceTLV(tag uint8, name string) TLV {
+	tlv := serviceTLV(name)
+	tlv.Tag = tag
+	return tlv
+}
@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"bytes"
+	"hash/adler32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWYUBuilder_BuildFile(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "conf"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "widget.exe"), []byte("widget 1.0.1"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "conf", "widget.ini"), []byte("[widget]"), 0644))
+
+	b := WYUBuilder{Dir: dir, ServicesToStop: []string{"widget"}, ServicesToStart: []string{"widget", "gadget"}}
+	wyu := filepath.Join(t.TempDir(), "widget.wyu")
+	udt, err := b.BuildFile(wyu)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(udt.Files))
+
+	extractDir := t.TempDir()
+	_, files, err := Unzip(OSFS{}, wyu, extractDir)
+	assert.Nil(t, err)
+	parsed, updates, err := GetUpdateDetails(OSFS{}, files)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(updates))
+	assert.Equal(t, udt.Files, parsed.Files)
+	assert.Equal(t, 2, ValueToInt(&parsed.NumberOfFileInfos))
+	assert.Equal(t, 1, len(parsed.ServiceToStopBeforeUpdate))
+	assert.Equal(t, 2, len(parsed.ServiceToStartAfterUpdate))
+	assert.Equal(t, "gadget", string(parsed.ServiceToStartAfterUpdate[1].Value))
+
+	// the checksums match the extracted files
+	for _, file := range parsed.Files {
+		rel := filepath.FromSlash(string(bytes.ReplaceAll([]byte(file.RelativePath), []byte(`\`), []byte("/"))))
+		dat, err := os.ReadFile(filepath.Join(extractDir, rel))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(adler32.Checksum(dat)), file.NewFileAdler32)
+	}
+}
+
+func TestWYUBuilder_Build_error(t *testing.T) {
+	var buf bytes.Buffer
+
+	// nothing to update
+	_, err := WYUBuilder{Dir: t.TempDir()}.Build(&buf)
+	assert.NotNil(t, err)
+
+	// both files would be installed as widget.exe
+	dir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "x86"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "widget.exe"), nil, 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "x86", "Widget.exe"), nil, 0644))
+	_, err = WYUBuilder{Dir: dir}.Build(&buf)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "same file")
+
+	// a failed build doesn't leave a partial file behind
+	wyu := filepath.Join(t.TempDir(), "widget.wyu")
+	_, err = WYUBuilder{Dir: dir}.BuildFile(wyu)
+	assert.NotNil(t, err)
+	assert.False(t, pathExists(OSFS{}, wyu))
+}